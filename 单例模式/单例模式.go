@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 )
 
 type Singleton struct {
@@ -13,17 +15,181 @@ func (s *Singleton) DoSomething() {
 	fmt.Println("Doing something...")
 }
 
-var singletonInstance *Singleton
-var once sync.Once
-
-func NewSingleton() *Singleton {
-	once.Do(func() {
-		singletonInstance = &Singleton{}
-	})
-	return singletonInstance
+// NewSingleton 是 Singleton 的提供者，由容器保证只创建一次
+func NewSingleton(r *Resolver) (*Singleton, error) {
+	return &Singleton{}, nil
 }
 
 func main() {
-	singleton := NewSingleton()
+	container := NewContainer()
+	Provide(container, LifetimeSingleton, NewSingleton)
+	singleton, err := Resolve[*Singleton](container)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 	singleton.DoSomething()
+	again := MustResolve[*Singleton](container.Scope())
+	fmt.Println("same singleton from a scope:", again == singleton)
+	fmt.Println("")
+
+	containerDemo()
+	fmt.Println("")
+
+	// 前两次初始化失败（第二次是 panic），之后成功
+	var attempts atomic.Int32
+	conn := NewLazy(func() (string, error) {
+		switch attempts.Add(1) {
+		case 1:
+			return "", errors.New("connection refused")
+		case 2:
+			panic("config not loaded")
+		}
+		return "db-connection", nil
+	})
+	for i := 0; i < 4; i++ {
+		v, err := conn.Get()
+		fmt.Printf("get %d: value=%q err=%v attempts=%d\n", i+1, v, err, attempts.Load())
+	}
+
+	// 100 个 goroutine 同时第一次访问，初始化只执行一次
+	var inits atomic.Int32
+	type pool struct{ generation int32 }
+	shared := NewLazy(func() (*pool, error) {
+		return &pool{generation: inits.Add(1)}, nil
+	})
+	var wg sync.WaitGroup
+	instances := make([]*pool, 100)
+	for i := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instances[i] = shared.MustGet()
+		}()
+	}
+	wg.Wait()
+	same := true
+	for _, s := range instances {
+		same = same && s == instances[0]
+	}
+	fmt.Println("concurrent first access: inits =", inits.Load(), "same instance =", same)
+
+	shared.Reset()
+	after := shared.MustGet()
+	fmt.Println("after reset: inits =", inits.Load(), "generation =", after.generation)
+	fmt.Println("")
+
+	// 多例：每个租户一个连接，最多 3 个，关闭时按创建顺序的逆序关闭
+	tenants := NewRegistry(func(tenant string) (*TenantConn, error) {
+		if tenant == "" {
+			return nil, errors.New("empty tenant")
+		}
+		fmt.Println("open", tenant)
+		return &TenantConn{Tenant: tenant}, nil
+	}, WithMaxInstances(3))
+	for _, tenant := range []string{"acme", "globex", "acme", "", "initech", "umbrella"} {
+		c, err := tenants.Get(tenant)
+		if err != nil {
+			fmt.Printf("get %q: %v\n", tenant, err)
+			continue
+		}
+		fmt.Printf("get %q: %p\n", tenant, c)
+	}
+	fmt.Println("tenants:", tenants.Keys())
+	fmt.Println("close:", tenants.Close())
+	_, err = tenants.Get("acme")
+	fmt.Println("get after close:", err)
+}
+
+// TenantConn 是某个租户的连接
+type TenantConn struct {
+	Tenant string
+}
+
+func (c *TenantConn) Close() error {
+	fmt.Println("close", c.Tenant)
+	if c.Tenant == "globex" {
+		return errors.New("connection reset")
+	}
+	return nil
+}
+
+// Config 是单例，RequestLog 每个请求一个，Handler 每次解析都是新的
+type Config struct{ DSN string }
+
+type RequestLog struct {
+	ID    int
+	Lines []string
+}
+
+func (l *RequestLog) Close() error {
+	fmt.Printf("  flush request %d: %q\n", l.ID, l.Lines)
+	return nil
+}
+
+type Handler struct {
+	Config *Config
+	Log    *RequestLog
+}
+
+// 互相依赖的两个服务
+type ServiceA struct{ B *ServiceB }
+type ServiceB struct{ A *ServiceA }
+
+func containerDemo() {
+	c := NewContainer()
+	ProvideValue(c, &Config{DSN: "postgres://localhost/app"})
+	requests := 0
+	Provide(c, LifetimeScoped, func(r *Resolver) (*RequestLog, error) {
+		requests++
+		return &RequestLog{ID: requests}, nil
+	})
+	Provide(c, LifetimeTransient, func(r *Resolver) (*Handler, error) {
+		config, err := Resolve[*Config](r)
+		if err != nil {
+			return nil, err
+		}
+		log, err := Resolve[*RequestLog](r)
+		if err != nil {
+			return nil, err
+		}
+		return &Handler{Config: config, Log: log}, nil
+	})
+
+	for i := 0; i < 2; i++ {
+		scope := c.Scope()
+		h1 := MustResolve[*Handler](scope)
+		h2 := MustResolve[*Handler](scope)
+		h1.Log.Lines = append(h1.Log.Lines, "GET /orders")
+		h2.Log.Lines = append(h2.Log.Lines, "GET /orders/1")
+		fmt.Printf("request %d: handlers distinct=%v, shared log=%v, shared config=%v\n",
+			h1.Log.ID, h1 != h2, h1.Log == h2.Log, h1.Config == h2.Config)
+		scope.Close()
+	}
+
+	// 在根容器中解析需要作用域实例的服务
+	_, err := Resolve[*Handler](c)
+	fmt.Println("root:", err, errors.Is(err, ErrNoScope))
+
+	// 循环依赖
+	Provide(c, LifetimeSingleton, func(r *Resolver) (*ServiceA, error) {
+		b, err := Resolve[*ServiceB](r)
+		return &ServiceA{B: b}, err
+	})
+	Provide(c, LifetimeTransient, func(r *Resolver) (*ServiceB, error) {
+		a, err := Resolve[*ServiceA](r)
+		return &ServiceB{A: a}, err
+	})
+	_, err = Resolve[*ServiceA](c)
+	fmt.Println("cycle:", err, errors.Is(err, ErrDependencyCycle))
+
+	// 测试中替换依赖：重新登记即可
+	test := NewContainer()
+	ProvideValue(test, &Config{DSN: "sqlite://:memory:"})
+	Provide(test, LifetimeScoped, func(r *Resolver) (*RequestLog, error) { return &RequestLog{ID: -1}, nil })
+	Provide(test, LifetimeTransient, func(r *Resolver) (*Handler, error) {
+		return &Handler{Config: MustResolve[*Config](r), Log: MustResolve[*RequestLog](r)}, nil
+	})
+	_, err = Resolve[*int](test)
+	fmt.Println("test config:", MustResolve[*Handler](test.Scope()).Config.DSN, "| missing:", err)
 }
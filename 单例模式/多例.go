@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// 多例
+// 单例是“整个程序一个实例”，多例是“每个键一个实例”，例如每个数据库名一个连接池、每个租户一个客户端。
+// Registry 在第一次用到某个键时创建实例，每个键的一次创建只执行一次，同一个键并发访问时共享这一次的结果；
+// 创建失败的条目在创建结束时就从注册表中移除，不占用名额，下次访问重新创建。关闭时按创建顺序的逆序关闭实例，后创建的实例可能依赖先创建的实例。
+
+var (
+	// ErrRegistryFull 表示实例数量已经达到上限
+	ErrRegistryFull = errors.New("registry is full")
+	// ErrRegistryClosed 表示注册表已经关闭
+	ErrRegistryClosed = errors.New("registry is closed")
+)
+
+// Closer 是关闭时需要释放资源的实例
+type Closer interface {
+	Close() error
+}
+
+// Registry 按键管理实例，零值不可用，需要通过 NewRegistry 创建
+type Registry[K comparable, T any] struct {
+	factory func(key K) (T, error)
+	max     int
+
+	mu      sync.Mutex
+	entries map[K]*registryEntry[T] // 包括正在创建的条目
+	order   []K                     // 创建成功的顺序
+	closed  bool
+}
+
+// registryEntry 是一个键的一次创建，等待者通过 done 获得结果；创建不会重试
+type registryEntry[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// RegistryOption 用于设置注册表的可选项
+type RegistryOption func(o *registryOptions)
+
+type registryOptions struct {
+	max int
+}
+
+// WithMaxInstances 限制实例数量，正在创建的实例也计算在内；n <= 0 表示不限制
+func WithMaxInstances(n int) RegistryOption {
+	return func(o *registryOptions) {
+		o.max = n
+	}
+}
+
+func NewRegistry[K comparable, T any](factory func(key K) (T, error), opts ...RegistryOption) *Registry[K, T] {
+	var o registryOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Registry[K, T]{factory: factory, max: o.max, entries: map[K]*registryEntry[T]{}}
+}
+
+// Get 返回 key 对应的实例，不存在时创建
+func (r *Registry[K, T]) Get(key K) (T, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		var zero T
+		return zero, ErrRegistryClosed
+	}
+	if entry, ok := r.entries[key]; ok {
+		r.mu.Unlock()
+		<-entry.done
+		return entry.value, entry.err
+	}
+	if r.max > 0 && len(r.entries) >= r.max {
+		r.mu.Unlock()
+		var zero T
+		return zero, fmt.Errorf("%w: %d instances, cannot create %v", ErrRegistryFull, r.max, key)
+	}
+	entry := &registryEntry[T]{done: make(chan struct{})}
+	r.entries[key] = entry
+	r.mu.Unlock()
+
+	r.create(key, entry)
+	return entry.value, entry.err
+}
+
+// create 调用工厂函数并在持有锁时记录结果：成功时记录创建顺序，失败时移除条目；
+// 创建期间注册表被关闭时立即关闭新实例
+func (r *Registry[K, T]) create(key K, entry *registryEntry[T]) {
+	v, err := r.run(key)
+
+	r.mu.Lock()
+	switch {
+	case err != nil:
+		entry.err = fmt.Errorf("create %v: %w", key, err)
+		if r.entries[key] == entry {
+			delete(r.entries, key)
+		}
+	case r.closed:
+		if c, ok := any(v).(Closer); ok {
+			c.Close()
+		}
+		entry.err = ErrRegistryClosed
+	default:
+		entry.value = v
+		r.order = append(r.order, key)
+	}
+	r.mu.Unlock()
+	close(entry.done)
+}
+
+// run 调用工厂函数，把 panic 转换为错误
+func (r *Registry[K, T]) run(key K) (value T, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			var zero T
+			value, err = zero, fmt.Errorf("%w: %v", ErrInitPanic, p)
+		}
+	}()
+	return r.factory(key)
+}
+
+// Keys 按创建顺序返回已经创建的键
+func (r *Registry[K, T]) Keys() []K {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]K(nil), r.order...)
+}
+
+// Len 返回已经创建的实例数量
+func (r *Registry[K, T]) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.order)
+}
+
+// Close 关闭注册表，按创建顺序的逆序关闭实现了 Closer 的实例，返回所有关闭错误
+// 重复调用 Close 返回 nil
+func (r *Registry[K, T]) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	order := r.order
+	entries := r.entries
+	r.order, r.entries = nil, map[K]*registryEntry[T]{}
+	r.mu.Unlock()
+
+	// order 中的条目都已经创建成功，正在创建的条目由 create 自己关闭
+	var errs []error
+	for i := len(order) - 1; i >= 0; i-- {
+		key := order[i]
+		if c, ok := any(entries[key].value).(Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close %v: %w", key, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// registryItem 记录自己被关闭的次数，关闭顺序写入共享的 closeLog
+type registryItem struct {
+	key      string
+	closed   atomic.Int32
+	closeErr error
+	closeLog *closeLog
+}
+
+func (i *registryItem) Close() error {
+	i.closed.Add(1)
+	if i.closeLog != nil {
+		i.closeLog.add(i.key)
+	}
+	return i.closeErr
+}
+
+type closeLog struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (l *closeLog) add(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.keys = append(l.keys, key)
+}
+
+func TestRegistryCreatesOncePerKey(t *testing.T) {
+	var creates sync.Map
+	r := NewRegistry(func(key string) (*registryItem, error) {
+		n, _ := creates.LoadOrStore(key, new(atomic.Int32))
+		n.(*atomic.Int32).Add(1)
+		return &registryItem{key: key}, nil
+	})
+	keys := []string{"a", "b", "c"}
+	got := make([][]*registryItem, len(keys))
+	for i := range got {
+		got[i] = make([]*registryItem, 32)
+	}
+	var wg sync.WaitGroup
+	for i := range keys {
+		for j := range got[i] {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				v, err := r.Get(keys[i])
+				if err != nil {
+					t.Error(err)
+				}
+				got[i][j] = v
+			}()
+		}
+	}
+	wg.Wait()
+
+	for i, key := range keys {
+		n, _ := creates.Load(key)
+		if c := n.(*atomic.Int32).Load(); c != 1 {
+			t.Errorf("%s created %d times, want 1", key, c)
+		}
+		for _, v := range got[i] {
+			if v != got[i][0] {
+				t.Fatalf("%s: goroutines got different instances", key)
+			}
+		}
+	}
+	if r.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", r.Len())
+	}
+}
+
+func TestRegistryBoundCountsInFlightCreations(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	r := NewRegistry(func(key string) (*registryItem, error) {
+		if key == "slow" {
+			close(entered)
+			<-release
+		}
+		return &registryItem{key: key}, nil
+	}, WithMaxInstances(2))
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := r.Get("slow")
+		slow <- err
+	}()
+	<-entered
+	if _, err := r.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Get("b"); !errors.Is(err, ErrRegistryFull) {
+		t.Fatalf("Get(b) with slow in flight: err = %v, want ErrRegistryFull", err)
+	}
+	close(release)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Keys(); !reflect.DeepEqual(got, []string{"a", "slow"}) {
+		t.Fatalf("Keys = %v, want [a slow]", got)
+	}
+	// 已经创建的键不受上限影响
+	if _, err := r.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegistryFailureDoesNotUseSlot(t *testing.T) {
+	errDown := errors.New("tenant database down")
+	var attempts atomic.Int32
+	r := NewRegistry(func(key string) (*registryItem, error) {
+		if key == "bad" {
+			attempts.Add(1)
+			return nil, errDown
+		}
+		if key == "panic" {
+			panic("bad config")
+		}
+		return &registryItem{key: key}, nil
+	}, WithMaxInstances(1))
+
+	if _, err := r.Get("bad"); !errors.Is(err, errDown) {
+		t.Fatalf("Get(bad): err = %v, want %v", err, errDown)
+	}
+	if _, err := r.Get("panic"); !errors.Is(err, ErrInitPanic) {
+		t.Fatalf("Get(panic): err = %v, want ErrInitPanic", err)
+	}
+	if _, err := r.Get("good"); err != nil {
+		t.Fatalf("Get(good) after failures: %v", err)
+	}
+	// 失败的键没有被缓存，名额满了之后再访问会被拒绝，而不是返回旧的错误
+	if _, err := r.Get("bad"); !errors.Is(err, ErrRegistryFull) || attempts.Load() != 1 {
+		t.Fatalf("Get(bad) again: err = %v after %d attempts; want ErrRegistryFull", err, attempts.Load())
+	}
+	if r.Len() != 1 {
+		t.Fatalf("Len = %d, want 1", r.Len())
+	}
+}
+
+// TestRegistryFailuresUnderConcurrency 让一半的创建失败，同时从多个 goroutine 访问：
+// 每个键最多记录一次，上限不会被突破，每个创建出来的实例都恰好关闭一次
+func TestRegistryFailuresUnderConcurrency(t *testing.T) {
+	const max = 3
+	var mu sync.Mutex
+	var created []*registryItem
+	var attempts atomic.Int32
+	r := NewRegistry(func(key string) (*registryItem, error) {
+		if attempts.Add(1)%2 == 1 {
+			return nil, errors.New("flaky")
+		}
+		item := &registryItem{key: key}
+		mu.Lock()
+		created = append(created, item)
+		mu.Unlock()
+		return item, nil
+	}, WithMaxInstances(max))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				r.Get(fmt.Sprintf("k%d", (i+j)%5))
+			}
+		}()
+	}
+	wg.Wait()
+
+	keys := r.Keys()
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if seen[key] {
+			t.Fatalf("key %s recorded twice: %v", key, keys)
+		}
+		seen[key] = true
+	}
+	if len(keys) > max || len(created) != len(keys) {
+		t.Fatalf("%d keys, %d instances created; want the same number, at most %d", len(keys), len(created), max)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range created {
+		if n := item.closed.Load(); n != 1 {
+			t.Errorf("%s closed %d times, want 1", item.key, n)
+		}
+	}
+}
+
+func TestRegistryCloseInReverseOrder(t *testing.T) {
+	log := &closeLog{}
+	errs := map[string]error{"b": errors.New("b busy"), "c": errors.New("c busy")}
+	r := NewRegistry(func(key string) (*registryItem, error) {
+		return &registryItem{key: key, closeErr: errs[key], closeLog: log}, nil
+	})
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := r.Get(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := r.Close()
+	if !errors.Is(err, errs["b"]) || !errors.Is(err, errs["c"]) {
+		t.Fatalf("Close error = %v, want both close errors", err)
+	}
+	if want := "close c: c busy\nclose b: b busy"; err.Error() != want {
+		t.Fatalf("Close error = %q, want %q", err, want)
+	}
+	if want := []string{"c", "b", "a"}; !reflect.DeepEqual(log.keys, want) {
+		t.Fatalf("close order = %v, want %v", log.keys, want)
+	}
+
+	if _, err := r.Get("a"); !errors.Is(err, ErrRegistryClosed) {
+		t.Fatalf("Get after Close: err = %v, want ErrRegistryClosed", err)
+	}
+	if err := r.Close(); err != nil || len(log.keys) != 3 {
+		t.Fatalf("second Close = %v and closed %v; want nil and nothing closed again", err, log.keys)
+	}
+}
+
+func TestRegistryCloseDuringCreation(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	var item *registryItem
+	r := NewRegistry(func(key string) (*registryItem, error) {
+		close(entered)
+		<-release
+		item = &registryItem{key: key}
+		return item, nil
+	})
+
+	got := make(chan error, 1)
+	go func() {
+		_, err := r.Get("a")
+		got <- err
+	}()
+	<-entered
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := <-got; !errors.Is(err, ErrRegistryClosed) {
+		t.Fatalf("Get during Close: err = %v, want ErrRegistryClosed", err)
+	}
+	if item.closed.Load() != 1 {
+		t.Fatal("instance created after Close was not closed")
+	}
+}
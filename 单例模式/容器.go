@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// 依赖注入容器
+// 全局单例把“只有一个实例”和“在哪里创建”绑在了一起，测试时很难替换。容器把创建方式登记为提供者，按类型解析：
+// 单例（LifetimeSingleton）在根容器中只创建一次，作用域（LifetimeScoped）在每个作用域（例如每个请求）中创建一次，
+// 瞬态（LifetimeTransient）每次解析都创建新的实例。测试时重新登记提供者即可替换依赖。
+// 提供者通过 Resolver 解析自己的依赖，Resolver 记录了当前的解析路径，出现循环依赖时返回带完整路径的错误。
+
+var (
+	// ErrNotRegistered 表示类型没有登记提供者
+	ErrNotRegistered = errors.New("no provider registered")
+	// ErrDependencyCycle 表示依赖之间有循环
+	ErrDependencyCycle = errors.New("dependency cycle")
+	// ErrNoScope 表示在作用域之外解析作用域实例，例如单例依赖了作用域实例
+	ErrNoScope = errors.New("scoped service resolved outside a scope")
+	// ErrContainerClosed 表示容器或作用域已经关闭
+	ErrContainerClosed = errors.New("container is closed")
+)
+
+// Lifetime 是实例的生命周期
+type Lifetime int
+
+const (
+	LifetimeTransient Lifetime = iota
+	LifetimeSingleton
+	LifetimeScoped
+)
+
+func (l Lifetime) String() string {
+	switch l {
+	case LifetimeSingleton:
+		return "singleton"
+	case LifetimeScoped:
+		return "scoped"
+	}
+	return "transient"
+}
+
+// ResolveError 是解析失败的错误，Path 是从最外层开始的解析路径
+type ResolveError struct {
+	Path []reflect.Type
+	Err  error
+}
+
+func (e *ResolveError) Error() string {
+	names := make([]string, len(e.Path))
+	for i, t := range e.Path {
+		names[i] = t.String()
+	}
+	return fmt.Sprintf("resolve %s: %v", strings.Join(names, " -> "), e.Err)
+}
+
+func (e *ResolveError) Unwrap() error {
+	return e.Err
+}
+
+type provider struct {
+	lifetime Lifetime
+	factory  func(r *Resolver) (any, error)
+}
+
+// Container 是根容器或者它的作用域；提供者登记在根容器中，所有作用域共享
+type Container struct {
+	root *Container
+
+	mu        sync.Mutex
+	providers map[reflect.Type]*provider // 只在根容器中使用
+	instances map[reflect.Type]any       // 根容器中是单例，作用域中是作用域实例
+	created   []any                      // 创建顺序，关闭时逆序
+	closed    bool
+
+	// creating 保证同一个容器中的实例只创建一次，同一条解析链中不会重复加锁
+	creating sync.Mutex
+}
+
+func NewContainer() *Container {
+	c := &Container{providers: map[reflect.Type]*provider{}, instances: map[reflect.Type]any{}}
+	c.root = c
+	return c
+}
+
+// Scope 创建一个作用域，作用域实例缓存在作用域中，关闭作用域时一起关闭
+func (c *Container) Scope() *Container {
+	return &Container{root: c.root, instances: map[reflect.Type]any{}}
+}
+
+// Injector 是可以解析依赖的对象：*Container 或提供者拿到的 *Resolver
+type Injector interface {
+	resolve(t reflect.Type) (any, error)
+}
+
+// Resolver 在提供者中解析依赖，记录了当前的解析路径
+type Resolver struct {
+	scope  *Container
+	path   []reflect.Type
+	locked []*Container // 这条解析链已经持有 creating 锁的容器
+}
+
+// Provide 登记类型 T 的提供者，重复登记会覆盖之前的提供者
+func Provide[T any](c *Container, lifetime Lifetime, factory func(r *Resolver) (T, error)) {
+	root := c.root
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	root.providers[reflect.TypeFor[T]()] = &provider{
+		lifetime: lifetime,
+		factory:  func(r *Resolver) (any, error) { return factory(r) },
+	}
+}
+
+// ProvideValue 把已经创建好的值登记为单例
+func ProvideValue[T any](c *Container, value T) {
+	Provide(c, LifetimeSingleton, func(*Resolver) (T, error) { return value, nil })
+}
+
+// Resolve 解析类型 T 的实例
+func Resolve[T any](in Injector) (T, error) {
+	v, err := in.resolve(reflect.TypeFor[T]())
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	// 提供者返回 nil 接口时 v 为 nil
+	t, _ := v.(T)
+	return t, nil
+}
+
+// MustResolve 解析类型 T 的实例，失败时 panic
+func MustResolve[T any](in Injector) T {
+	v, err := Resolve[T](in)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func (c *Container) resolve(t reflect.Type) (any, error) {
+	return (&Resolver{scope: c}).resolve(t)
+}
+
+func (r *Resolver) resolve(t reflect.Type) (any, error) {
+	path := append(append([]reflect.Type(nil), r.path...), t)
+	for _, seen := range r.path {
+		if seen == t {
+			return nil, &ResolveError{Path: path, Err: ErrDependencyCycle}
+		}
+	}
+
+	root := r.scope.root
+	root.mu.Lock()
+	p, ok := root.providers[t]
+	root.mu.Unlock()
+	if !ok {
+		return nil, &ResolveError{Path: path, Err: ErrNotRegistered}
+	}
+
+	next := &Resolver{scope: r.scope, path: path, locked: r.locked}
+	switch p.lifetime {
+	case LifetimeSingleton:
+		// 单例的依赖从根容器解析，因此单例不能依赖作用域实例
+		next.scope = root
+		return next.cached(root, t, p)
+	case LifetimeScoped:
+		if r.scope == root {
+			return nil, &ResolveError{Path: path, Err: ErrNoScope}
+		}
+		return next.cached(r.scope, t, p)
+	}
+	return next.create(p)
+}
+
+// cached 返回 owner 中缓存的实例，没有时创建并缓存
+func (r *Resolver) cached(owner *Container, t reflect.Type, p *provider) (any, error) {
+	if v, ok, err := owner.lookup(t); ok || err != nil {
+		if err != nil {
+			err = &ResolveError{Path: r.path, Err: err}
+		}
+		return v, err
+	}
+	held := false
+	for _, c := range r.locked {
+		held = held || c == owner
+	}
+	if !held {
+		owner.creating.Lock()
+		defer owner.creating.Unlock()
+		// 提供者返回后锁就释放了；提供者如果保存了 Resolver 之后再用，不能再当作持有锁
+		prev := r.locked
+		defer func() { r.locked = prev }()
+		r.locked = append(append([]*Container(nil), r.locked...), owner)
+		// 等锁期间其他 goroutine 可能已经创建好了
+		if v, ok, err := owner.lookup(t); ok || err != nil {
+			if err != nil {
+				err = &ResolveError{Path: r.path, Err: err}
+			}
+			return v, err
+		}
+	}
+
+	v, err := r.create(p)
+	if err != nil {
+		return nil, err
+	}
+	owner.mu.Lock()
+	owner.instances[t] = v
+	owner.created = append(owner.created, v)
+	owner.mu.Unlock()
+	return v, nil
+}
+
+// create 调用提供者；依赖解析失败时错误已经带有路径，直接返回
+func (r *Resolver) create(p *provider) (any, error) {
+	v, err := p.factory(r)
+	if err != nil {
+		var re *ResolveError
+		if errors.As(err, &re) {
+			return nil, err
+		}
+		return nil, &ResolveError{Path: r.path, Err: err}
+	}
+	return v, nil
+}
+
+func (c *Container) lookup(t reflect.Type) (any, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, false, ErrContainerClosed
+	}
+	v, ok := c.instances[t]
+	return v, ok, nil
+}
+
+// Close 按创建顺序的逆序关闭容器中实现了 Closer 的实例：根容器关闭单例，作用域关闭作用域实例
+// 瞬态实例不归容器管理，由使用者自己关闭
+func (c *Container) Close() error {
+	c.creating.Lock()
+	defer c.creating.Unlock()
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	created := c.created
+	c.created, c.instances = nil, map[reflect.Type]any{}
+	c.mu.Unlock()
+
+	var errs []error
+	for i := len(created) - 1; i >= 0; i-- {
+		if closer, ok := created[i].(Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close %T: %w", created[i], err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
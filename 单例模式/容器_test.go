@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type (
+	containerSession struct{ saved *Resolver }
+	containerDB      struct{ n int32 }
+)
+
+// TestResolverSavedByProviderLocksAgain 让提供者保存 Resolver，在它返回之后再用来解析单例：
+// 此时另一个 goroutine 正在创建同一个单例，保存的 Resolver 必须等锁，而不是再创建一次
+func TestResolverSavedByProviderLocksAgain(t *testing.T) {
+	c := NewContainer()
+	Provide(c, LifetimeSingleton, func(r *Resolver) (*containerSession, error) {
+		return &containerSession{saved: r}, nil
+	})
+	var creates atomic.Int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	Provide(c, LifetimeSingleton, func(r *Resolver) (*containerDB, error) {
+		n := creates.Add(1)
+		if n == 1 {
+			close(entered)
+			<-release
+		}
+		return &containerDB{n: n}, nil
+	})
+
+	saved := MustResolve[*containerSession](c).saved
+
+	first := make(chan *containerDB, 1)
+	go func() { first <- MustResolve[*containerDB](c) }()
+	<-entered
+	second := make(chan *containerDB, 1)
+	go func() { second <- MustResolve[*containerDB](saved) }()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	a, b := <-first, <-second
+	if n := creates.Load(); n != 1 || a != b {
+		t.Fatalf("singleton created %d times (%p, %p), want once", n, a, b)
+	}
+}
+
+type (
+	containerConfig  struct{ *registryItem }
+	containerRepo    struct{ *registryItem }
+	containerRequest struct{ *registryItem }
+	containerTask    struct{ n int }
+	cycleA           struct{}
+	cycleB           struct{}
+)
+
+// newTestContainer 登记单例 config 和依赖它的 repo、作用域实例 request 和瞬态实例 task，关闭顺序写入 log
+func newTestContainer(log *closeLog) *Container {
+	c := NewContainer()
+	Provide(c, LifetimeSingleton, func(r *Resolver) (*containerConfig, error) {
+		return &containerConfig{&registryItem{key: "config", closeLog: log}}, nil
+	})
+	Provide(c, LifetimeSingleton, func(r *Resolver) (*containerRepo, error) {
+		if _, err := Resolve[*containerConfig](r); err != nil {
+			return nil, err
+		}
+		return &containerRepo{&registryItem{key: "repo", closeLog: log}}, nil
+	})
+	Provide(c, LifetimeScoped, func(r *Resolver) (*containerRequest, error) {
+		if _, err := Resolve[*containerRepo](r); err != nil {
+			return nil, err
+		}
+		return &containerRequest{&registryItem{key: "request", closeLog: log}}, nil
+	})
+	var tasks int
+	Provide(c, LifetimeTransient, func(r *Resolver) (*containerTask, error) {
+		tasks++
+		return &containerTask{n: tasks}, nil
+	})
+	return c
+}
+
+func TestContainerLifetimes(t *testing.T) {
+	c := newTestContainer(nil)
+	s1, s2 := c.Scope(), c.Scope()
+
+	repo := MustResolve[*containerRepo](c)
+	if MustResolve[*containerRepo](s1) != repo || MustResolve[*containerRepo](s2) != repo {
+		t.Fatal("singleton differs between the root and its scopes")
+	}
+
+	req := MustResolve[*containerRequest](s1)
+	if MustResolve[*containerRequest](s1) != req {
+		t.Fatal("scoped instance differs within one scope")
+	}
+	if MustResolve[*containerRequest](s2) == req {
+		t.Fatal("two scopes share a scoped instance")
+	}
+
+	t1, t2 := MustResolve[*containerTask](c), MustResolve[*containerTask](s1)
+	if t1 == t2 || t1.n != 1 || t2.n != 2 {
+		t.Fatalf("transient instances %d and %d, want a new one per resolve", t1.n, t2.n)
+	}
+}
+
+func TestContainerResolveErrors(t *testing.T) {
+	typ := func(v any) reflect.Type { return reflect.TypeOf(v) }
+	c := newTestContainer(nil)
+	Provide(c, LifetimeSingleton, func(r *Resolver) (*cycleA, error) {
+		_, err := Resolve[*cycleB](r)
+		return &cycleA{}, err
+	})
+	Provide(c, LifetimeTransient, func(r *Resolver) (*cycleB, error) {
+		_, err := Resolve[*cycleA](r)
+		return &cycleB{}, err
+	})
+	// 单例依赖作用域实例
+	Provide(c, LifetimeSingleton, func(r *Resolver) (*containerTask, error) {
+		_, err := Resolve[*containerRequest](r)
+		return &containerTask{}, err
+	})
+	Provide(c, LifetimeSingleton, func(r *Resolver) (cycleB, error) {
+		_, err := Resolve[*int](r)
+		return cycleB{}, err
+	})
+
+	tests := []struct {
+		name    string
+		resolve func() error
+		want    error
+		path    []reflect.Type
+		message string
+	}{
+		{
+			name:    "cycle",
+			resolve: func() error { _, err := Resolve[*cycleA](c.Scope()); return err },
+			want:    ErrDependencyCycle,
+			path:    []reflect.Type{typ(&cycleA{}), typ(&cycleB{}), typ(&cycleA{})},
+			message: "resolve *main.cycleA -> *main.cycleB -> *main.cycleA: dependency cycle",
+		},
+		{
+			name:    "scoped from root",
+			resolve: func() error { _, err := Resolve[*containerRequest](c); return err },
+			want:    ErrNoScope,
+			path:    []reflect.Type{typ(&containerRequest{})},
+		},
+		{
+			name:    "scoped from singleton",
+			resolve: func() error { _, err := Resolve[*containerTask](c.Scope()); return err },
+			want:    ErrNoScope,
+			path:    []reflect.Type{typ(&containerTask{}), typ(&containerRequest{})},
+		},
+		{
+			name:    "not registered",
+			resolve: func() error { _, err := Resolve[cycleB](c); return err },
+			want:    ErrNotRegistered,
+			path:    []reflect.Type{typ(cycleB{}), typ(new(int))},
+			message: "resolve main.cycleB -> *int: no provider registered",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.resolve()
+			var re *ResolveError
+			if !errors.Is(err, tt.want) || !errors.As(err, &re) {
+				t.Fatalf("err = %v, want a ResolveError wrapping %v", err, tt.want)
+			}
+			if !reflect.DeepEqual(re.Path, tt.path) {
+				t.Errorf("path = %v, want %v", re.Path, tt.path)
+			}
+			if tt.message != "" && err.Error() != tt.message {
+				t.Errorf("message = %q, want %q", err, tt.message)
+			}
+		})
+	}
+}
+
+func TestContainerClose(t *testing.T) {
+	log := &closeLog{}
+	c := newTestContainer(log)
+	scope := c.Scope()
+	MustResolve[*containerRequest](scope)
+
+	// 作用域只关闭作用域实例
+	if err := scope.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(log.keys, []string{"request"}) {
+		t.Fatalf("scope closed %v, want [request]", log.keys)
+	}
+	if _, err := Resolve[*containerRequest](scope); !errors.Is(err, ErrContainerClosed) {
+		t.Fatalf("resolve from a closed scope: err = %v, want ErrContainerClosed", err)
+	}
+
+	// 根容器按创建顺序的逆序关闭单例：repo 依赖 config，先关闭 repo
+	MustResolve[*containerRepo](c).closeErr = errors.New("repo busy")
+	err := c.Close()
+	if err == nil || err.Error() != "close *main.containerRepo: repo busy" {
+		t.Fatalf("Close error = %v", err)
+	}
+	if want := []string{"request", "repo", "config"}; !reflect.DeepEqual(log.keys, want) {
+		t.Fatalf("close order = %v, want %v", log.keys, want)
+	}
+	if _, err := Resolve[*containerConfig](c); !errors.Is(err, ErrContainerClosed) {
+		t.Fatalf("resolve from a closed root: err = %v, want ErrContainerClosed", err)
+	}
+	if err := c.Close(); err != nil || len(log.keys) != 3 {
+		t.Fatalf("second Close = %v and closed %v; want nil and nothing closed again", err, log.keys)
+	}
+}
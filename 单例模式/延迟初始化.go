@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// 可失败的延迟初始化
+// sync.Once 只会执行一次初始化函数，初始化失败后实例永远拿不到；Lazy 在初始化成功之前，每次 Get 都会重新尝试。
+// 同一时刻只有一个 goroutine 在执行初始化，其他同时调用 Get 的 goroutine 等待并共享这一次的结果，
+// 不会在初始化失败时一起涌上去重试。初始化函数 panic 时转换为 ErrInitPanic 返回，Lazy 仍然可以继续重试。
+
+// ErrInitPanic 表示初始化函数发生了 panic
+var ErrInitPanic = errors.New("lazy init panicked")
+
+// Lazy 延迟创建类型为 T 的实例，零值不可用，需要通过 NewLazy 创建
+type Lazy[T any] struct {
+	init  func() (T, error)
+	value atomic.Pointer[T] // 初始化成功后不为 nil，读取不需要加锁
+
+	mu   sync.Mutex
+	call *lazyCall[T] // 正在执行的初始化
+}
+
+// lazyCall 是一次初始化尝试，等待者通过 done 获得结果
+type lazyCall[T any] struct {
+	done    chan struct{}
+	value   T
+	err     error
+	waiters int // 等待这次初始化的调用数，由 Lazy.mu 保护
+}
+
+func NewLazy[T any](init func() (T, error)) *Lazy[T] {
+	return &Lazy[T]{init: init}
+}
+
+// Get 返回实例，还没有初始化成功时执行初始化
+func (l *Lazy[T]) Get() (T, error) {
+	if v := l.value.Load(); v != nil {
+		return *v, nil
+	}
+
+	l.mu.Lock()
+	if v := l.value.Load(); v != nil {
+		l.mu.Unlock()
+		return *v, nil
+	}
+	if c := l.call; c != nil {
+		c.waiters++
+		l.mu.Unlock()
+		<-c.done
+		return c.value, c.err
+	}
+	c := &lazyCall[T]{done: make(chan struct{})}
+	l.call = c
+	l.mu.Unlock()
+
+	c.value, c.err = l.run()
+
+	l.mu.Lock()
+	// 初始化期间调用了 Reset 时，这次的结果只返回给等待者，不再保存
+	if l.call == c {
+		if c.err == nil {
+			v := c.value
+			l.value.Store(&v)
+		}
+		l.call = nil
+	}
+	l.mu.Unlock()
+	close(c.done)
+	return c.value, c.err
+}
+
+// run 执行初始化函数，把 panic 转换为错误
+func (l *Lazy[T]) run() (value T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var zero T
+			value, err = zero, fmt.Errorf("%w: %v", ErrInitPanic, r)
+		}
+	}()
+	return l.init()
+}
+
+// MustGet 返回实例，初始化失败时 panic，适合在程序启动时使用
+func (l *Lazy[T]) MustGet() T {
+	v, err := l.Get()
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Initialized 判断是否已经初始化成功
+func (l *Lazy[T]) Initialized() bool {
+	return l.value.Load() != nil
+}
+
+// Reset 丢弃已经创建的实例，下一次 Get 重新初始化，主要用于测试
+func (l *Lazy[T]) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.value.Store(nil)
+	l.call = nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const lazyGoroutines = 64
+
+type lazyResult struct {
+	value *int
+	err   error
+}
+
+// getConcurrently 让 lazyGoroutines 个 goroutine 同时调用 Get；init 进入后通过 entered 通知，然后被 release 挡住，
+// 等其余 goroutine 都在等待这一次初始化之后才放行，这样它们共享同一次初始化的结果
+func getConcurrently(l *Lazy[*int], entered, release chan struct{}) []lazyResult {
+	results := make([]lazyResult, lazyGoroutines)
+	var done sync.WaitGroup
+	for i := range results {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			v, err := l.Get()
+			results[i] = lazyResult{v, err}
+		}()
+	}
+	<-entered
+	waitForWaiters(l, lazyGoroutines-1)
+	close(release)
+	done.Wait()
+	return results
+}
+
+// waitForWaiters 等到正在进行的初始化有 n 个等待者
+func waitForWaiters(l *Lazy[*int], n int) {
+	for {
+		l.mu.Lock()
+		waiters := 0
+		if l.call != nil {
+			waiters = l.call.waiters
+		}
+		l.mu.Unlock()
+		if waiters >= n {
+			return
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestLazyConcurrentGetInitializesOnce(t *testing.T) {
+	var inits atomic.Int32
+	entered, release := make(chan struct{}), make(chan struct{})
+	l := NewLazy(func() (*int, error) {
+		entered <- struct{}{}
+		<-release
+		n := int(inits.Add(1))
+		return &n, nil
+	})
+
+	results := getConcurrently(l, entered, release)
+	if n := inits.Load(); n != 1 {
+		t.Fatalf("init ran %d times, want 1", n)
+	}
+	for i, r := range results {
+		if r.err != nil || r.value != results[0].value {
+			t.Fatalf("goroutine %d got %p, %v; want the shared instance %p", i, r.value, r.err, results[0].value)
+		}
+	}
+	if !l.Initialized() {
+		t.Fatal("Initialized = false after a successful Get")
+	}
+}
+
+func TestLazyFailureThenRetry(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	for _, tt := range []struct {
+		name string
+		fail func() (*int, error)
+		want error
+	}{
+		{"error", func() (*int, error) { return nil, errRefused }, errRefused},
+		{"panic", func() (*int, error) { panic("config not loaded") }, ErrInitPanic},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			entered := make(chan struct{})
+			releases := []chan struct{}{make(chan struct{}), make(chan struct{})}
+			l := NewLazy(func() (*int, error) {
+				n := int(attempts.Add(1))
+				entered <- struct{}{}
+				<-releases[n-1]
+				if n == 1 {
+					return tt.fail()
+				}
+				return &n, nil
+			})
+
+			// 第一次初始化失败，同时等待的调用共享这一次失败，不会各自重试
+			for i, r := range getConcurrently(l, entered, releases[0]) {
+				if !errors.Is(r.err, tt.want) || r.value != nil {
+					t.Fatalf("goroutine %d got %v, %v; want %v", i, r.value, r.err, tt.want)
+				}
+			}
+			if n := attempts.Load(); n != 1 {
+				t.Fatalf("after the failed round: %d attempts, want 1", n)
+			}
+			if l.Initialized() {
+				t.Fatal("Initialized = true after a failed init")
+			}
+
+			// 之后的调用重新初始化并成功
+			results := getConcurrently(l, entered, releases[1])
+			for i, r := range results {
+				if r.err != nil || r.value == nil || *r.value != 2 || r.value != results[0].value {
+					t.Fatalf("goroutine %d got %v, %v; want the instance from attempt 2", i, r.value, r.err)
+				}
+			}
+			if n := attempts.Load(); n != 2 {
+				t.Fatalf("after the retry: %d attempts, want 2", n)
+			}
+		})
+	}
+}
+
+func TestLazyResetDuringInit(t *testing.T) {
+	var inits atomic.Int32
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	l := NewLazy(func() (*int, error) {
+		n := int(inits.Add(1))
+		if n == 1 {
+			entered <- struct{}{}
+			<-release
+		}
+		return &n, nil
+	})
+
+	first := make(chan lazyResult, 1)
+	go func() {
+		v, err := l.Get()
+		first <- lazyResult{v, err}
+	}()
+	<-entered
+	l.Reset()
+	close(release)
+
+	// 被 Reset 的那次初始化结果仍然返回给调用方，但不会保存
+	r := <-first
+	if r.err != nil || *r.value != 1 {
+		t.Fatalf("in-flight Get = %v, %v; want instance 1", r.value, r.err)
+	}
+	if l.Initialized() {
+		t.Fatal("result of an init interrupted by Reset was stored")
+	}
+	if v := l.MustGet(); *v != 2 {
+		t.Fatalf("Get after Reset = %d, want a new instance 2", *v)
+	}
+}
+
+// TestLazyConcurrentReset 在 -race 下检查 Get、Reset 和 Initialized 同时调用没有数据竞争
+func TestLazyConcurrentReset(t *testing.T) {
+	var inits atomic.Int32
+	l := NewLazy(func() (*int, error) {
+		n := int(inits.Add(1))
+		if n%3 == 0 {
+			return nil, errors.New("flaky")
+		}
+		return &n, nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < lazyGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				switch {
+				case i%8 == 0 && j%10 == 0:
+					l.Reset()
+				case j%7 == 0:
+					l.Initialized()
+				default:
+					v, err := l.Get()
+					if (err == nil) == (v == nil) {
+						t.Errorf("Get = %v, %v; want exactly one of value and error", v, err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// 每三次初始化才失败一次，最多重试一次就能成功
+	if _, err := l.Get(); err != nil {
+		if _, err := l.Get(); err != nil {
+			t.Fatalf("Get failed twice in a row: %v", err)
+		}
+	}
+}
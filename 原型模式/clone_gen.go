@@ -0,0 +1,48 @@
+// Code generated by clonegen. DO NOT EDIT.
+
+package main
+
+// Clone 返回 Profile 的深拷贝
+func (p *Profile) Clone() Prototype {
+	out := new(Profile)
+	p.deepCopyInto(out)
+	return out
+}
+
+func (in *Job) deepCopyInto(out *Job) {
+	*out = *in
+	if in.Tags != nil {
+		out.Tags = make([]string, len(in.Tags))
+		copy(out.Tags, in.Tags)
+	}
+}
+
+func (in *Profile) deepCopyInto(out *Profile) {
+	*out = *in
+	if in.Skills != nil {
+		out.Skills = make([]string, len(in.Skills))
+		copy(out.Skills, in.Skills)
+	}
+	if in.Address != nil {
+		out.Address = new(Address)
+		*out.Address = *in.Address
+	}
+	if in.Contacts != nil {
+		out.Contacts = make(map[string][]string, len(in.Contacts))
+		for k0, v0 := range in.Contacts {
+			c0 := v0
+			if v0 != nil {
+				c0 = make([]string, len(v0))
+				copy(c0, v0)
+			}
+			out.Contacts[k0] = c0
+		}
+	}
+	if in.History != nil {
+		out.History = make([]Job, len(in.History))
+		for i0 := range in.History {
+			out.History[i0] = in.History[i0]
+			in.History[i0].deepCopyInto(&out.History[i0])
+		}
+	}
+}
@@ -0,0 +1,383 @@
+// clonegen 为带有标记注释的结构体生成深拷贝的 Clone 方法
+//
+// 在类型的文档注释中写上 //clonegen:deep，然后在包中加入：
+//
+//	//go:generate go run ./clonegen/clonegen.go -output clone_gen.go
+//
+// 生成的 Clone 会复制指针指向的值、切片和数组的元素、map 的键值，以及包内结构体类型的字段；
+// 其他包的类型（例如 time.Time）、接口、函数和通道按值复制。生成的代码不处理循环引用，
+// 有循环引用的对象请使用反射实现的 DeepClone。泛型结构体以及使用了包内泛型类型的字段会报错。
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Marker 是标记需要生成 Clone 的注释
+const Marker = "//clonegen:deep"
+
+func main() {
+	dir := flag.String("dir", ".", "directory of the package to scan")
+	output := flag.String("output", "clone_gen.go", "generated file name, relative to -dir")
+	iface := flag.String("iface", "Prototype", "return type of Clone; empty returns the concrete pointer type")
+	check := flag.Bool("check", false, "compare with the existing output instead of writing it, exit 1 when it differs")
+	flag.Parse()
+
+	src, err := Generate(*dir, *output, *iface)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "clonegen:", err)
+		os.Exit(2)
+	}
+	path := filepath.Join(*dir, *output)
+	if *check {
+		existing, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "clonegen:", err)
+			os.Exit(1)
+		}
+		if !bytes.Equal(existing, src) {
+			fmt.Fprintf(os.Stderr, "clonegen: %s is out of date, run go generate\n", path)
+			os.Exit(1)
+		}
+		fmt.Println("clonegen:", path, "is up to date")
+		return
+	}
+	if err := os.WriteFile(path, src, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, "clonegen:", err)
+		os.Exit(2)
+	}
+}
+
+// generator 保存一个包中的类型声明
+type generator struct {
+	pkg    string
+	specs  map[string]*ast.TypeSpec // 包内所有类型
+	marked []string                 // 带标记的类型，按名称排序
+	deep   map[string]bool          // 缓存：包内类型是否包含需要深拷贝的字段
+	buf    bytes.Buffer
+}
+
+// Generate 扫描 dir 中的包，返回生成文件的内容；output 文件本身和测试文件不参与扫描
+func Generate(dir, output, iface string) ([]byte, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	g := &generator{specs: map[string]*ast.TypeSpec{}, deep: map[string]bool{}}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if filepath.Base(file) == output || strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if g.pkg != "" && g.pkg != f.Name.Name {
+			return nil, fmt.Errorf("%s: package %s, want %s", file, f.Name.Name, g.pkg)
+		}
+		g.pkg = f.Name.Name
+		g.collect(f)
+	}
+	if g.pkg == "" {
+		return nil, fmt.Errorf("no Go files in %s", dir)
+	}
+	sort.Strings(g.marked)
+
+	g.printf("// Code generated by clonegen. DO NOT EDIT.\n\npackage %s\n", g.pkg)
+	for _, name := range g.marked {
+		if _, ok := g.specs[name].Type.(*ast.StructType); !ok {
+			return nil, fmt.Errorf("type %s is marked with %s but is not a struct", name, Marker)
+		}
+		ret := "*" + name
+		if iface != "" {
+			ret = iface
+		}
+		g.printf("\n// Clone 返回 %s 的深拷贝\n", name)
+		g.printf("func (p *%s) Clone() %s {\n", name, ret)
+		g.printf("out := new(%s)\np.deepCopyInto(out)\nreturn out\n}\n", name)
+	}
+	// 带标记的类型以及它们用到的包内结构体都需要 deepCopyInto
+	for _, name := range g.structsToCopy() {
+		if err := g.checkGeneric(name); err != nil {
+			return nil, err
+		}
+		if err := g.deepCopyInto(name); err != nil {
+			return nil, err
+		}
+	}
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w\n%s", err, g.buf.String())
+	}
+	return src, nil
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// collect 记录文件中的类型声明和带标记的类型
+func (g *generator) collect(f *ast.File) {
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			g.specs[ts.Name.Name] = ts
+			// 单独声明的类型注释在 GenDecl 上，分组声明的注释在 TypeSpec 上
+			doc := ts.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+			if hasMarker(doc) {
+				g.marked = append(g.marked, ts.Name.Name)
+			}
+		}
+	}
+}
+
+func hasMarker(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == Marker {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGeneric 拒绝泛型结构体，以及使用了包内泛型类型的字段：
+// 生成的代码不知道类型实参，直接按值复制又会悄悄共享数据
+func (g *generator) checkGeneric(name string) error {
+	ts := g.specs[name]
+	if ts.TypeParams != nil {
+		return fmt.Errorf("type %s has type parameters, generic types are not supported", name)
+	}
+	var err error
+	ast.Inspect(ts.Type, func(n ast.Node) bool {
+		var x ast.Expr
+		switch t := n.(type) {
+		case *ast.IndexExpr:
+			x = t.X
+		case *ast.IndexListExpr:
+			x = t.X
+		default:
+			return err == nil
+		}
+		if id, ok := x.(*ast.Ident); ok && g.specs[id.Name] != nil && err == nil {
+			err = fmt.Errorf("type %s uses generic type %s, generic types are not supported", name, types.ExprString(n.(ast.Expr)))
+		}
+		return false
+	})
+	return err
+}
+
+// localStruct 返回包内结构体类型的名称，expr 不是包内结构体时返回空字符串
+func (g *generator) localStruct(expr ast.Expr) string {
+	if id, ok := expr.(*ast.Ident); ok {
+		if ts, ok := g.specs[id.Name]; ok {
+			if _, ok := ts.Type.(*ast.StructType); ok {
+				return id.Name
+			}
+		}
+	}
+	return ""
+}
+
+// structsToCopy 返回需要生成 deepCopyInto 的结构体，按名称排序
+func (g *generator) structsToCopy() []string {
+	seen := map[string]bool{}    // 需要生成的结构体
+	visited := map[string]bool{} // 已经检查过的包内类型
+	var visit func(expr ast.Expr)
+	visit = func(expr ast.Expr) {
+		switch t := expr.(type) {
+		case *ast.Ident:
+			ts, ok := g.specs[t.Name]
+			if !ok || visited[t.Name] || !g.needsDeep(t) {
+				return
+			}
+			visited[t.Name] = true
+			if st, ok := ts.Type.(*ast.StructType); ok {
+				seen[t.Name] = true
+				for _, field := range st.Fields.List {
+					visit(field.Type)
+				}
+				return
+			}
+			visit(ts.Type)
+		case *ast.StarExpr:
+			visit(t.X)
+		case *ast.ArrayType:
+			visit(t.Elt)
+		case *ast.MapType:
+			visit(t.Key)
+			visit(t.Value)
+		}
+	}
+	for _, name := range g.marked {
+		// 带标记的类型即使没有引用字段也要生成，Clone 会调用它
+		seen[name], visited[name] = true, true
+		for _, field := range g.specs[name].Type.(*ast.StructType).Fields.List {
+			visit(field.Type)
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// needsDeep 判断类型的值是否引用了需要深拷贝的数据，不需要时直接赋值即可
+func (g *generator) needsDeep(expr ast.Expr) bool {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		ts, ok := g.specs[t.Name]
+		if !ok {
+			return false // 预声明类型
+		}
+		if deep, ok := g.deep[t.Name]; ok {
+			return deep
+		}
+		// 先假设不需要，避免递归类型无限递归；递归只能经过指针、切片或 map，它们本身就需要深拷贝
+		g.deep[t.Name] = false
+		deep := g.needsDeep(ts.Type)
+		g.deep[t.Name] = deep
+		return deep
+	case *ast.StructType:
+		for _, field := range t.Fields.List {
+			if g.needsDeep(field.Type) {
+				return true
+			}
+		}
+		return false
+	case *ast.StarExpr, *ast.MapType:
+		return true
+	case *ast.ArrayType:
+		return t.Len == nil || g.needsDeep(t.Elt)
+	}
+	// 其他包的类型、接口、函数和通道按值复制
+	return false
+}
+
+// deepCopyInto 生成结构体的 deepCopyInto 方法
+func (g *generator) deepCopyInto(name string) error {
+	st := g.specs[name].Type.(*ast.StructType)
+	g.printf("\nfunc (in *%s) deepCopyInto(out *%s) {\n*out = *in\n", name, name)
+	for _, field := range st.Fields.List {
+		if !g.needsDeep(field.Type) {
+			continue
+		}
+		names := field.Names
+		if len(names) == 0 {
+			// 嵌入字段的字段名是类型名
+			names = []*ast.Ident{ast.NewIdent(embeddedName(field.Type))}
+		}
+		for _, n := range names {
+			if err := g.copyValue("out."+n.Name, "in."+n.Name, field.Type, 0); err != nil {
+				return fmt.Errorf("%s.%s: %w", name, n.Name, err)
+			}
+		}
+	}
+	g.printf("}\n")
+	return nil
+}
+
+func embeddedName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	}
+	return types.ExprString(expr)
+}
+
+// copyValue 生成把 src 深拷贝到 dst 的语句，dst 已经持有 src 的浅拷贝
+func (g *generator) copyValue(dst, src string, expr ast.Expr, depth int) error {
+	if !g.needsDeep(expr) {
+		return nil
+	}
+	typ := types.ExprString(expr)
+	if name := g.localStruct(expr); name != "" {
+		g.printf("%s.deepCopyInto(&%s)\n", src, dst)
+		return nil
+	}
+	under := expr
+	if id, ok := expr.(*ast.Ident); ok {
+		under = g.specs[id.Name].Type
+	}
+	i, k, v := fmt.Sprintf("i%d", depth), fmt.Sprintf("k%d", depth), fmt.Sprintf("v%d", depth)
+	switch t := under.(type) {
+	case *ast.StarExpr:
+		g.printf("if %s != nil {\n", src)
+		if name := g.localStruct(t.X); name != "" && g.needsDeep(t.X) {
+			g.printf("%s = new(%s)\n%s.deepCopyInto(%s)\n", dst, name, src, dst)
+		} else {
+			g.printf("%s = new(%s)\n*%s = *%s\n", dst, types.ExprString(t.X), dst, src)
+			if err := g.copyValue("(*"+dst+")", "(*"+src+")", t.X, depth+1); err != nil {
+				return err
+			}
+		}
+		g.printf("}\n")
+	case *ast.ArrayType:
+		if t.Len == nil {
+			g.printf("if %s != nil {\n%s = make(%s, len(%s))\n", src, dst, typ, src)
+			if g.needsDeep(t.Elt) {
+				g.printf("for %s := range %s {\n%s[%s] = %s[%s]\n", i, src, dst, i, src, i)
+				if err := g.copyValue(dst+"["+i+"]", src+"["+i+"]", t.Elt, depth+1); err != nil {
+					return err
+				}
+				g.printf("}\n")
+			} else {
+				g.printf("copy(%s, %s)\n", dst, src)
+			}
+			g.printf("}\n")
+			return nil
+		}
+		g.printf("for %s := range %s {\n", i, src)
+		if err := g.copyValue(dst+"["+i+"]", src+"["+i+"]", t.Elt, depth+1); err != nil {
+			return err
+		}
+		g.printf("}\n")
+	case *ast.MapType:
+		g.printf("if %s != nil {\n%s = make(%s, len(%s))\n", src, dst, typ, src)
+		g.printf("for %s, %s := range %s {\n", k, v, src)
+		if g.needsDeep(t.Key) {
+			return fmt.Errorf("map key type %s contains references", types.ExprString(t.Key))
+		}
+		if g.needsDeep(t.Value) {
+			c := fmt.Sprintf("c%d", depth)
+			g.printf("%s := %s\n", c, v)
+			if err := g.copyValue(c, v, t.Value, depth+1); err != nil {
+				return err
+			}
+			g.printf("%s[%s] = %s\n", dst, k, c)
+		} else {
+			g.printf("%s[%s] = %s\n", dst, k, v)
+		}
+		g.printf("}\n}\n")
+	default:
+		return fmt.Errorf("unsupported type %s", typ)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+func TestGenerateGolden(t *testing.T) {
+	got, err := Generate("testdata/sample", "sample_clone.go", "Prototype")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "sample", "sample_clone.go.golden")
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("generated code differs from %s (run go test -update to rewrite it):\n%s", golden, got)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "marked non-struct",
+			src: `package p
+
+//clonegen:deep
+type Names []string
+`,
+			want: "type Names is marked with //clonegen:deep but is not a struct",
+		},
+		{
+			name: "marked generic struct",
+			src: `package p
+
+//clonegen:deep
+type Box[T any] struct {
+	Items []T
+}
+`,
+			want: "type Box has type parameters",
+		},
+		{
+			name: "field of a local generic type",
+			src: `package p
+
+type Box[T any] struct {
+	Items []T
+}
+
+//clonegen:deep
+type Holder struct {
+	Box Box[int]
+}
+`,
+			want: "type Holder uses generic type Box[int]",
+		},
+		{
+			name: "pointer to a local generic type with two parameters",
+			src: `package p
+
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value []V
+}
+
+//clonegen:deep
+type Holder struct {
+	Pair *Pair[string, int]
+}
+`,
+			want: "type Holder uses generic type Pair[string, int]",
+		},
+		{
+			name: "map key with references",
+			src: `package p
+
+//clonegen:deep
+type Index struct {
+	ByKey map[*int]string
+}
+`,
+			want: "Index.ByKey: map key type *int contains references",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "p.go"), []byte(tt.src), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Generate(dir, "p_clone.go", "")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Generate error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package sample
+
+import "time"
+
+type Prototype interface {
+	Clone() Prototype
+}
+
+// Address 没有引用类型的字段，按值复制即可
+type Address struct {
+	City   string
+	Street string
+}
+
+// Tags 是包内的命名切片类型
+type Tags []string
+
+// Skill 带有需要深拷贝的字段，但本身没有标记
+type Skill struct {
+	Name  string
+	Notes []string
+}
+
+// Employee 覆盖生成器支持的各种字段
+//
+//clonegen:deep
+type Employee struct {
+	Name     string
+	Age      int
+	Born     time.Time
+	Home     *Address
+	Work     Address
+	Tags     Tags
+	Skills   []Skill
+	Mentor   *Employee
+	Scores   map[string][]int
+	Reports  map[string]*Employee
+	Matrix   [2][]float64
+	Manager  *Skill
+	Extra    any
+	OnChange func()
+	private  *int
+}
+
+type (
+	// Team 在分组声明中也可以标记
+	//
+	//clonegen:deep
+	Team struct {
+		Lead    Employee
+		Members []*Employee
+	}
+
+	// Unmarked 不会生成 Clone
+	Unmarked struct {
+		Data []byte
+	}
+)
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"sync"
 	"time"
 )
 
@@ -52,11 +53,8 @@ func (p *ConcretePrototype) SetAge(age int) {
 }
 
 func (p *ConcretePrototype) Clone() Prototype {
-	// 创建一个新的实例，并复制当前对象的属性
-	return &ConcretePrototype{
-		Name: p.Name,
-		Age:  p.Age,
-	}
+	// 创建一个新的实例，并深拷贝当前对象的属性，新增字段时不需要修改这里
+	return DeepClone(p)
 }
 
 func main() {
@@ -64,7 +62,8 @@ func main() {
 	t1 := time.Now()
 	prototype := NewConcretePrototype("John", 30)
 	t2 := time.Now()
-	fmt.Println("Time taken to create prototype:", t2.Sub(t1))
+	construct := t2.Sub(t1)
+	fmt.Println("Time taken to create prototype:", construct)
 
 	// 克隆原型对象
 	t1 = time.Now()
@@ -79,4 +78,130 @@ func main() {
 	// 打印原型对象和克隆对象的属性
 	fmt.Println("Original Prototype:", prototype.Name, prototype.Age)
 	fmt.Println("Cloned Prototype:", clonedPrototype.(*ConcretePrototype).Name, clonedPrototype.(*ConcretePrototype).Age)
+	fmt.Println("")
+
+	registryDemo(prototype, construct)
+	fmt.Println("")
+
+	deepCloneDemo()
+	fmt.Println("")
+
+	generatedCloneDemo()
+}
+
+// generatedCloneDemo 检查生成的 Clone 没有共享数据，并和反射实现的 DeepClone 对比耗时
+func generatedCloneDemo() {
+	profile := &Profile{
+		Name:     "John",
+		Age:      30,
+		Skills:   []string{"go", "sql"},
+		Address:  &Address{City: "Shanghai"},
+		Contacts: map[string][]string{"email": {"john@example.com"}},
+		History:  []Job{{Company: "acme", Tags: []string{"backend"}}},
+	}
+	var prototype Prototype = profile
+	clone := prototype.Clone().(*Profile)
+	fmt.Println("generated clone aliases:", FindAliases(profile, clone))
+	clone.History[0].Tags[0] = "frontend"
+	fmt.Println("original job tags:", profile.History[0].Tags, "clone:", clone.History[0].Tags)
+
+	const n = 10000
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		profile.Clone()
+	}
+	generated := time.Since(start)
+	start = time.Now()
+	for i := 0; i < n; i++ {
+		DeepClone(profile)
+	}
+	reflected := time.Since(start)
+	fmt.Printf("%d clones: generated %v/op, reflection %v/op\n", n, generated/n, reflected/n)
+}
+
+// registryDemo 对比从注册表克隆和重新构造的耗时，construct 是上面 NewConcretePrototype 的耗时
+func registryDemo(prototype *ConcretePrototype, construct time.Duration) {
+	registry := NewPrototypeRegistry()
+	if err := registry.Register("employee", prototype); err != nil {
+		fmt.Println("register:", err)
+		return
+	}
+	prototype.SetName("changed after register") // 不影响注册表中的原型
+
+	const n = 10000
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		registry.Create("employee", WithAge(i))
+	}
+	elapsed := time.Since(start)
+	fmt.Printf("registry: %d clones in %v (%v/op), fresh construction ~%v/op, %v for %d\n",
+		n, elapsed, elapsed/n, construct, construct*n, n)
+
+	// 多个 goroutine 同时登记和克隆
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("intern-%d", i)
+			if err := registry.Register(name, &ConcretePrototype{Name: name, Age: 20 + i}); err != nil {
+				fmt.Println("register:", err)
+				return
+			}
+			for j := 0; j < 100; j++ {
+				registry.Create("employee")
+			}
+		}()
+	}
+	wg.Wait()
+	fmt.Println("prototypes:", registry.Names())
+
+	jane, err := CreateAs(registry, "employee", func(p *ConcretePrototype) { p.Name = "Jane" })
+	fmt.Println("typed create:", jane.Name, jane.Age, err)
+	_, err = registry.Create("manager")
+	fmt.Println("unknown:", err)
+	fmt.Println("duplicate:", registry.Register("employee", prototype))
+	var missing *ConcretePrototype
+	fmt.Println("nil:", registry.Register("missing", missing))
+}
+
+// Team 包含嵌套结构体、指针、切片、map、接口、未导出字段和循环引用
+type Team struct {
+	Name    string
+	Lead    *Member
+	Members []*Member
+	Tags    map[string][]string
+	Extra   any
+	Founded time.Time
+	budget  *int
+}
+
+type Member struct {
+	Name  string
+	Team  *Team // 指回所属团队，形成循环
+	Stats [2]map[string]int
+}
+
+func deepCloneDemo() {
+	budget := 1000
+	team := &Team{Name: "core", Tags: map[string][]string{"lang": {"go"}}, Extra: []int{1, 2}, Founded: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), budget: &budget}
+	alice := &Member{Name: "alice", Team: team, Stats: [2]map[string]int{{"commits": 10}, nil}}
+	bob := &Member{Name: "bob", Team: team}
+	team.Lead, team.Members = alice, []*Member{alice, bob}
+
+	clone := DeepClone(team)
+	fmt.Println("cycle kept:", clone.Lead.Team == clone, "lead shared with members:", clone.Lead == clone.Members[0])
+
+	// 修改克隆对象不影响原对象
+	clone.Lead.Name = "carol"
+	clone.Tags["lang"][0] = "rust"
+	clone.Extra.([]int)[0] = 99
+	clone.Members[1].Stats[0] = map[string]int{"reviews": 3}
+	fmt.Println("original:", team.Lead.Name, team.Tags, team.Extra, bob.Stats[0] == nil)
+	fmt.Println("clone:   ", clone.Lead.Name, clone.Tags, clone.Extra, clone.Members[1].Stats[0])
+
+	// 未导出字段默认按值复制，指针仍然共享；开启 WithUnexported 后同样深拷贝
+	fmt.Println("aliases with unexported fields:", FindAliases(team, clone))
+	deep := DeepClone(team, WithUnexported())
+	fmt.Println("aliases with WithUnexported:", FindAliases(team, deep), *deep.budget)
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// 原型注册表
+// 初始化代价高的对象只创建一次，登记为原型，之后需要新对象时从原型克隆，
+// 再通过定制函数修改克隆对象上需要不同的字段。注册表可以被多个 goroutine 同时使用。
+
+var (
+	// ErrUnknownPrototype 表示没有登记该名称的原型
+	ErrUnknownPrototype = errors.New("unknown prototype")
+	// ErrPrototypeExists 表示该名称已经登记过原型
+	ErrPrototypeExists = errors.New("prototype already registered")
+	// ErrNilPrototype 表示登记的原型是 nil，包括保存了 nil 指针的接口
+	ErrNilPrototype = errors.New("nil prototype")
+)
+
+// Customizer 在克隆之后修改克隆对象
+type Customizer func(p Prototype)
+
+type PrototypeRegistry struct {
+	mu         sync.RWMutex
+	prototypes map[string]Prototype
+}
+
+func NewPrototypeRegistry() *PrototypeRegistry {
+	return &PrototypeRegistry{prototypes: map[string]Prototype{}}
+}
+
+// Register 登记原型；保存的是 p 的克隆，之后修改 p 不会影响注册表
+func (r *PrototypeRegistry) Register(name string, p Prototype) error {
+	if isNil(p) {
+		return fmt.Errorf("%w: %q", ErrNilPrototype, name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.prototypes[name]; ok {
+		return fmt.Errorf("%w: %q", ErrPrototypeExists, name)
+	}
+	r.prototypes[name] = p.Clone()
+	return nil
+}
+
+// Replace 登记原型，已经存在时替换
+func (r *PrototypeRegistry) Replace(name string, p Prototype) error {
+	if isNil(p) {
+		return fmt.Errorf("%w: %q", ErrNilPrototype, name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prototypes[name] = p.Clone()
+	return nil
+}
+
+// isNil 判断 p 是否为 nil；(*ConcretePrototype)(nil) 这样的接口不等于 nil，但克隆时同样会出错
+func isNil(p Prototype) bool {
+	if p == nil {
+		return true
+	}
+	switch v := reflect.ValueOf(p); v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// Unregister 删除原型
+func (r *PrototypeRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.prototypes, name)
+}
+
+// Names 按字母顺序返回所有原型的名称
+func (r *PrototypeRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.prototypes))
+	for name := range r.prototypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Create 克隆名为 name 的原型，再依次执行定制函数
+func (r *PrototypeRegistry) Create(name string, customizers ...Customizer) (Prototype, error) {
+	r.mu.RLock()
+	p, ok := r.prototypes[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPrototype, name)
+	}
+	clone := p.Clone()
+	for _, customize := range customizers {
+		customize(clone)
+	}
+	return clone, nil
+}
+
+// CreateAs 克隆原型并转换为具体类型，定制函数直接使用具体类型
+func CreateAs[T Prototype](r *PrototypeRegistry, name string, customizers ...func(p T)) (T, error) {
+	var zero T
+	p, err := r.Create(name)
+	if err != nil {
+		return zero, err
+	}
+	t, ok := p.(T)
+	if !ok {
+		return zero, fmt.Errorf("prototype %q is %T, not %T", name, p, zero)
+	}
+	for _, customize := range customizers {
+		customize(t)
+	}
+	return t, nil
+}
+
+// WithName 返回设置名称的定制函数
+func WithName(name string) Customizer {
+	return func(p Prototype) { p.SetName(name) }
+}
+
+// WithAge 返回设置年龄的定制函数
+func WithAge(age int) Customizer {
+	return func(p Prototype) { p.SetAge(age) }
+}
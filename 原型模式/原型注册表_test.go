@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegistryRejectsNil(t *testing.T) {
+	r := NewPrototypeRegistry()
+	var typed *ConcretePrototype
+	for _, p := range []Prototype{nil, typed} {
+		if err := r.Register("employee", p); !errors.Is(err, ErrNilPrototype) {
+			t.Errorf("Register(%#v) error = %v, want ErrNilPrototype", p, err)
+		}
+		if err := r.Replace("employee", p); !errors.Is(err, ErrNilPrototype) {
+			t.Errorf("Replace(%#v) error = %v, want ErrNilPrototype", p, err)
+		}
+	}
+	if names := r.Names(); len(names) != 0 {
+		t.Fatalf("Names = %v after rejected registrations, want none", names)
+	}
+}
+
+func TestRegistryCreate(t *testing.T) {
+	r := NewPrototypeRegistry()
+	prototype := &ConcretePrototype{Name: "employee", Age: 30}
+	if err := r.Register("employee", prototype); err != nil {
+		t.Fatal(err)
+	}
+	prototype.SetName("changed")
+	if err := r.Register("employee", prototype); !errors.Is(err, ErrPrototypeExists) {
+		t.Fatalf("duplicate Register error = %v, want ErrPrototypeExists", err)
+	}
+
+	p, err := CreateAs(r, "employee", func(p *ConcretePrototype) { p.Age++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "employee" || p.Age != 31 {
+		t.Fatalf("Create = %+v, want the registered prototype with the customizer applied", p)
+	}
+	if _, err := r.Create("manager"); !errors.Is(err, ErrUnknownPrototype) {
+		t.Fatalf("Create unknown error = %v, want ErrUnknownPrototype", err)
+	}
+}
+
+func BenchmarkRegistryCreate(b *testing.B) {
+	r := NewPrototypeRegistry()
+	if err := r.Register("employee", &ConcretePrototype{Name: "employee", Age: 30}); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := r.Create("employee", WithAge(31)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkNewConcretePrototype 是不使用原型时的对照，每次构造都要完整初始化
+func BenchmarkNewConcretePrototype(b *testing.B) {
+	for b.Loop() {
+		NewConcretePrototype("employee", 30)
+	}
+}
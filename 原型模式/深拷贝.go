@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+	"unsafe"
+)
+
+// 深拷贝
+// 手写 Clone 只复制了字段本身，指针、切片、map 指向的数据仍然和原对象共享，修改克隆对象会影响原对象。
+// DeepClone 通过反射递归复制：指针指向的值、切片和数组的元素、map 的键值、接口中的动态值都会复制一份，
+// 同一个指针（或切片、map）在原对象中出现多次时，克隆对象中也只复制一次，因此循环引用不会无限递归，共享关系也保持不变。
+// 未导出字段默认按值复制（和赋值语句一样），WithUnexported 开启后同样深拷贝。
+// 通道和函数无法复制，按原值保留；time.Time 这类值语义的类型按值复制，可以用 WithShallowType 添加更多这样的类型。
+
+// CloneOption 用于设置深拷贝的可选项
+type CloneOption func(c *cloner)
+
+// WithUnexported 深拷贝未导出字段
+func WithUnexported() CloneOption {
+	return func(c *cloner) {
+		c.unexported = true
+	}
+}
+
+// WithShallowType 指定按值复制、不再深入的类型
+func WithShallowType(t reflect.Type) CloneOption {
+	return func(c *cloner) {
+		c.shallow[t] = true
+	}
+}
+
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int // 切片的长度，同一个底层数组上不同长度的切片是不同的值
+}
+
+type cloner struct {
+	unexported bool
+	shallow    map[reflect.Type]bool
+	seen       map[visit]reflect.Value
+}
+
+// DeepClone 返回 v 的深拷贝
+func DeepClone[T any](v T, opts ...CloneOption) T {
+	c := &cloner{
+		shallow: map[reflect.Type]bool{reflect.TypeFor[time.Time](): true},
+		seen:    map[visit]reflect.Value{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	var out T
+	c.copy(reflect.ValueOf(&out).Elem(), reflect.ValueOf(&v).Elem())
+	return out
+}
+
+// copy 把 src 深拷贝到 dst，dst 必须可以设置
+func (c *cloner) copy(dst, src reflect.Value) {
+	if c.shallow[src.Type()] {
+		dst.Set(src)
+		return
+	}
+	switch src.Kind() {
+	case reflect.Pointer:
+		if src.IsNil() {
+			return
+		}
+		key := visit{ptr: src.Pointer(), typ: src.Type()}
+		if p, ok := c.seen[key]; ok {
+			dst.Set(p)
+			return
+		}
+		p := reflect.New(src.Type().Elem())
+		c.seen[key] = p
+		c.copy(p.Elem(), src.Elem())
+		dst.Set(p)
+
+	case reflect.Struct:
+		// 先整体复制，未导出字段因此按值保留，再逐个深拷贝字段
+		dst.Set(src)
+		if !src.CanAddr() {
+			tmp := reflect.New(src.Type()).Elem()
+			tmp.Set(src)
+			src = tmp
+		}
+		for i := 0; i < src.NumField(); i++ {
+			df, sf := dst.Field(i), src.Field(i)
+			if !src.Type().Field(i).IsExported() {
+				if !c.unexported {
+					continue
+				}
+				df = reflect.NewAt(df.Type(), unsafe.Pointer(df.UnsafeAddr())).Elem()
+				sf = reflect.NewAt(sf.Type(), unsafe.Pointer(sf.UnsafeAddr())).Elem()
+			}
+			c.copy(df, sf)
+		}
+
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		key := visit{ptr: src.Pointer(), typ: src.Type(), len: src.Len()}
+		if s, ok := c.seen[key]; ok {
+			dst.Set(s)
+			return
+		}
+		s := reflect.MakeSlice(src.Type(), src.Len(), src.Cap())
+		c.seen[key] = s
+		for i := 0; i < src.Len(); i++ {
+			c.copy(s.Index(i), src.Index(i))
+		}
+		dst.Set(s)
+
+	case reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			c.copy(dst.Index(i), src.Index(i))
+		}
+
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		key := visit{ptr: src.Pointer(), typ: src.Type()}
+		if m, ok := c.seen[key]; ok {
+			dst.Set(m)
+			return
+		}
+		m := reflect.MakeMapWithSize(src.Type(), src.Len())
+		c.seen[key] = m
+		iter := src.MapRange()
+		for iter.Next() {
+			k := reflect.New(src.Type().Key()).Elem()
+			c.copy(k, iter.Key())
+			v := reflect.New(src.Type().Elem()).Elem()
+			c.copy(v, iter.Value())
+			m.SetMapIndex(k, v)
+		}
+		dst.Set(m)
+
+	case reflect.Interface:
+		if src.IsNil() {
+			return
+		}
+		elem := src.Elem()
+		v := reflect.New(elem.Type()).Elem()
+		c.copy(v, elem)
+		dst.Set(v)
+
+	default:
+		// 基本类型按值复制；通道、函数和 unsafe.Pointer 无法复制，保留原值
+		dst.Set(src)
+	}
+}
+
+// FindAliases 返回 a 和 b 中指向同一块内存的指针、切片和 map 所在的路径（以 b 中的路径表示），
+// 用于检查深拷贝之后是否还有共享的数据；未导出字段也会检查
+func FindAliases(a, b any) []string {
+	refs := map[visit]bool{}
+	walkRefs(reflect.ValueOf(a), "", map[visit]bool{}, func(key visit, path string) {
+		refs[key] = true
+	})
+	var aliases []string
+	walkRefs(reflect.ValueOf(b), "", map[visit]bool{}, func(key visit, path string) {
+		if refs[key] {
+			aliases = append(aliases, path)
+		}
+	})
+	return aliases
+}
+
+// walkRefs 遍历 v 中的所有引用，对每个非空的指针、切片和 map 调用 fn
+func walkRefs(v reflect.Value, path string, visited map[visit]bool, fn func(key visit, path string)) {
+	if !v.IsValid() {
+		return
+	}
+	ref := func() bool {
+		key := visit{ptr: v.Pointer(), typ: v.Type()}
+		if v.Kind() == reflect.Slice {
+			key.len = v.Len()
+		}
+		fn(key, path)
+		if visited[key] {
+			return false
+		}
+		visited[key] = true
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() && ref() {
+			walkRefs(v.Elem(), path, visited, fn)
+		}
+	case reflect.Interface:
+		walkRefs(v.Elem(), path, visited, fn)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			walkRefs(v.Field(i), path+"."+v.Type().Field(i).Name, visited, fn)
+		}
+	case reflect.Slice:
+		// 空切片没有可以共享的元素
+		if v.Len() > 0 && ref() {
+			for i := 0; i < v.Len(); i++ {
+				walkRefs(v.Index(i), fmt.Sprintf("%s[%d]", path, i), visited, fn)
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkRefs(v.Index(i), fmt.Sprintf("%s[%d]", path, i), visited, fn)
+		}
+	case reflect.Map:
+		if !v.IsNil() && ref() {
+			iter := v.MapRange()
+			for iter.Next() {
+				walkRefs(iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key()), visited, fn)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+type cloneNode struct {
+	Name string
+	Next *cloneNode
+	Tags []string
+}
+
+type hidden struct {
+	Public  []int
+	private *int
+	items   map[string][]int
+}
+
+func TestDeepCloneHasNoAliases(t *testing.T) {
+	n := 1
+	tests := []struct {
+		name string
+		v    any
+	}{
+		{"pointer", &n},
+		{"slice", []*int{&n, &n}},
+		{"map", map[string][]int{"a": {1, 2}, "b": {3}}},
+		{"interface", []any{&n, map[string]int{"a": 1}, []string{"x"}}},
+		{"array of maps", [2]map[string]*int{{"a": &n}, {"b": &n}}},
+		{"struct", &Profile{
+			Name:     "张三",
+			Address:  &Address{City: "北京"},
+			Skills:   []string{"Go"},
+			Contacts: map[string][]string{"email": {"a@example.com"}},
+			History:  []Job{{Company: "acme", Tags: []string{"backend"}}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clone := DeepClone(tt.v)
+			if !reflect.DeepEqual(tt.v, clone) {
+				t.Fatalf("DeepClone(%v) = %v, want an equal value", tt.v, clone)
+			}
+			if aliases := FindAliases(tt.v, clone); len(aliases) > 0 {
+				t.Fatalf("clone shares %v with the original", aliases)
+			}
+		})
+	}
+}
+
+func TestDeepCloneUnexported(t *testing.T) {
+	n := 1
+	v := &hidden{Public: []int{1}, private: &n, items: map[string][]int{"a": {1}}}
+
+	clone := DeepClone(v, WithUnexported())
+	if aliases := FindAliases(v, clone); len(aliases) > 0 {
+		t.Fatalf("WithUnexported: clone shares %v with the original", aliases)
+	}
+	if *clone.private != 1 || clone.items["a"][0] != 1 {
+		t.Fatalf("WithUnexported: unexported fields not copied: %+v", clone)
+	}
+
+	// 默认按值复制未导出字段，指针仍然共享
+	clone = DeepClone(v)
+	if clone.private != v.private {
+		t.Fatal("without WithUnexported the unexported pointer was copied")
+	}
+	if aliases := FindAliases(v, clone); !reflect.DeepEqual(aliases, []string{".private", ".items", ".items[a]"}) {
+		t.Fatalf("without WithUnexported: aliases = %v, want [.private .items .items[a]]", aliases)
+	}
+}
+
+func TestDeepCloneCycle(t *testing.T) {
+	a := &cloneNode{Name: "a", Tags: []string{"x"}}
+	b := &cloneNode{Name: "b", Next: a}
+	a.Next = b
+
+	clone := DeepClone(a)
+	if aliases := FindAliases(a, clone); len(aliases) > 0 {
+		t.Fatalf("clone shares %v with the original", aliases)
+	}
+	if clone.Next.Next != clone {
+		t.Fatal("cycle not preserved in the clone")
+	}
+	if clone.Name != "a" || clone.Next.Name != "b" || clone.Tags[0] != "x" {
+		t.Fatalf("clone = %+v, want the same values", clone)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+//go:generate go run ./clonegen/clonegen.go -output clone_gen.go
+
+// Profile 的 Clone 由 clonegen 生成（见 clone_gen.go），新增字段后重新执行 go generate 即可
+//
+//clonegen:deep
+type Profile struct {
+	Name     string
+	Age      int
+	Skills   []string
+	Address  *Address
+	Contacts map[string][]string
+	History  []Job
+}
+
+type Address struct {
+	City   string
+	Street string
+}
+
+type Job struct {
+	Company string
+	Tags    []string
+}
+
+func (p *Profile) GetName() string {
+	return p.Name
+}
+
+func (p *Profile) GetAge() int {
+	return p.Age
+}
+
+func (p *Profile) SetName(name string) {
+	p.Name = name
+}
+
+func (p *Profile) SetAge(age int) {
+	p.Age = age
+}
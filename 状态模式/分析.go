@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// 静态分析
+// 在运行之前检查转换表中的常见问题：从初始状态到达不了的状态、没有出边又不是终止状态的死胡同、
+// 同一个状态同一个事件的多条转换（前一条没有守卫时后一条永远不会生效，都有守卫时守卫可能重叠），
+// 以及应用从来不会触发的事件。
+// CheckDefinition 只返回错误级别的问题，可以直接在测试里调用：if err := CheckDefinition(d, nil); err != nil { t.Fatal(err) }
+
+// Severity 是问题的严重程度
+type Severity int
+
+const (
+	SeverityWarning Severity = iota
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// FindingKind 是问题的类别
+type FindingKind string
+
+const (
+	FindingUnreachable      FindingKind = "unreachable"
+	FindingDeadEnd          FindingKind = "dead-end"
+	FindingShadowed         FindingKind = "shadowed"
+	FindingNondeterministic FindingKind = "nondeterministic"
+	FindingUnusedEvent      FindingKind = "unused-event"
+)
+
+// Finding 是分析发现的一个问题
+type Finding struct {
+	Severity Severity
+	Kind     FindingKind
+	State    string
+	Event    string
+	Message  string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Severity, f.Kind, f.Message)
+}
+
+// AnalyzeOptions 是分析的可选输入
+type AnalyzeOptions struct {
+	// Fired 是应用实际会触发的事件，例如从代码中收集或从审计日志中统计；为 nil 时不检查未使用的事件
+	Fired []string
+}
+
+// Analyze 分析状态机定义，按严重程度、类别、状态和事件排序返回所有问题
+// 定义本身不完整（Validate 失败）时返回错误
+func Analyze(d *Definition, opts *AnalyzeOptions) ([]Finding, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &AnalyzeOptions{}
+	}
+	var findings []Finding
+	reachable := d.reachable()
+
+	for _, name := range d.order {
+		if !reachable[name] {
+			findings = append(findings, Finding{
+				Severity: SeverityError, Kind: FindingUnreachable, State: name,
+				Message: fmt.Sprintf("state %q cannot be reached from initial state %q", name, d.Initial),
+			})
+		}
+	}
+
+	for _, name := range d.order {
+		s := d.States[name]
+		if s.Final || d.IsComposite(name) || !reachable[name] {
+			continue
+		}
+		// 事件会冒泡到父状态，所以祖先上的出边也算
+		if !d.hasOutgoing(name) {
+			findings = append(findings, Finding{
+				Severity: SeverityError, Kind: FindingDeadEnd, State: name,
+				Message: fmt.Sprintf("state %q has no outgoing transitions and is not final", name),
+			})
+		}
+	}
+
+	findings = append(findings, d.ambiguities()...)
+
+	if opts.Fired != nil {
+		fired := map[string]bool{}
+		for _, e := range opts.Fired {
+			fired[e] = true
+		}
+		for _, e := range d.Events() {
+			if fired[e] || d.isTimedEvent(e) {
+				continue
+			}
+			findings = append(findings, Finding{
+				Severity: SeverityWarning, Kind: FindingUnusedEvent, Event: e,
+				Message: fmt.Sprintf("event %q is never fired", e),
+			})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Severity != b.Severity {
+			return a.Severity > b.Severity
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.State != b.State {
+			return a.State < b.State
+		}
+		return a.Event < b.Event
+	})
+	return findings, nil
+}
+
+// reachable 从初始状态出发计算可以激活的状态
+// 进入一个状态时它的祖先同时激活，进入复合状态时继续进入初始子状态；
+// 历史只会回到之前激活过的子状态，不会让新的状态变得可达
+func (d *Definition) reachable() map[string]bool {
+	seen := map[string]bool{}
+	var queue []string
+	var activate func(name string)
+	activate = func(name string) {
+		for _, s := range d.Ancestors(name) {
+			if !seen[s] {
+				seen[s] = true
+				queue = append(queue, s)
+			}
+		}
+		if d.IsComposite(name) {
+			activate(d.States[name].Initial)
+		}
+	}
+	activate(d.Initial)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, t := range d.Transitions {
+			if t.From == name {
+				activate(t.To)
+			}
+		}
+	}
+	return seen
+}
+
+// hasOutgoing 判断状态或它的祖先是否有出边
+func (d *Definition) hasOutgoing(name string) bool {
+	for _, s := range d.Ancestors(name) {
+		for _, t := range d.Transitions {
+			if t.From == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ambiguities 检查同一个状态同一个事件的多条转换
+func (d *Definition) ambiguities() []Finding {
+	type key struct{ from, event string }
+	groups := map[key][]int{}
+	var keys []key
+	for i, t := range d.Transitions {
+		k := key{t.From, t.Event}
+		if groups[k] == nil {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], i)
+	}
+
+	var findings []Finding
+	for _, k := range keys {
+		indexes := groups[k]
+		if len(indexes) < 2 {
+			continue
+		}
+		for n, i := range indexes[:len(indexes)-1] {
+			t := d.Transitions[i]
+			if t.Guard == nil {
+				// 没有守卫的转换总会生效，后面的转换都不会被选中
+				for _, j := range indexes[n+1:] {
+					findings = append(findings, Finding{
+						Severity: SeverityError, Kind: FindingShadowed, State: k.from, Event: k.event,
+						Message: fmt.Sprintf("transition %s --%s--> %s is shadowed by unguarded transition to %s",
+							k.from, k.event, d.Transitions[j].To, t.To),
+					})
+				}
+				break
+			}
+		}
+		targets := make([]string, len(indexes))
+		guarded := 0
+		for n, i := range indexes {
+			t := d.Transitions[i]
+			targets[n] = t.To
+			if t.GuardName != "" {
+				targets[n] += " [" + t.GuardName + "]"
+			}
+			if t.Guard != nil {
+				guarded++
+			}
+		}
+		// 守卫是任意函数，无法证明互斥，只能提示按声明顺序第一条通过的生效
+		if guarded >= 2 {
+			findings = append(findings, Finding{
+				Severity: SeverityWarning, Kind: FindingNondeterministic, State: k.from, Event: k.event,
+				Message: fmt.Sprintf("state %q has %d transitions on %q whose guards may overlap: %s",
+					k.from, len(indexes), k.event, strings.Join(targets, ", ")),
+			})
+		}
+	}
+	return findings
+}
+
+func (d *Definition) isTimedEvent(event string) bool {
+	for _, t := range d.Transitions {
+		if t.Event == event && t.After > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckDefinition 分析定义，有错误级别的问题时把它们合并成一个错误返回
+func CheckDefinition(d *Definition, opts *AnalyzeOptions) error {
+	findings, err := Analyze(d, opts)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			errs = append(errs, errors.New(f.String()))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("state machine %q: %w", d.Name, errors.Join(errs...))
+	}
+	return nil
+}
+
+// WriteFindings 输出分析结果，返回错误级别问题的数量
+func WriteFindings(w io.Writer, d *Definition, findings []Finding) int {
+	errorCount := 0
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			errorCount++
+		}
+		fmt.Fprintf(w, "%s: %s\n", d.Name, f)
+	}
+	if len(findings) == 0 {
+		fmt.Fprintf(w, "%s: ok\n", d.Name)
+	}
+	return errorCount
+}
+
+// ValidateCatalog 分析 machineCatalog 中指定名称的状态机，name 为 all 时分析全部
+// fired 是逗号分隔的事件列表，为空时不检查未使用的事件；返回错误级别问题的总数
+func ValidateCatalog(w io.Writer, name, fired string) (int, error) {
+	names := []string{name}
+	if name == "all" {
+		names = catalogNames()
+	} else if _, ok := machineCatalog[name]; !ok {
+		return 0, fmt.Errorf("unknown machine %q, available: %s", name, strings.Join(catalogNames(), ", "))
+	}
+	opts := &AnalyzeOptions{}
+	if fired != "" {
+		opts.Fired = strings.Split(fired, ",")
+	}
+	total := 0
+	for _, n := range names {
+		d := machineCatalog[n]()
+		findings, err := Analyze(d, opts)
+		if err != nil {
+			return total, err
+		}
+		total += WriteFindings(w, d, findings)
+	}
+	return total, nil
+}
+
+func catalogNames() []string {
+	names := make([]string, 0, len(machineCatalog))
+	for name := range machineCatalog {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
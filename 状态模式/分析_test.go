@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOrderDefinitionsPassCheck(t *testing.T) {
+	if err := CheckDefinition(NewOrderDefinition(), nil); err != nil {
+		t.Error(err)
+	}
+	if err := CheckDefinition(NewOrderLifecycle(func(string, ...any) {}), nil); err != nil {
+		t.Error(err)
+	}
+	for _, name := range catalogNames() {
+		if err := CheckDefinition(machineCatalog[name](), nil); err != nil {
+			t.Errorf("catalog %s: %v", name, err)
+		}
+	}
+}
+
+func TestAnalyzeFindingsSorted(t *testing.T) {
+	// 状态按与字母顺序相反的顺序声明，排序结果不能依赖声明顺序
+	d := NewDefinition("broken", "start")
+	d.Transition("start", "go", "zeta")
+	d.Transition("start", "go", "alpha")
+	d.Transition("start", "stop", "done")
+	d.Transition("start", "retry", "start", WithGuard("a", func(*Machine, Event) bool { return true }))
+	d.Transition("start", "retry", "done", WithGuard("b", func(*Machine, Event) bool { return true }))
+	d.FinalState("done")
+	d.Transition("orphan-z", "back", "start")
+	d.Transition("orphan-a", "back", "start")
+	d.State("zeta")
+
+	findings, err := Analyze(d, &AnalyzeOptions{Fired: []string{"go"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range findings {
+		got = append(got, fmt.Sprintf("%s %s %s %s", f.Severity, f.Kind, f.State, f.Event))
+	}
+	want := []string{
+		"error dead-end alpha ",
+		"error dead-end zeta ",
+		"error shadowed start go",
+		"error unreachable orphan-a ",
+		"error unreachable orphan-z ",
+		"warning nondeterministic start retry",
+		"warning unused-event  back",
+		"warning unused-event  retry",
+		"warning unused-event  stop",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("findings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	err = CheckDefinition(d, nil)
+	if err == nil {
+		t.Fatal("CheckDefinition passed a definition with errors")
+	}
+	for _, s := range []string{"alpha", "zeta", "orphan-a", "orphan-z", "--go-->"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("CheckDefinition error does not mention %s: %v", s, err)
+		}
+	}
+	if strings.Contains(err.Error(), "warning") {
+		t.Errorf("CheckDefinition reported warnings: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// 超时转换
+// 状态可以声明“停留一段时间后自动转到另一个状态”，例如 pending 30 分钟没有付款就转到 cancelled。
+// 进入状态时安排定时器，离开状态时取消；在定时器到期前收到其他事件离开了该状态，超时转换就不会发生。
+// 定时器触发和调用方的 Fire 都要先获得实例的锁，定时器回调拿到锁后还会确认自己没有被取消，
+// 因此即使定时器到期和 Fire 同时发生，也只会有一个生效。
+
+// stateTimer 是一个已安排的超时转换
+type stateTimer struct {
+	timer    Timer
+	deadline time.Time
+}
+
+// afterEvent 返回超时转换的事件名称，也用于导出状态图
+func afterEvent(d time.Duration) string {
+	return "after " + d.String()
+}
+
+// After 添加一条超时转换：进入 from 状态 d 之后自动转到 to，守卫不通过时不转换
+// 复合状态上的超时从进入复合状态开始计时，在子状态之间切换不会重新计时
+func (d *Definition) After(from string, after time.Duration, to string, opts ...TransitionOption) *Definition {
+	d.Transition(from, afterEvent(after), to, opts...)
+	d.Transitions[len(d.Transitions)-1].After = after
+	return d
+}
+
+// armLocked 为 state 上的超时转换安排定时器；deadlines 中有记录的转换按记录的到期时间安排
+func (m *Machine) armLocked(state string, deadlines map[int]time.Time) {
+	now := m.clock.Now()
+	for i := range m.def.Transitions {
+		t := &m.def.Transitions[i]
+		if t.From != state || t.After <= 0 {
+			continue
+		}
+		deadline, ok := deadlines[i]
+		if !ok {
+			deadline = now.Add(t.After)
+		}
+		m.scheduleLocked(i, deadline, now)
+	}
+}
+
+// scheduleLocked 安排转换表中第 index 条转换在 deadline 触发
+func (m *Machine) scheduleLocked(index int, deadline, now time.Time) {
+	st := &stateTimer{deadline: deadline}
+	st.timer = m.clock.AfterFunc(deadline.Sub(now), func() { m.timerFired(index, st) })
+	m.timers[index] = st
+}
+
+// disarmLocked 取消 state 上的超时转换
+func (m *Machine) disarmLocked(state string) {
+	for i, st := range m.timers {
+		if m.def.Transitions[i].From == state {
+			st.timer.Stop()
+			delete(m.timers, i)
+		}
+	}
+}
+
+// timerFired 在定时器的 goroutine 中执行超时转换
+func (m *Machine) timerFired(index int, st *stateTimer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// 定时器到期后、拿到锁之前，状态可能已经被其他事件改变
+	if m.timers[index] != st {
+		return
+	}
+	delete(m.timers, index)
+
+	t := &m.def.Transitions[index]
+	e := Event{Name: t.Event, Data: st.deadline}
+	if t.Guard != nil && !t.Guard(m, e) {
+		m.onTimerError(fmt.Errorf("%w: %s in state %q", ErrGuardRejected, t.Event, m.current))
+		return
+	}
+	if err := m.applyLocked(t, e); err != nil {
+		m.onTimerError(err)
+	}
+}
+
+// Deadlines 返回当前已安排的超时转换及其到期时间，键为事件名称
+func (m *Machine) Deadlines() map[string]time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]time.Time, len(m.timers))
+	for i, st := range m.timers {
+		t := m.def.Transitions[i]
+		out[t.From+": "+t.Event] = st.deadline
+	}
+	return out
+}
+
+// Stop 取消所有已安排的超时转换，实例不再使用时调用
+func (m *Machine) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, st := range m.timers {
+		st.timer.Stop()
+		delete(m.timers, i)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newPaymentDefinition 返回 pending 30 分钟没有付款就取消的定义，pay 的动作由调用方提供
+func newPaymentDefinition(pay Action) *Definition {
+	d := NewDefinition("payment", "pending")
+	d.Transition("pending", "pay", "paid", WithAction("pay", pay))
+	d.After("pending", 30*time.Minute, "cancelled")
+	d.FinalState("paid")
+	d.FinalState("cancelled")
+	return d
+}
+
+func noAction(*Machine, Event) error { return nil }
+
+func TestTimedTransitionExpires(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	m, err := NewMachine(newPaymentDefinition(noAction), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := start.Add(30 * time.Minute)
+	if got := m.Deadlines()["pending: after 30m0s"]; !got.Equal(deadline) {
+		t.Fatalf("deadline = %v, want %v", got, deadline)
+	}
+	// 超时转换不能由调用方触发
+	if err := m.Fire("after 30m0s"); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("firing the timed event by hand: err = %v, want ErrInvalidTransition", err)
+	}
+
+	clock.Advance(30*time.Minute - time.Nanosecond)
+	if m.Current() != "pending" {
+		t.Fatalf("before the deadline: current = %s, want pending", m.Current())
+	}
+	clock.Advance(time.Nanosecond)
+	if m.Current() != "cancelled" {
+		t.Fatalf("at the deadline: current = %s, want cancelled", m.Current())
+	}
+	if n := clock.Pending(); n != 0 || len(m.Deadlines()) != 0 {
+		t.Fatalf("after expiry: %d clock timers, deadlines %v; want none", n, m.Deadlines())
+	}
+}
+
+func TestTimedTransitionCancelledByEarlierEvent(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	m, err := NewMachine(newPaymentDefinition(noAction), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(10 * time.Minute)
+	if err := m.Fire("pay"); err != nil {
+		t.Fatal(err)
+	}
+	if n := clock.Pending(); n != 0 {
+		t.Fatalf("leaving pending left %d timers scheduled", n)
+	}
+	clock.Advance(time.Hour)
+	if m.Current() != "paid" {
+		t.Fatalf("current = %s, want paid", m.Current())
+	}
+}
+
+func TestTimedTransitionGuardRejected(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	d := NewDefinition("guarded", "idle")
+	d.After("idle", time.Minute, "sleeping", WithGuard("never", func(*Machine, Event) bool { return false }))
+	var timerErr error
+	m, err := NewMachine(d, WithClock(clock), WithTimerErrorHandler(func(err error) { timerErr = err }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	if m.Current() != "idle" || !errors.Is(timerErr, ErrGuardRejected) {
+		t.Fatalf("current = %s, timer error = %v; want idle and ErrGuardRejected", m.Current(), timerErr)
+	}
+}
+
+// TestTimerAndFireRace 让定时器在调用方的 Fire 持有锁时到期：定时器回调等到锁之后发现已经被取消，只有 pay 生效
+func TestTimerAndFireRace(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	pay := func(*Machine, Event) error {
+		close(entered)
+		<-release
+		return nil
+	}
+	var timerErrs []error
+	var mu sync.Mutex
+	m, err := NewMachine(newPaymentDefinition(pay), WithClock(clock), WithTimerErrorHandler(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		timerErrs = append(timerErrs, err)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fired := make(chan error, 1)
+	go func() { fired <- m.Fire("pay") }()
+	<-entered
+
+	advanced := make(chan struct{})
+	go func() {
+		clock.Advance(time.Hour)
+		close(advanced)
+	}()
+	// 定时器已经从时钟中取出，回调正在等待实例的锁
+	for clock.Pending() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	if err := <-fired; err != nil {
+		t.Fatal(err)
+	}
+	<-advanced
+	if m.Current() != "paid" || m.Snapshot().Seq != 1 {
+		t.Fatalf("current = %s, seq = %d; want only the pay transition", m.Current(), m.Snapshot().Seq)
+	}
+	if len(timerErrs) != 0 {
+		t.Fatalf("timer errors = %v, want none", timerErrs)
+	}
+}
+
+// TestTimerAndFireConcurrent 在 -race 下让定时器和调用方同时驱动实例，无论谁先拿到锁都只有一个转换生效
+func TestTimerAndFireConcurrent(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		clock := NewFakeClock(time.Unix(0, 0))
+		m, err := NewMachine(newPaymentDefinition(noAction), WithClock(clock))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		var fireErr error
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			clock.Advance(30 * time.Minute)
+		}()
+		go func() {
+			defer wg.Done()
+			fireErr = m.Fire("pay")
+		}()
+		wg.Wait()
+
+		switch m.Current() {
+		case "paid":
+			if fireErr != nil {
+				t.Fatalf("run %d: paid but Fire returned %v", i, fireErr)
+			}
+		case "cancelled":
+			if !errors.Is(fireErr, ErrInvalidTransition) {
+				t.Fatalf("run %d: cancelled but Fire returned %v", i, fireErr)
+			}
+		default:
+			t.Fatalf("run %d: current = %s", i, m.Current())
+		}
+		if seq := m.Snapshot().Seq; seq != 1 {
+			t.Fatalf("run %d: %d transitions, want 1", i, seq)
+		}
+	}
+}
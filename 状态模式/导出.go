@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// 状态图导出
+// 把状态机定义导出为 Graphviz DOT 或 Mermaid stateDiagram 文本，守卫和动作写在边的标签上，
+// 复合状态导出为子图（DOT 的 cluster、Mermaid 的嵌套 state），方便在代码评审中查看生命周期的变化。
+
+// transitionLabel 生成边的标签：event [guard] / action
+func transitionLabel(t Transition) string {
+	label := t.Event
+	if t.GuardName != "" {
+		label += " [" + t.GuardName + "]"
+	}
+	if t.ActionName != "" {
+		label += " / " + t.ActionName
+	}
+	return label
+}
+
+// stateLabel 生成状态的标签，带上进入和退出动作
+func stateLabel(s *StateConfig) []string {
+	lines := []string{s.Name}
+	if s.EntryName != "" {
+		lines = append(lines, "entry / "+s.EntryName)
+	}
+	if s.ExitName != "" {
+		lines = append(lines, "exit / "+s.ExitName)
+	}
+	return lines
+}
+
+// dotID 生成 DOT 中的标识符，状态名原样放在双引号中
+func dotID(name string) string {
+	return dotString(name)
+}
+
+// dotString 生成带双引号的 DOT 字符串，多行之间用 DOT 的 \n 换行
+func dotString(lines ...string) string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	for i, line := range lines {
+		lines[i] = escape.Replace(line)
+	}
+	return `"` + strings.Join(lines, `\n`) + `"`
+}
+
+// WriteDOT 把状态机导出为 Graphviz DOT
+func WriteDOT(w io.Writer, d *Definition) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotID(d.Name))
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tcompound=true;\n")
+	b.WriteString("\tnode [shape=box, style=rounded];\n")
+	b.WriteString("\t\"__start\" [shape=point];\n")
+
+	var writeState func(name, indent string)
+	writeState = func(name, indent string) {
+		s := d.States[name]
+		if d.IsComposite(name) {
+			fmt.Fprintf(&b, "%ssubgraph %s {\n", indent, dotID("cluster_"+name))
+			lines := stateLabel(s)
+			if s.History != HistoryNone {
+				lines = append(lines, "("+historyName(s.History)+" history)")
+			}
+			fmt.Fprintf(&b, "%s\tlabel=%s;\n", indent, dotString(lines...))
+			// 复合状态本身也画一个小节点，作为指向它的边的端点
+			fmt.Fprintf(&b, "%s\t%s [shape=point, label=\"\"];\n", indent, dotID(name))
+			for _, child := range d.Children(name) {
+				writeState(child, indent+"\t")
+			}
+			fmt.Fprintf(&b, "%s}\n", indent)
+			return
+		}
+		attrs := []string{"label=" + dotString(stateLabel(s)...)}
+		if s.Final {
+			attrs = append(attrs, "peripheries=2")
+		}
+		fmt.Fprintf(&b, "%s%s [%s];\n", indent, dotID(name), strings.Join(attrs, ", "))
+	}
+	for _, name := range d.order {
+		if d.States[name].Parent == "" {
+			writeState(name, "\t")
+		}
+	}
+
+	fmt.Fprintf(&b, "\t\"__start\" -> %s;\n", dotID(d.Initial))
+	for _, name := range d.order {
+		if s := d.States[name]; d.IsComposite(name) {
+			fmt.Fprintf(&b, "\t%s -> %s [style=dashed, label=\"initial\"];\n", dotID(name), dotID(s.Initial))
+		}
+	}
+	for _, t := range d.Transitions {
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s];\n", dotID(t.From), dotID(t.To), dotString(transitionLabel(t)))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mermaidIDs 为每个状态生成 Mermaid 中的标识符，Mermaid 不允许空格和连字符等字符，这些字符替换为 _
+// 替换后可能与其他状态重名（例如 a-b 和 a_b），这时加上数字后缀，否则两个状态的边会被合并到一起
+// 原本就合法的状态名先占用标识符，保证它们原样输出
+func mermaidIDs(d *Definition) map[string]string {
+	names := d.StateNames()
+	if _, ok := d.States[d.Initial]; !ok {
+		// 定义不完整时仍然画出初始状态，方便排查
+		names = append(names, d.Initial)
+	}
+	ids := make(map[string]string, len(names))
+	used := map[string]bool{}
+	for _, name := range names {
+		if mermaidSafe(name) == name {
+			ids[name] = name
+			used[name] = true
+		}
+	}
+	for _, name := range names {
+		if _, ok := ids[name]; ok {
+			continue
+		}
+		base := mermaidSafe(name)
+		id := base
+		for n := 2; used[id]; n++ {
+			id = fmt.Sprintf("%s_%d", base, n)
+		}
+		ids[name] = id
+		used[id] = true
+	}
+	return ids
+}
+
+// mermaidSafe 把 Mermaid 标识符中不允许的字符替换为 _
+func mermaidSafe(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r > 127 {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// mermaidText 转义 Mermaid 标签中有特殊含义的字符
+func mermaidText(s string) string {
+	return strings.NewReplacer(":", "#58;", ";", "#59;").Replace(s)
+}
+
+// WriteMermaid 把状态机导出为 Mermaid stateDiagram-v2
+func WriteMermaid(w io.Writer, d *Definition) error {
+	var b strings.Builder
+	b.WriteString("stateDiagram-v2\n")
+	fmt.Fprintf(&b, "\t%%%% %s\n", d.Name)
+	ids := mermaidIDs(d)
+
+	var writeState func(name, indent string)
+	writeState = func(name, indent string) {
+		s := d.States[name]
+		id := ids[name]
+		if id != name {
+			fmt.Fprintf(&b, "%sstate \"%s\" as %s\n", indent, strings.ReplaceAll(name, `"`, "#quot;"), id)
+		}
+		if d.IsComposite(name) {
+			fmt.Fprintf(&b, "%sstate %s {\n", indent, id)
+			fmt.Fprintf(&b, "%s\t[*] --> %s\n", indent, ids[s.Initial])
+			for _, child := range d.Children(name) {
+				writeState(child, indent+"\t")
+			}
+			fmt.Fprintf(&b, "%s}\n", indent)
+			if s.History != HistoryNone {
+				fmt.Fprintf(&b, "%snote right of %s : %s history\n", indent, id, historyName(s.History))
+			}
+		}
+		for _, line := range stateLabel(s)[1:] {
+			fmt.Fprintf(&b, "%s%s : %s\n", indent, id, mermaidText(line))
+		}
+	}
+	for _, name := range d.order {
+		if d.States[name].Parent == "" {
+			writeState(name, "\t")
+		}
+	}
+
+	fmt.Fprintf(&b, "\t[*] --> %s\n", ids[d.Initial])
+	for _, t := range d.Transitions {
+		fmt.Fprintf(&b, "\t%s --> %s : %s\n", ids[t.From], ids[t.To], mermaidText(transitionLabel(t)))
+	}
+	finals := []string{}
+	for _, name := range d.order {
+		if d.States[name].Final {
+			finals = append(finals, name)
+		}
+	}
+	sort.Strings(finals)
+	for _, name := range finals {
+		fmt.Fprintf(&b, "\t%s --> [*]\n", ids[name])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func historyName(mode HistoryMode) string {
+	switch mode {
+	case HistoryShallow:
+		return "shallow"
+	case HistoryDeep:
+		return "deep"
+	}
+	return "none"
+}
+
+// machineCatalog 是可以通过命令导出的状态机
+var machineCatalog = map[string]func() *Definition{
+	"order":           NewOrderDefinition,
+	"order-lifecycle": func() *Definition { return NewOrderLifecycle(func(string, ...any) {}) },
+}
+
+// ExportDiagram 导出指定名称的状态机，format 为 dot 或 mermaid，output 为空或 "-" 时写到标准输出
+func ExportDiagram(machine, format, output string) error {
+	build, ok := machineCatalog[machine]
+	if !ok {
+		return fmt.Errorf("unknown machine %q, available: %s", machine, strings.Join(catalogNames(), ", "))
+	}
+	var write func(io.Writer, *Definition) error
+	switch format {
+	case "dot":
+		write = WriteDOT
+	case "mermaid":
+		write = WriteMermaid
+	default:
+		return fmt.Errorf("unknown format %q, want dot or mermaid", format)
+	}
+
+	if output == "" || output == "-" {
+		return write(os.Stdout, build())
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := write(f, build()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
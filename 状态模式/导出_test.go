@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// newEscapingDefinition 返回状态名和标签中带有特殊字符的定义：a-b、a_b 和 "a b" 在 Mermaid 中会被替换成同一个标识符
+func newEscapingDefinition() *Definition {
+	always := func(*Machine, Event) bool { return true }
+	d := NewDefinition(`quote "demo"`, "a-b")
+	d.State("a-b").WithEntry(`say "hi"`, func(*Machine, Event) {})
+	d.Transition("a-b", "go", "a_b", WithGuard(`x: "1"; y`, always), WithAction(`back\slash`, noAction))
+	d.Transition("a_b", "back", "a-b")
+	d.Transition("a_b", "wait", `wait "here"`)
+	d.Transition(`wait "here"`, "done", "a b")
+	d.FinalState("a b")
+	return d
+}
+
+func TestExportGolden(t *testing.T) {
+	definitions := map[string]*Definition{
+		"order":           NewOrderDefinition(),
+		"order-lifecycle": NewOrderLifecycle(func(string, ...any) {}),
+		"escaping":        newEscapingDefinition(),
+	}
+	formats := map[string]func(io.Writer, *Definition) error{
+		"dot":     WriteDOT,
+		"mermaid": WriteMermaid,
+	}
+	for name, d := range definitions {
+		for format, write := range formats {
+			t.Run(name+"/"+format, func(t *testing.T) {
+				var b bytes.Buffer
+				if err := write(&b, d); err != nil {
+					t.Fatal(err)
+				}
+				got := b.String()
+				golden := filepath.Join("testdata", name+"."+format+".golden")
+				if *update {
+					if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != string(want) {
+					t.Errorf("%s differs from %s (run go test -update to rewrite it)\ngot:\n%swant:\n%s", name, golden, got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestMermaidIDsAreUnique(t *testing.T) {
+	ids := mermaidIDs(newEscapingDefinition())
+	want := map[string]string{"a_b": "a_b", "a-b": "a_b_2", `wait "here"`: `wait__here_`, "a b": "a_b_3"}
+	for name, id := range want {
+		if ids[name] != id {
+			t.Errorf("id of %q = %q, want %q", name, ids[name], id)
+		}
+	}
+}
+
+func TestExportDiagram(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "order.dot")
+	if err := ExportDiagram("order", "dot", output); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	WriteDOT(&want, NewOrderDefinition())
+	if string(got) != want.String() {
+		t.Fatalf("exported file differs from WriteDOT:\n%s", got)
+	}
+
+	for _, tt := range []struct{ machine, format, want string }{
+		{"payment", "dot", `unknown machine "payment", available: order, order-lifecycle`},
+		{"order", "svg", `unknown format "svg", want dot or mermaid`},
+	} {
+		err := ExportDiagram(tt.machine, tt.format, output)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ExportDiagram(%s, %s) error = %v, want %q", tt.machine, tt.format, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// 层次状态
+// 状态可以嵌套：子状态没有处理的事件交给父状态处理，转换跨越层级时，
+// 先从当前叶子状态向上依次执行退出动作，直到源状态和目标状态的最近公共祖先，
+// 再从公共祖先向下依次执行进入动作，直到目标状态；目标是复合状态时继续进入它的初始子状态。
+// 复合状态可以开启历史模式，再次进入时回到上次退出时的子状态，而不是初始子状态。
+
+// HistoryMode 是复合状态的历史模式
+type HistoryMode int
+
+const (
+	HistoryNone    HistoryMode = iota
+	HistoryShallow             // 回到上次激活的直接子状态，再从该子状态的初始状态进入
+	HistoryDeep                // 回到上次激活的叶子状态
+)
+
+// SubState 声明 parent 的子状态；parent 还没有初始子状态时，第一个子状态成为初始子状态
+func (d *Definition) SubState(parent, name string) *StateConfig {
+	p := d.State(parent)
+	s := d.State(name)
+	s.Parent = parent
+	if p.Initial == "" {
+		p.Initial = name
+	}
+	return s
+}
+
+// Children 按声明顺序返回直接子状态
+func (d *Definition) Children(name string) []string {
+	var children []string
+	for _, s := range d.order {
+		if d.States[s].Parent == name {
+			children = append(children, s)
+		}
+	}
+	return children
+}
+
+// IsComposite 判断状态是否有子状态
+func (d *Definition) IsComposite(name string) bool {
+	for _, s := range d.States {
+		if s.Parent == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Ancestors 返回从 name 开始向上直到顶层状态的路径，包括 name 本身
+func (d *Definition) Ancestors(name string) []string {
+	var path []string
+	for s := name; s != ""; s = d.States[s].Parent {
+		path = append(path, s)
+	}
+	return path
+}
+
+// isAncestor 判断 ancestor 是否为 name 或 name 的祖先
+func (d *Definition) isAncestor(ancestor, name string) bool {
+	for _, s := range d.Ancestors(name) {
+		if s == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// commonAncestor 返回 a 和 b 的最近公共祖先，没有公共祖先时返回空字符串
+func (d *Definition) commonAncestor(a, b string) string {
+	for _, s := range d.Ancestors(a) {
+		if d.isAncestor(s, b) {
+			return s
+		}
+	}
+	return ""
+}
+
+func (d *Definition) validateHierarchy() []error {
+	var errs []error
+	for _, name := range d.order {
+		s := d.States[name]
+		if s.Parent != "" {
+			if _, ok := d.States[s.Parent]; !ok {
+				errs = append(errs, fmt.Errorf("state %q: parent %q is not declared", name, s.Parent))
+				continue
+			}
+		}
+		// 沿父状态向上走，步数超过状态总数说明有环
+		steps := 0
+		for p := s.Parent; p != "" && steps <= len(d.States); p = d.States[p].Parent {
+			steps++
+			if _, ok := d.States[p]; !ok {
+				break
+			}
+		}
+		if steps > len(d.States) {
+			errs = append(errs, fmt.Errorf("state %q: parent chain has a cycle", name))
+			continue
+		}
+		if d.IsComposite(name) {
+			if s.Initial == "" {
+				errs = append(errs, fmt.Errorf("composite state %q has no initial substate", name))
+			} else if c, ok := d.States[s.Initial]; !ok || c.Parent != name {
+				errs = append(errs, fmt.Errorf("composite state %q: initial %q is not its child", name, s.Initial))
+			}
+		} else if s.History != HistoryNone {
+			errs = append(errs, fmt.Errorf("state %q: history needs substates", name))
+		}
+	}
+	return errs
+}
+
+// IsIn 判断状态是否处于激活状态，即当前叶子状态是它本身或它的子孙
+func (m *Machine) IsIn(state string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.def.isAncestor(state, m.current)
+}
+
+// ActivePath 返回从顶层状态到当前叶子状态的激活路径
+func (m *Machine) ActivePath() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path := m.def.Ancestors(m.current)
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// transitionScope 返回转换的作用域：从当前叶子状态退出到它为止，再从它向下进入目标状态
+// 目标是源状态本身或它的祖先、子孙时按外部转换处理，源状态也会退出再进入
+func (d *Definition) transitionScope(t *Transition) string {
+	lca := d.commonAncestor(t.From, t.To)
+	if lca == t.From || lca == t.To {
+		lca = d.States[lca].Parent
+	}
+	return lca
+}
+
+// exitLocked 从当前叶子状态向上退出，直到 until（不包括 until），同时记录历史
+func (m *Machine) exitLocked(until string, e Event) {
+	d := m.def
+	leaf := m.current
+	for s := m.current; s != until && s != ""; s = d.States[s].Parent {
+		if parent := d.States[s].Parent; parent != "" {
+			switch d.States[parent].History {
+			case HistoryShallow:
+				m.history[parent] = s
+			case HistoryDeep:
+				m.history[parent] = leaf
+			}
+		}
+		m.disarmLocked(s)
+		if cfg := d.States[s]; cfg.Exit != nil {
+			cfg.Exit(m, e)
+		}
+	}
+}
+
+// enterLocked 从 from 的下一层开始向下进入到 target，再按初始子状态或历史进入到叶子状态
+func (m *Machine) enterLocked(from, target string, e Event) {
+	d := m.def
+	path := d.Ancestors(target)
+	for i := len(path) - 1; i >= 0; i-- {
+		if d.isAncestor(path[i], from) {
+			continue
+		}
+		m.runEntry(path[i], e)
+	}
+
+	s := target
+	for d.IsComposite(s) {
+		cfg := d.States[s]
+		next := cfg.Initial
+		if h, ok := m.history[s]; ok {
+			switch cfg.History {
+			case HistoryShallow:
+				next = h
+			case HistoryDeep:
+				// 从 s 的下一层一直进入到记录的叶子状态
+				deep := d.Ancestors(h)
+				for i := len(deep) - 1; i >= 0; i-- {
+					if !d.isAncestor(deep[i], s) {
+						m.runEntry(deep[i], e)
+					}
+				}
+				s = h
+				continue
+			}
+		}
+		m.runEntry(next, e)
+		s = next
+	}
+	m.current = s
+}
+
+func (m *Machine) runEntry(state string, e Event) {
+	if cfg := m.def.States[state]; cfg.Entry != nil {
+		cfg.Entry(m, e)
+	}
+	m.armLocked(state, nil)
+}
+
+// rollbackLocked 在转换动作出错后回到退出之前的叶子状态 leaf：
+// 从 scope 向下重新执行刚才退出的状态的进入动作，历史记录恢复原样，
+// 超时转换按退出之前的到期时间重新安排，不会重新计时
+func (m *Machine) rollbackLocked(scope, leaf string, e Event, timers map[int]time.Time, history map[string]string) {
+	d := m.def
+	path := d.Ancestors(leaf)
+	for i := len(path) - 1; i >= 0; i-- {
+		if d.isAncestor(path[i], scope) {
+			continue
+		}
+		if cfg := d.States[path[i]]; cfg.Entry != nil {
+			cfg.Entry(m, e)
+		}
+	}
+	now := m.clock.Now()
+	for i, deadline := range timers {
+		if _, ok := m.timers[i]; !ok {
+			m.scheduleLocked(i, deadline, now)
+		}
+	}
+	m.history = history
+	m.current = leaf
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newNestedDefinition 返回三层嵌套的定义，进入、退出动作和转换动作都记录到 trace
+//
+//	A ─ A1 ─ A1a, A1b        B ─ B1 ─ B1a, B1b
+//	  └ A2                     └ B2
+//	off
+func newNestedDefinition(history HistoryMode, trace *[]string) *Definition {
+	record := func(s string) Hook {
+		return func(m *Machine, e Event) { *trace = append(*trace, s) }
+	}
+	d := NewDefinition("nested", "A")
+	hooks := func(s *StateConfig) {
+		s.WithEntry("enter", record("enter "+s.Name)).WithExit("exit", record("exit "+s.Name))
+	}
+	hooks(d.State("A"))
+	hooks(d.SubState("A", "A1"))
+	hooks(d.SubState("A1", "A1a"))
+	hooks(d.SubState("A1", "A1b"))
+	hooks(d.SubState("A", "A2"))
+	hooks(d.State("B").WithHistory(history))
+	hooks(d.SubState("B", "B1"))
+	hooks(d.SubState("B1", "B1a"))
+	hooks(d.SubState("B1", "B1b"))
+	hooks(d.SubState("B", "B2"))
+	hooks(d.State("off"))
+
+	act := func(name string) TransitionOption {
+		return WithAction(name, func(m *Machine, e Event) error {
+			*trace = append(*trace, "action "+name)
+			return nil
+		})
+	}
+	d.Transition("A1a", "next", "A1b", act("A1a->A1b"))
+	d.Transition("A1", "toB", "B", act("A1->B"))
+	d.Transition("A", "ping", "A2", act("A->A2"))
+	d.Transition("A", "reset", "A", act("A->A"))
+	d.Transition("B1a", "next", "B1b", act("B1a->B1b"))
+	d.Transition("B1", "next", "B2", act("B1->B2"))
+	d.Transition("B", "off", "off", act("B->off"))
+	d.Transition("off", "on", "B", act("off->B"))
+	return d
+}
+
+func TestNestedEntryExitOrder(t *testing.T) {
+	var trace []string
+	m, err := NewMachine(newNestedDefinition(HistoryNone, &trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		event string
+		want  []string
+		path  string
+	}{
+		{"", []string{"enter A", "enter A1", "enter A1a"}, "A/A1/A1a"},
+		// 同一个父状态内的兄弟状态，只退出和进入叶子
+		{"next", []string{"exit A1a", "action A1a->A1b", "enter A1b"}, "A/A1/A1b"},
+		// 跨越三层：从内到外退出到顶层，执行转换动作，再从外到内进入，并进入目标的初始子状态
+		{"toB", []string{"exit A1b", "exit A1", "exit A", "action A1->B", "enter B", "enter B1", "enter B1a"}, "B/B1/B1a"},
+		{"off", []string{"exit B1a", "exit B1", "exit B", "action B->off", "enter off"}, "off"},
+		{"on", []string{"exit off", "action off->B", "enter B", "enter B1", "enter B1a"}, "B/B1/B1a"},
+	}
+	for _, tt := range tests {
+		if tt.event != "" {
+			trace = nil
+			if err := m.Fire(tt.event); err != nil {
+				t.Fatalf("fire %s: %v", tt.event, err)
+			}
+		}
+		if !reflect.DeepEqual(trace, tt.want) {
+			t.Errorf("fire %q: trace = %q, want %q", tt.event, trace, tt.want)
+		}
+		if path := strings.Join(m.ActivePath(), "/"); path != tt.path {
+			t.Errorf("fire %q: active path = %s, want %s", tt.event, path, tt.path)
+		}
+	}
+}
+
+func TestNestedSelfTransitionReenters(t *testing.T) {
+	var trace []string
+	m, err := NewMachine(newNestedDefinition(HistoryNone, &trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Fire("next")
+	trace = nil
+	// 外部自转换：A 自己也退出再进入，回到初始子状态
+	if err := m.Fire("reset"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"exit A1b", "exit A1", "exit A", "action A->A", "enter A", "enter A1", "enter A1a"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("trace = %q, want %q", trace, want)
+	}
+}
+
+func TestNestedEventBubbling(t *testing.T) {
+	var trace []string
+	m, err := NewMachine(newNestedDefinition(HistoryNone, &trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A1a 和 A1 都没有处理 ping，交给祖父状态 A；目标是 A 的子状态，按外部转换处理，A 也退出再进入
+	trace = nil
+	if err := m.Fire("ping"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"exit A1a", "exit A1", "exit A", "action A->A2", "enter A", "enter A2"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("ping: trace = %q, want %q", trace, want)
+	}
+
+	// 子状态的转换优先于父状态：B1a 自己处理 next，B1b 没有 next，交给 B1
+	m.Fire("reset")
+	m.Fire("toB")
+	if err := m.Fire("next"); err != nil || m.Current() != "B1b" {
+		t.Fatalf("next in B1a: current = %s, err = %v; want B1b", m.Current(), err)
+	}
+	if err := m.Fire("next"); err != nil || m.Current() != "B2" {
+		t.Fatalf("next in B1b: current = %s, err = %v; want B2 via B1", m.Current(), err)
+	}
+	if !m.IsIn("B") || m.IsIn("B1") {
+		t.Fatalf("IsIn(B) = %v, IsIn(B1) = %v; want true, false", m.IsIn("B"), m.IsIn("B1"))
+	}
+
+	// 没有任何祖先处理的事件
+	if err := m.Fire("ping"); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("ping in B2: err = %v, want ErrInvalidTransition", err)
+	}
+	if m.Current() != "B2" {
+		t.Fatalf("failed event changed the state to %s", m.Current())
+	}
+}
+
+func TestNestedHistoryReentry(t *testing.T) {
+	tests := []struct {
+		mode HistoryMode
+		// 分别从 B1b 和 B2 离开 B 之后再回来的激活路径，以及从 B1b 回来时的进入顺序
+		fromB1b, fromB2 string
+		enterB1b        []string
+	}{
+		{HistoryNone, "B/B1/B1a", "B/B1/B1a", []string{"enter B", "enter B1", "enter B1a"}},
+		// 浅历史记住 B1，再从 B1 的初始子状态进入
+		{HistoryShallow, "B/B1/B1a", "B/B2", []string{"enter B", "enter B1", "enter B1a"}},
+		// 深历史一直回到离开时的叶子
+		{HistoryDeep, "B/B1/B1b", "B/B2", []string{"enter B", "enter B1", "enter B1b"}},
+	}
+	for _, tt := range tests {
+		var trace []string
+		m, err := NewMachine(newNestedDefinition(tt.mode, &trace))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range []string{"toB", "next", "off"} {
+			if err := m.Fire(e); err != nil {
+				t.Fatalf("mode %d: fire %s: %v", tt.mode, e, err)
+			}
+		}
+		trace = nil
+		m.Fire("on")
+		if path := strings.Join(m.ActivePath(), "/"); path != tt.fromB1b {
+			t.Errorf("mode %d: left from B1b, re-entered %s, want %s", tt.mode, path, tt.fromB1b)
+		}
+		if got := trace[2:]; !reflect.DeepEqual(got, tt.enterB1b) {
+			t.Errorf("mode %d: re-entry trace = %q, want %q", tt.mode, got, tt.enterB1b)
+		}
+
+		// 走到 B2 后离开再回来
+		for m.Current() != "B2" {
+			if err := m.Fire("next"); err != nil {
+				t.Fatalf("mode %d: fire next in %s: %v", tt.mode, m.Current(), err)
+			}
+		}
+		m.Fire("off")
+		m.Fire("on")
+		if path := strings.Join(m.ActivePath(), "/"); path != tt.fromB2 {
+			t.Errorf("mode %d: left from B2, re-entered %s, want %s", tt.mode, path, tt.fromB2)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 持久化与审计
+// 状态机实例可以把当前状态、扩展变量和历史记录序列化成 JSON 保存，之后用同一个定义恢复；
+// 每次转换都会追加一条审计记录，按顺序回放审计记录就能还原实例是怎样走到当前状态的。
+// 扩展变量经过 JSON 往返后，数字会变成 float64，对象会变成 map[string]any。
+
+// Snapshot 是状态机实例的可序列化快照
+type Snapshot struct {
+	Machine string            `json:"machine"` // 定义的名称，恢复时必须一致
+	ID      string            `json:"id,omitempty"`
+	State   string            `json:"state"`
+	Seq     int               `json:"seq"`
+	Vars    map[string]any    `json:"vars,omitempty"`
+	History map[string]string `json:"history,omitempty"`
+	Timers  []TimerSnapshot   `json:"timers,omitempty"`
+}
+
+// TimerSnapshot 记录一个已安排的超时转换，恢复时按原来的到期时间重新安排
+type TimerSnapshot struct {
+	From     string    `json:"from"`
+	Event    string    `json:"event"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// TransitionRecord 是一条审计记录
+type TransitionRecord struct {
+	Machine string    `json:"machine"`
+	ID      string    `json:"id,omitempty"`
+	Seq     int       `json:"seq"` // 从 1 开始，与快照中的 Seq 衔接
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Data    any       `json:"data,omitempty"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+}
+
+// AuditLog 保存审计记录
+type AuditLog interface {
+	Append(record TransitionRecord) error
+}
+
+// SetID 设置实例标识，写入快照和审计记录
+func (m *Machine) SetID(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.id = id
+}
+
+// SetAuditLog 设置审计日志，之后的每次转换都会追加一条记录
+func (m *Machine) SetAuditLog(log AuditLog) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.audit = log
+}
+
+// recordLocked 在转换完成后写审计记录
+// 写入失败时转换已经生效，返回的错误会说明这一点
+func (m *Machine) recordLocked(from string, e Event) error {
+	if m.audit == nil {
+		return nil
+	}
+	record := TransitionRecord{
+		Machine: m.def.Name,
+		ID:      m.id,
+		Seq:     m.seq,
+		Time:    m.clock.Now(),
+		Event:   e.Name,
+		Data:    e.Data,
+		From:    from,
+		To:      m.current,
+	}
+	if err := m.audit.Append(record); err != nil {
+		return fmt.Errorf("transition %s -> %s applied but audit append failed: %w", from, m.current, err)
+	}
+	return nil
+}
+
+// Snapshot 返回当前实例的快照
+func (m *Machine) Snapshot() Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := Snapshot{
+		Machine: m.def.Name,
+		ID:      m.id,
+		State:   m.current,
+		Seq:     m.seq,
+		Vars:    make(map[string]any, len(m.vars)),
+		History: make(map[string]string, len(m.history)),
+	}
+	for k, v := range m.vars {
+		s.Vars[k] = v
+	}
+	for k, v := range m.history {
+		s.History[k] = v
+	}
+	for i, st := range m.timers {
+		t := m.def.Transitions[i]
+		s.Timers = append(s.Timers, TimerSnapshot{From: t.From, Event: t.Event, Deadline: st.deadline})
+	}
+	sort.Slice(s.Timers, func(i, j int) bool { return s.Timers[i].Deadline.Before(s.Timers[j].Deadline) })
+	return s
+}
+
+// MarshalJSON 把实例序列化为快照 JSON
+func (m *Machine) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Snapshot())
+}
+
+// RestoreMachine 从快照恢复实例，不会执行任何进入动作
+// 激活状态上的超时转换按快照中的到期时间重新安排，已经过期的会立即触发；快照中没有记录的从现在开始计时
+func RestoreMachine(def *Definition, s Snapshot, opts ...MachineOption) (*Machine, error) {
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	if s.Machine != def.Name {
+		return nil, fmt.Errorf("snapshot of machine %q cannot be restored as %q", s.Machine, def.Name)
+	}
+	if _, ok := def.States[s.State]; !ok {
+		return nil, fmt.Errorf("snapshot state %q is not declared in %q", s.State, def.Name)
+	}
+	if def.IsComposite(s.State) {
+		return nil, fmt.Errorf("snapshot state %q is a composite state", s.State)
+	}
+	for parent, child := range s.History {
+		if _, ok := def.States[parent]; !ok {
+			return nil, fmt.Errorf("snapshot history: state %q is not declared", parent)
+		}
+		if _, ok := def.States[child]; !ok {
+			return nil, fmt.Errorf("snapshot history: state %q is not declared", child)
+		}
+		if !def.isAncestor(parent, child) || parent == child {
+			return nil, fmt.Errorf("snapshot history: %q is not a substate of %q", child, parent)
+		}
+	}
+
+	deadlines := map[int]time.Time{}
+	for _, ts := range s.Timers {
+		i := slices.IndexFunc(def.Transitions, func(t Transition) bool {
+			return t.From == ts.From && t.Event == ts.Event && t.After > 0
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("snapshot timer: no timed transition %q from %q", ts.Event, ts.From)
+		}
+		deadlines[i] = ts.Deadline
+	}
+
+	m := newMachine(def, opts)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.id, m.current, m.seq = s.ID, s.State, s.Seq
+	for k, v := range s.Vars {
+		m.vars[k] = v
+	}
+	for k, v := range s.History {
+		m.history[k] = v
+	}
+	for _, state := range def.Ancestors(s.State) {
+		m.armLocked(state, deadlines)
+	}
+	return m, nil
+}
+
+// RestoreMachineJSON 从快照 JSON 恢复实例
+func RestoreMachineJSON(def *Definition, data []byte, opts ...MachineOption) (*Machine, error) {
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse snapshot: %w", err)
+	}
+	return RestoreMachine(def, s, opts...)
+}
+
+// MemoryAuditLog 把审计记录保存在内存中
+type MemoryAuditLog struct {
+	mu      sync.Mutex
+	records []TransitionRecord
+}
+
+func (l *MemoryAuditLog) Append(record TransitionRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, record)
+	return nil
+}
+
+// Records 返回全部审计记录
+func (l *MemoryAuditLog) Records() []TransitionRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]TransitionRecord(nil), l.records...)
+}
+
+// JSONLinesAuditLog 把审计记录逐行写成 JSON，适合追加到文件
+type JSONLinesAuditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONLinesAuditLog(w io.Writer) *JSONLinesAuditLog {
+	return &JSONLinesAuditLog{enc: json.NewEncoder(w)}
+}
+
+func (l *JSONLinesAuditLog) Append(record TransitionRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc.Encode(record)
+}
+
+// ReadAuditLog 读取 JSONLinesAuditLog 写出的记录
+func ReadAuditLog(r io.Reader) ([]TransitionRecord, error) {
+	var records []TransitionRecord
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record TransitionRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("audit log line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// ErrAuditGap 表示审计记录不连续
+var ErrAuditGap = errors.New("audit log is not contiguous")
+
+// ReconstructPath 按审计记录还原实例经过的状态序列，第一个元素是第一条记录的起始状态
+// 记录的序号必须连续，且每条记录的起始状态必须等于上一条的目标状态
+func ReconstructPath(records []TransitionRecord) ([]string, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+	path := []string{records[0].From}
+	for i, r := range records {
+		if i > 0 {
+			prev := records[i-1]
+			if r.Seq != prev.Seq+1 {
+				return nil, fmt.Errorf("%w: seq %d follows %d", ErrAuditGap, r.Seq, prev.Seq)
+			}
+			if r.From != prev.To {
+				return nil, fmt.Errorf("%w: seq %d starts from %q but previous ended in %q", ErrAuditGap, r.Seq, r.From, prev.To)
+			}
+		}
+		path = append(path, r.To)
+	}
+	return path, nil
+}
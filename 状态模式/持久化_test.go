@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	def := NewOrderLifecycle(func(string, ...any) {})
+	m, err := NewMachine(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetID("order-1")
+	for _, e := range []string{"approve", "picked", "suspend"} {
+		if err := m.Fire(e); err != nil {
+			t.Fatalf("fire %s: %v", e, err)
+		}
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := RestoreMachineJSON(def, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := restored.Snapshot(), m.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("restored snapshot = %+v, want %+v", got, want)
+	}
+	// 深历史在恢复后仍然有效
+	if err := restored.Fire("resume"); err != nil {
+		t.Fatal(err)
+	}
+	if got := restored.Current(); got != "packing" {
+		t.Fatalf("after resume: current = %q, want packing", got)
+	}
+}
+
+func TestRestoreRejectsCorruptedSnapshot(t *testing.T) {
+	def := NewOrderLifecycle(func(string, ...any) {})
+	tests := []struct {
+		name string
+		snap Snapshot
+		want string
+	}{
+		{"wrong machine", Snapshot{Machine: "order", State: "pending"}, "cannot be restored"},
+		{"unknown state", Snapshot{Machine: def.Name, State: "lost"}, "not declared"},
+		{"composite state", Snapshot{Machine: def.Name, State: "processing"}, "composite"},
+		{"unknown history parent", Snapshot{Machine: def.Name, State: "pending", History: map[string]string{"nowhere": "pending"}}, "not declared"},
+		{"unknown history child", Snapshot{Machine: def.Name, State: "pending", History: map[string]string{"active": "no-such-state"}}, "not declared"},
+		{"history outside parent", Snapshot{Machine: def.Name, State: "pending", History: map[string]string{"processing": "suspended"}}, "not a substate"},
+		{"unknown timer", Snapshot{Machine: def.Name, State: "pending", Timers: []TimerSnapshot{{From: "pending", Event: "after 1s"}}}, "no timed transition"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := RestoreMachine(def, tt.snap)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := RestoreMachineJSON(def, []byte(`{"machine":`)); err == nil {
+		t.Fatal("truncated JSON: want error")
+	}
+}
+
+func TestAuditLogReconstructsPath(t *testing.T) {
+	def := NewOrderDefinition()
+	m, err := NewMachine(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	m.SetAuditLog(NewJSONLinesAuditLog(&buf))
+	for _, e := range []Event{{Name: "pay", Data: 10}, {Name: "ship"}, {Name: "deliver"}} {
+		if err := m.FireEvent(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := ReadAuditLog(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := ReconstructPath(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"created", "paid", "shipped", "delivered"}; !reflect.DeepEqual(path, want) {
+		t.Fatalf("path = %v, want %v", path, want)
+	}
+	records[1].Seq = 7
+	if _, err := ReconstructPath(records); err == nil {
+		t.Fatal("gap in seq: want error")
+	}
+}
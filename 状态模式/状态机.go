@@ -0,0 +1,356 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 声明式有限状态机
+// 状态和事件都用名称表示，状态之间的转换写在转换表里：从哪个状态、收到哪个事件、转到哪个状态，
+// 转换可以带守卫（Guard，决定转换能否发生）和动作（Action，转换发生时执行）。
+// Fire(event) 在当前状态下查找转换，没有可用的转换时返回错误，而不是像 ConcreteStateA/B 那样无条件切换。
+
+var (
+	// ErrInvalidTransition 表示当前状态下没有处理该事件的转换
+	ErrInvalidTransition = errors.New("invalid transition")
+	// ErrGuardRejected 表示有处理该事件的转换，但守卫全部不通过
+	ErrGuardRejected = errors.New("transition rejected by guard")
+)
+
+// Event 是触发转换的事件，Data 为事件携带的参数
+type Event struct {
+	Name string
+	Data any
+}
+
+// Guard 决定转换能否发生
+type Guard func(m *Machine, e Event) bool
+
+// Action 在退出源状态之后、进入目标状态之前执行，返回错误时回到原来的状态
+type Action func(m *Machine, e Event) error
+
+// Hook 是状态的进入或退出动作
+type Hook func(m *Machine, e Event)
+
+// StateConfig 描述一个状态
+type StateConfig struct {
+	Name    string
+	Final   bool        // 终止状态，没有出边是正常的
+	Parent  string      // 父状态，空表示顶层状态
+	Initial string      // 复合状态的初始子状态
+	History HistoryMode // 复合状态再次进入时是否回到上次的子状态
+
+	Entry     Hook
+	EntryName string
+	Exit      Hook
+	ExitName  string
+}
+
+// WithEntry 设置进入动作
+func (s *StateConfig) WithEntry(name string, hook Hook) *StateConfig {
+	s.EntryName, s.Entry = name, hook
+	return s
+}
+
+// WithExit 设置退出动作
+func (s *StateConfig) WithExit(name string, hook Hook) *StateConfig {
+	s.ExitName, s.Exit = name, hook
+	return s
+}
+
+// WithInitial 设置复合状态的初始子状态
+func (s *StateConfig) WithInitial(child string) *StateConfig {
+	s.Initial = child
+	return s
+}
+
+// WithHistory 设置复合状态的历史模式
+func (s *StateConfig) WithHistory(mode HistoryMode) *StateConfig {
+	s.History = mode
+	return s
+}
+
+// Transition 是转换表中的一行
+// GuardName、ActionName 只用于展示，例如导出状态图
+type Transition struct {
+	From       string
+	Event      string
+	To         string
+	Guard      Guard
+	GuardName  string
+	Action     Action
+	ActionName string
+	After      time.Duration // 大于 0 时为超时转换，进入 From 状态 After 之后自动触发
+}
+
+// TransitionOption 用于设置转换的守卫和动作
+type TransitionOption func(t *Transition)
+
+// WithGuard 设置守卫
+func WithGuard(name string, guard Guard) TransitionOption {
+	return func(t *Transition) {
+		t.GuardName, t.Guard = name, guard
+	}
+}
+
+// WithAction 设置动作
+func WithAction(name string, action Action) TransitionOption {
+	return func(t *Transition) {
+		t.ActionName, t.Action = name, action
+	}
+}
+
+// Definition 是状态机的定义，可以被多个 Machine 实例共享，创建实例后不应再修改
+type Definition struct {
+	Name        string
+	Initial     string
+	States      map[string]*StateConfig
+	Transitions []Transition
+	order       []string // 状态的声明顺序，用于稳定输出
+}
+
+func NewDefinition(name, initial string) *Definition {
+	return &Definition{Name: name, Initial: initial, States: map[string]*StateConfig{}}
+}
+
+// State 声明一个状态，重复声明返回已有的状态
+func (d *Definition) State(name string) *StateConfig {
+	if s, ok := d.States[name]; ok {
+		return s
+	}
+	s := &StateConfig{Name: name}
+	d.States[name] = s
+	d.order = append(d.order, name)
+	return s
+}
+
+// FinalState 声明一个终止状态
+func (d *Definition) FinalState(name string) *StateConfig {
+	s := d.State(name)
+	s.Final = true
+	return s
+}
+
+// Transition 添加一条转换，From 和 To 状态如果没有声明会自动声明
+// 同一个状态同一个事件可以有多条转换，按添加顺序检查守卫，第一条通过的转换生效
+func (d *Definition) Transition(from, event, to string, opts ...TransitionOption) *Definition {
+	d.State(from)
+	d.State(to)
+	t := Transition{From: from, Event: event, To: to}
+	for _, opt := range opts {
+		opt(&t)
+	}
+	d.Transitions = append(d.Transitions, t)
+	return d
+}
+
+// StateNames 按声明顺序返回所有状态
+func (d *Definition) StateNames() []string {
+	return append([]string(nil), d.order...)
+}
+
+// Events 返回转换表中出现的所有事件，按字母排序
+func (d *Definition) Events() []string {
+	seen := map[string]bool{}
+	var events []string
+	for _, t := range d.Transitions {
+		if !seen[t.Event] {
+			seen[t.Event] = true
+			events = append(events, t.Event)
+		}
+	}
+	sort.Strings(events)
+	return events
+}
+
+// Validate 检查定义是否完整
+func (d *Definition) Validate() error {
+	var errs []error
+	if _, ok := d.States[d.Initial]; !ok {
+		errs = append(errs, fmt.Errorf("initial state %q is not declared", d.Initial))
+	}
+	errs = append(errs, d.validateHierarchy()...)
+	for i, t := range d.Transitions {
+		if t.Event == "" {
+			errs = append(errs, fmt.Errorf("transition %d (%s -> %s): empty event", i, t.From, t.To))
+		}
+		if t.After < 0 {
+			errs = append(errs, fmt.Errorf("transition %d (%s -> %s): negative timeout %s", i, t.From, t.To, t.After))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("state machine %q: %w", d.Name, errors.Join(errs...))
+	}
+	return nil
+}
+
+// Machine 是状态机实例，可以同时被调用方的 goroutine 和超时定时器驱动
+// 当前状态总是一个叶子状态（没有子状态的状态），它的祖先状态同时处于激活状态
+// 守卫和动作在持有锁的情况下执行，不能在其中再调用同一个实例的 Fire
+type Machine struct {
+	mu      sync.Mutex
+	def     *Definition
+	current string
+	vars    map[string]any
+	history map[string]string // 复合状态上次退出时的子状态（浅历史）或叶子状态（深历史）
+
+	id    string
+	seq   int // 已经发生的转换次数
+	audit AuditLog
+
+	clock        Clock
+	timers       map[int]*stateTimer // 按转换在转换表中的下标记录已安排的超时转换
+	onTimerError func(err error)
+}
+
+// MachineOption 用于设置实例的可选项
+type MachineOption func(m *Machine)
+
+// WithClock 设置时钟，默认使用系统时间
+func WithClock(clock Clock) MachineOption {
+	return func(m *Machine) {
+		m.clock = clock
+	}
+}
+
+// WithTimerErrorHandler 设置超时转换出错时的回调，例如守卫不通过或动作返回错误，默认忽略
+func WithTimerErrorHandler(handler func(err error)) MachineOption {
+	return func(m *Machine) {
+		m.onTimerError = handler
+	}
+}
+
+// NewMachine 创建实例并进入初始状态，从外到内依次执行进入动作
+func NewMachine(def *Definition, opts ...MachineOption) (*Machine, error) {
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	m := newMachine(def, opts)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enterLocked("", def.Initial, Event{})
+	return m, nil
+}
+
+func newMachine(def *Definition, opts []MachineOption) *Machine {
+	m := &Machine{
+		def:          def,
+		vars:         map[string]any{},
+		history:      map[string]string{},
+		clock:        realClock{},
+		timers:       map[int]*stateTimer{},
+		onTimerError: func(error) {},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Definition 返回状态机的定义
+func (m *Machine) Definition() *Definition {
+	return m.def
+}
+
+// Current 返回当前状态
+func (m *Machine) Current() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.current
+}
+
+// Var 读取扩展变量，只能在守卫和动作中调用
+func (m *Machine) Var(name string) any {
+	return m.vars[name]
+}
+
+// SetVar 设置扩展变量，只能在守卫和动作中调用
+func (m *Machine) SetVar(name string, value any) {
+	m.vars[name] = value
+}
+
+// Vars 返回扩展变量的副本，供守卫和动作之外的代码读取
+func (m *Machine) Vars() map[string]any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	vars := make(map[string]any, len(m.vars))
+	for k, v := range m.vars {
+		vars[k] = v
+	}
+	return vars
+}
+
+// Fire 触发一个不带参数的事件
+func (m *Machine) Fire(event string) error {
+	return m.FireEvent(Event{Name: event})
+}
+
+// FireEvent 触发事件，找到第一条守卫通过的转换并执行
+// 执行顺序与 UML 相同：从内到外的退出动作 -> 转换动作 -> 从外到内的进入动作；转换动作出错时回到原来的状态
+func (m *Machine) FireEvent(e Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.findLocked(e)
+	if err != nil {
+		return err
+	}
+	return m.applyLocked(t, e)
+}
+
+// applyLocked 执行已经选定的转换
+// 转换动作执行时已经退出了源状态，出错时用 rollbackLocked 重新进入刚才退出的状态
+func (m *Machine) applyLocked(t *Transition, e Event) error {
+	from := m.current
+	scope := m.def.transitionScope(t)
+	timers := make(map[int]time.Time, len(m.timers))
+	for i, st := range m.timers {
+		timers[i] = st.deadline
+	}
+	history := maps.Clone(m.history)
+
+	m.exitLocked(scope, e)
+	if t.Action != nil {
+		if err := t.Action(m, e); err != nil {
+			m.rollbackLocked(scope, from, e, timers, history)
+			return fmt.Errorf("%s --%s--> %s: action %s: %w", t.From, e.Name, t.To, t.ActionName, err)
+		}
+	}
+	m.enterLocked(scope, t.To, e)
+	m.seq++
+	return m.recordLocked(from, e)
+}
+
+// Can 判断当前状态下事件能否触发转换
+func (m *Machine) Can(event string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.findLocked(Event{Name: event})
+	return err == nil
+}
+
+// findLocked 先在当前状态查找转换，找不到时逐层交给父状态处理
+// 超时转换只能由定时器触发，不参与查找
+func (m *Machine) findLocked(e Event) (*Transition, error) {
+	matched := false
+	for state := m.current; state != ""; state = m.def.States[state].Parent {
+		for i := range m.def.Transitions {
+			t := &m.def.Transitions[i]
+			if t.From != state || t.Event != e.Name || t.After > 0 {
+				continue
+			}
+			matched = true
+			if t.Guard == nil || t.Guard(m, e) {
+				return t, nil
+			}
+		}
+	}
+	if matched {
+		return nil, fmt.Errorf("%w: event %q in state %q", ErrGuardRejected, e.Name, m.current)
+	}
+	return nil, fmt.Errorf("%w: event %q in state %q", ErrInvalidTransition, e.Name, m.current)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGuardSelectionOrder(t *testing.T) {
+	var checked []string
+	guard := func(name string, pass bool) TransitionOption {
+		return WithGuard(name, func(*Machine, Event) bool {
+			checked = append(checked, name)
+			return pass
+		})
+	}
+	d := NewDefinition("guards", "idle").
+		Transition("idle", "go", "a", guard("first", false)).
+		Transition("idle", "go", "b", guard("second", true)).
+		Transition("idle", "go", "c")
+	m, err := NewMachine(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 按添加顺序检查守卫，第一条通过的转换生效，后面的不再检查
+	if err := m.Fire("go"); err != nil || m.Current() != "b" {
+		t.Fatalf("go: current = %s, err = %v; want b", m.Current(), err)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(checked, want) {
+		t.Fatalf("guards checked = %q, want %q", checked, want)
+	}
+}
+
+func TestFireErrors(t *testing.T) {
+	d := NewDefinition("errors", "idle").
+		Transition("idle", "go", "busy", WithGuard("ready", func(m *Machine, e Event) bool { return e.Data == "ready" }))
+	m, err := NewMachine(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		event   Event
+		want    error
+		message string
+	}{
+		{Event{Name: "stop"}, ErrInvalidTransition, `invalid transition: event "stop" in state "idle"`},
+		{Event{Name: "go"}, ErrGuardRejected, `transition rejected by guard: event "go" in state "idle"`},
+	}
+	for _, tt := range tests {
+		err := m.FireEvent(tt.event)
+		if !errors.Is(err, tt.want) || err.Error() != tt.message {
+			t.Errorf("%s: err = %v, want %q", tt.event.Name, err, tt.message)
+		}
+		if m.Can(tt.event.Name) {
+			t.Errorf("Can(%s) = true", tt.event.Name)
+		}
+	}
+	if m.Current() != "idle" || m.Snapshot().Seq != 0 {
+		t.Fatalf("after rejected events: current = %s, seq = %d; want idle, 0", m.Current(), m.Snapshot().Seq)
+	}
+	if err := m.FireEvent(Event{Name: "go", Data: "ready"}); err != nil || m.Current() != "busy" {
+		t.Fatalf("go with ready: current = %s, err = %v; want busy", m.Current(), err)
+	}
+}
+
+// TestActionErrorLeavesStateUnchanged 让转换动作在退出源状态之后出错：
+// 实例重新进入刚才退出的状态，超时转换保持原来的到期时间，转换不计数
+func TestActionErrorLeavesStateUnchanged(t *testing.T) {
+	var trace []string
+	record := func(s string) Hook {
+		return func(*Machine, Event) { trace = append(trace, s) }
+	}
+	errBoom := errors.New("boom")
+	d := NewDefinition("rollback", "P")
+	d.State("P").WithEntry("enter", record("enter P")).WithExit("exit", record("exit P")).WithHistory(HistoryShallow)
+	d.SubState("P", "P1").WithEntry("enter", record("enter P1")).WithExit("exit", record("exit P1"))
+	d.SubState("P", "P2")
+	d.After("P", time.Minute, "Q")
+	d.After("P1", 30*time.Second, "P2")
+	d.Transition("P1", "fail", "Q", WithAction("explode", func(*Machine, Event) error {
+		trace = append(trace, "action")
+		return errBoom
+	}))
+
+	start := time.Unix(0, 0)
+	clock := NewFakeClock(start)
+	m, err := NewMachine(d, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(20 * time.Second)
+	deadlines := m.Deadlines()
+
+	trace = nil
+	err = m.Fire("fail")
+	if !errors.Is(err, errBoom) || err.Error() != "P1 --fail--> Q: action explode: boom" {
+		t.Fatalf("Fire = %v, want the wrapped action error", err)
+	}
+	if want := []string{"exit P1", "exit P", "action", "enter P", "enter P1"}; !reflect.DeepEqual(trace, want) {
+		t.Fatalf("trace = %q, want %q", trace, want)
+	}
+	if m.Current() != "P1" || m.Snapshot().Seq != 0 {
+		t.Fatalf("current = %s, seq = %d; want P1, 0", m.Current(), m.Snapshot().Seq)
+	}
+	if got := m.Deadlines(); !reflect.DeepEqual(got, deadlines) {
+		t.Fatalf("deadlines = %v, want the original %v", got, deadlines)
+	}
+	if n := clock.Pending(); n != 2 {
+		t.Fatalf("%d clock timers, want 2", n)
+	}
+
+	// P1 的超时仍然在进入后 30 秒触发，而不是从回滚时重新计时
+	clock.Advance(10 * time.Second)
+	if m.Current() != "P2" {
+		t.Fatalf("30s after entering P1: current = %s, want P2", m.Current())
+	}
+}
+
+func TestContextPingPong(t *testing.T) {
+	c := NewContext()
+	for i, want := range []State{&ConcreteStateA{}, &ConcreteStateB{}, &ConcreteStateA{}} {
+		if i > 0 {
+			c.Request()
+		}
+		if got := c.State(); reflect.TypeOf(got) != reflect.TypeOf(want) {
+			t.Fatalf("after %d requests: state = %T, want %T", i, got, want)
+		}
+	}
+
+	// 多个 goroutine 同时发送请求，每个请求都切换一次状态
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Request()
+		}()
+	}
+	wg.Wait()
+	if seq := c.machine.Snapshot().Seq; seq != 52 {
+		t.Fatalf("%d transitions, want 52", seq)
+	}
+	if _, ok := c.State().(*ConcreteStateA); !ok {
+		t.Fatalf("after an even number of requests: state = %T, want A", c.State())
+	}
+}
+
+func TestTimedContextReturnsToA(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	c := NewTimedContext(time.Minute, WithClock(clock))
+	c.Request()
+	if _, ok := c.State().(*ConcreteStateB); !ok {
+		t.Fatalf("after a request: state = %T, want B", c.State())
+	}
+	clock.Advance(time.Minute)
+	if _, ok := c.State().(*ConcreteStateA); !ok {
+		t.Fatalf("idle in B: state = %T, want A", c.State())
+	}
+}
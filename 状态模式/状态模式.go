@@ -1,6 +1,14 @@
 package main
 
-import "fmt"
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // 状态模式
 // 状态模式允许一个对象在其内部状态改变时改变它的行为。对象看起来好像修改了它的类。
@@ -17,36 +25,283 @@ type ConcreteStateA struct{}
 
 func (s *ConcreteStateA) Handle(context *Context) {
 	fmt.Println("ConcreteStateA: Handling request.")
-	context.SetState(&ConcreteStateB{})
 }
 
 type ConcreteStateB struct{}
 
 func (s *ConcreteStateB) Handle(context *Context) {
 	fmt.Println("ConcreteStateB: Handling request.")
-	context.SetState(&ConcreteStateA{})
 }
 
+// Context 的状态切换交给状态机完成，State 只负责各自状态下的行为
+// 行为在 request 转换的动作中执行，和状态切换在同一把锁内完成，
+// 所以 Context 可以同时被多个 goroutine 和超时定时器驱动；Handle 中不能再调用 Request 或 State
 type Context struct {
-	state State
+	machine *Machine
+	states  map[string]State
 }
 
-func (c *Context) SetState(state State) {	
-	c.state = state
+// State 返回当前状态对应的行为
+func (c *Context) State() State {
+	return c.states[c.machine.Current()]
 }
 
 func (c *Context) Request() {
-	c.state.Handle(c)
+	c.machine.Fire("request")
 }
 
 func NewContext() *Context {
-	return &Context{state: &ConcreteStateA{}}
+	return NewTimedContext(0)
+}
+
+// NewTimedContext 创建的 Context 在 B 状态停留 idle 之后自动回到 A，idle 为 0 时不会自动回到 A
+func NewTimedContext(idle time.Duration, opts ...MachineOption) *Context {
+	c := &Context{states: map[string]State{"A": &ConcreteStateA{}, "B": &ConcreteStateB{}}}
+	handle := WithAction("handle", func(m *Machine, e Event) error {
+		c.states[m.current].Handle(c)
+		return nil
+	})
+	def := NewDefinition("ping-pong", "A").
+		Transition("A", "request", "B", handle).
+		Transition("B", "request", "A", handle)
+	if idle > 0 {
+		def.After("B", idle, "A")
+	}
+	machine, err := NewMachine(def, opts...)
+	if err != nil {
+		panic(err)
+	}
+	c.machine = machine
+	return c
 }
 
 func main() {
+	export := flag.String("export", "", "write the diagram of the named machine and exit, e.g. order or order-lifecycle")
+	format := flag.String("format", "mermaid", "diagram format: dot or mermaid")
+	output := flag.String("o", "-", "diagram output file, - for stdout")
+	validate := flag.String("validate", "", "analyze the named machine (or all) and exit, non-zero status on errors")
+	fired := flag.String("fired", "", "comma-separated events the application fires, used by -validate to report unused events")
+	flag.Parse()
+	if *validate != "" {
+		errorCount, err := ValidateCatalog(os.Stdout, *validate, *fired)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if errorCount > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	if *export != "" {
+		if err := ExportDiagram(*export, *format, *output); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	context := NewContext()
 	for i := 0; i < 5; i++ {
 		context.Request()
 	}
 	fmt.Println("")
+
+	// 带守卫和动作的订单状态机
+	order, err := NewMachine(NewOrderDefinition())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, e := range []Event{{Name: "ship"}, {Name: "pay", Data: 0}, {Name: "pay", Data: 42}, {Name: "ship"}, {Name: "deliver"}} {
+		if err := order.FireEvent(e); err != nil {
+			fmt.Println("error:", err)
+			continue
+		}
+		fmt.Printf("%s -> %s\n", e.Name, order.Current())
+	}
+	fmt.Println("vars:", order.Vars())
+	fmt.Println("")
+	WriteMermaid(os.Stdout, order.Definition())
+	fmt.Println("")
+
+	// 层次状态：active 下的事件冒泡，暂停后恢复到暂停前的子状态
+	lifecycle := NewOrderLifecycle(func(format string, args ...any) { fmt.Printf("  "+format+"\n", args...) })
+	life, err := NewMachine(lifecycle)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	audit := &MemoryAuditLog{}
+	life.SetID("order-1001")
+	life.SetAuditLog(audit)
+	fmt.Println("start:", life.ActivePath())
+	for _, e := range []string{"approve", "picked", "suspend", "resume", "packed", "cancel"} {
+		fmt.Println("fire", e)
+		if err := life.Fire(e); err != nil {
+			fmt.Println("  error:", err)
+			continue
+		}
+		fmt.Println("  now:", life.ActivePath())
+		if e == "suspend" {
+			// 暂停时保存实例，恢复时从快照继续
+			saved, _ := json.Marshal(life)
+			fmt.Println("  saved:", string(saved))
+			restored, err := RestoreMachineJSON(lifecycle, saved)
+			if err != nil {
+				fmt.Println("  restore failed:", err)
+				return
+			}
+			restored.SetAuditLog(audit)
+			life = restored
+		}
+	}
+	path, err := ReconstructPath(audit.Records())
+	fmt.Println("audit path:", path, err)
+	fmt.Println("")
+
+	timedTransitions()
+	fmt.Println("")
+
+	// 静态分析：故意写错的定义
+	broken := NewDefinition("broken", "draft").
+		Transition("draft", "submit", "review").
+		Transition("draft", "submit", "published").
+		Transition("review", "approve", "published", WithGuard("is editor", func(m *Machine, e Event) bool { return true })).
+		Transition("review", "approve", "archived", WithGuard("is admin", func(m *Machine, e Event) bool { return true })).
+		Transition("orphan", "restore", "draft")
+	findings, err := Analyze(broken, &AnalyzeOptions{Fired: []string{"submit", "approve"}})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	WriteFindings(os.Stdout, broken, findings)
+	for _, build := range machineCatalog {
+		if err := CheckDefinition(build(), nil); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// timedTransitions 演示超时转换：用 FakeClock 控制时间，不需要真的等待
+func timedTransitions() {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC))
+
+	// 一个订单及时付款，另一个超时取消
+	paid, _ := NewMachine(NewOrderDefinition(), WithClock(clock))
+	expired, _ := NewMachine(NewOrderDefinition(), WithClock(clock))
+	fmt.Println("deadlines:", expired.Deadlines())
+	clock.Advance(10 * time.Minute)
+	paid.FireEvent(Event{Name: "pay", Data: 42})
+	clock.Advance(20 * time.Minute)
+	fmt.Println("paid order:", paid.Current(), "expired order:", expired.Current(), expired.Vars())
+
+	// 保存时的到期时间在恢复后继续有效
+	pending, _ := NewMachine(NewOrderDefinition(), WithClock(clock))
+	clock.Advance(25 * time.Minute)
+	saved, _ := json.Marshal(pending)
+	pending.Stop()
+	restored, err := RestoreMachineJSON(NewOrderDefinition(), saved, WithClock(clock))
+	if err != nil {
+		fmt.Println("restore failed:", err)
+		return
+	}
+	clock.Advance(5 * time.Minute)
+	fmt.Println("restored order after 30m in total:", restored.Current())
+
+	// 多个 goroutine 调用 Request 的同时，定时器也在把 B 切回 A
+	context := NewTimedContext(time.Second, WithClock(clock))
+	var handled atomic.Int64
+	context.states = map[string]State{"A": countingState{&handled}, "B": countingState{&handled}}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 250; j++ {
+				context.Request()
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 100; j++ {
+			clock.Advance(time.Second)
+		}
+	}()
+	wg.Wait()
+	context.machine.Stop()
+	fmt.Println("concurrent requests handled:", handled.Load(), "pending timers:", clock.Pending())
+}
+
+// countingState 只计数不打印，用于并发演示
+type countingState struct {
+	handled *atomic.Int64
+}
+
+func (s countingState) Handle(context *Context) {
+	s.handled.Add(1)
+}
+
+// NewOrderDefinition 返回带守卫和动作的订单状态机定义
+func NewOrderDefinition() *Definition {
+	orders := NewDefinition("order", "created").
+		Transition("created", "pay", "paid",
+			WithGuard("amount > 0", func(m *Machine, e Event) bool {
+				amount, _ := e.Data.(int)
+				return amount > 0
+			}),
+			WithAction("record payment", func(m *Machine, e Event) error {
+				m.SetVar("paid", e.Data)
+				return nil
+			})).
+		Transition("created", "cancel", "cancelled").
+		// 30 分钟内没有付款自动取消
+		After("created", 30*time.Minute, "cancelled",
+			WithAction("expire", func(m *Machine, e Event) error {
+				m.SetVar("expired_at", e.Data)
+				return nil
+			})).
+		Transition("paid", "ship", "shipped").
+		Transition("shipped", "deliver", "delivered")
+	orders.FinalState("cancelled")
+	orders.FinalState("delivered")
+	return orders
+}
+
+// NewOrderLifecycle 返回订单生命周期的层次状态机定义
+//
+//	active
+//	├── pending
+//	└── processing (深历史)
+//	    ├── picking
+//	    └── packing
+//	suspended
+//	shipped、cancelled（终止状态）
+func NewOrderLifecycle(log func(format string, args ...any)) *Definition {
+	d := NewDefinition("order-lifecycle", "active")
+	hooks := func(s *StateConfig) {
+		name := s.Name
+		s.WithEntry("log entry", func(m *Machine, e Event) { log("enter %s", name) })
+		s.WithExit("log exit", func(m *Machine, e Event) { log("exit %s", name) })
+	}
+	hooks(d.State("active").WithHistory(HistoryDeep))
+	hooks(d.SubState("active", "pending"))
+	hooks(d.SubState("active", "processing"))
+	hooks(d.SubState("processing", "picking"))
+	hooks(d.SubState("processing", "packing"))
+	hooks(d.State("suspended"))
+	d.FinalState("shipped")
+	d.FinalState("cancelled")
+
+	d.Transition("pending", "approve", "processing").
+		Transition("picking", "picked", "packing").
+		Transition("packing", "packed", "shipped").
+		// 下面两条定义在父状态上，任何子状态都可以触发
+		Transition("active", "suspend", "suspended").
+		Transition("active", "cancel", "cancelled").
+		Transition("suspended", "resume", "active").
+		Transition("suspended", "cancel", "cancelled")
+	return d
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// 策略注册表
+// 策略按名称注册，调用方只需要知道名称（例如来自命令行参数或配置文件），不需要直接构造具体的策略。
+
+var (
+	ErrDivisionByZero   = errors.New("division by zero")
+	ErrOverflow         = errors.New("integer overflow")
+	ErrNegativeExponent = errors.New("negative exponent")
+	ErrNoStrategy       = errors.New("no strategy set")
+	ErrUnknownStrategy  = errors.New("unknown strategy")
+)
+
+// StrategyRegistry 保存名称到策略的映射，可以并发使用
+type StrategyRegistry struct {
+	mu         sync.RWMutex
+	strategies map[string]Strategy
+}
+
+func NewStrategyRegistry() *StrategyRegistry {
+	return &StrategyRegistry{strategies: map[string]Strategy{}}
+}
+
+// NewDefaultStrategyRegistry 返回注册了全部算术策略的注册表
+func NewDefaultStrategyRegistry() *StrategyRegistry {
+	r := NewStrategyRegistry()
+	r.Register("add", &AddOperation{})
+	r.Register("sub", &SubtractOperation{})
+	r.Register("mul", &MultiplyOperation{})
+	r.Register("div", &DivideOperation{})
+	r.Register("mod", &ModOperation{})
+	r.Register("pow", &PowOperation{})
+	return r
+}
+
+// Register 注册策略，同名注册会覆盖之前的策略
+func (r *StrategyRegistry) Register(name string, strategy Strategy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.strategies[name] = strategy
+}
+
+// Get 按名称查找策略
+func (r *StrategyRegistry) Get(name string) (Strategy, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	strategy, ok := r.strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownStrategy, name)
+	}
+	return strategy, nil
+}
+
+// Names 返回已注册的策略名称，按字母排序
+func (r *StrategyRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.strategies))
+	for name := range r.strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StrategyConfig 是选择策略的配置文件格式
+type StrategyConfig struct {
+	Op string `json:"op"`
+}
+
+// LoadStrategyName 从 JSON 配置文件中读取策略名称
+func LoadStrategyName(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var config StrategyConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", fmt.Errorf("parse %s: %w", path, err)
+	}
+	if config.Op == "" {
+		return "", fmt.Errorf("%s: missing \"op\"", path)
+	}
+	return config.Op, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStrategyRegistry(t *testing.T) {
+	r := NewDefaultStrategyRegistry()
+	if got, want := r.Names(), []string{"add", "div", "mod", "mul", "pow", "sub"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Names = %v, want %v", got, want)
+	}
+
+	_, err := r.Get("avg")
+	if !errors.Is(err, ErrUnknownStrategy) || err.Error() != `unknown strategy "avg"` {
+		t.Fatalf("Get(avg) error = %v, want ErrUnknownStrategy naming avg", err)
+	}
+
+	r.Register("avg", StrategyFunc(func(a, b int) (int, error) { return (a + b) / 2, nil }))
+	// 同名注册覆盖之前的策略
+	r.Register("add", StrategyFunc(func(a, b int) (int, error) { return 0, ErrOverflow }))
+	if got := len(r.Names()); got != 7 {
+		t.Fatalf("%d names after registering avg, want 7", got)
+	}
+	avg, err := r.Get("avg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := avg.DoOperation(3, 5); got != 4 {
+		t.Fatalf("avg(3, 5) = %d, want 4", got)
+	}
+	add, _ := r.Get("add")
+	if _, err := add.DoOperation(1, 1); !errors.Is(err, ErrOverflow) {
+		t.Fatal("Register did not replace add")
+	}
+}
+
+func TestLoadStrategyName(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	name, err := LoadStrategyName(write("ok.json", `{"op": "div"}`))
+	if err != nil || name != "div" {
+		t.Fatalf("LoadStrategyName = %q, %v; want div", name, err)
+	}
+
+	if _, err := LoadStrategyName(filepath.Join(dir, "missing.json")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("missing file: err = %v, want fs.ErrNotExist", err)
+	}
+	for _, tt := range []struct {
+		file, content, want string
+	}{
+		{"bad.json", `{"op": `, "parse "},
+		{"wrong-type.json", `{"op": 1}`, "parse "},
+		{"empty.json", `{}`, `missing "op"`},
+	} {
+		_, err := LoadStrategyName(write(tt.file, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) || !strings.Contains(err.Error(), tt.file) {
+			t.Errorf("%s: err = %v, want an error mentioning %q and the file", tt.file, err, tt.want)
+		}
+	}
+}
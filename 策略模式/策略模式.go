@@ -1,31 +1,110 @@
 package main
 
-import "fmt"
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+)
 
 // 策略模式
 // 策略模式定义了一系列算法,把它们一个个封装起来,并且使它们可以互相替换。
 // 策略模式让算法的变化独立于使用算法的客户。
 
 type Strategy interface {
-	DoOperation(int, int) int
+	DoOperation(int, int) (int, error)
 }
 
 type AddOperation struct{}
 
-func (a *AddOperation) DoOperation(num1, num2 int) int {
-	return num1 + num2
+func (a *AddOperation) DoOperation(num1, num2 int) (int, error) {
+	result := num1 + num2
+	// 同号相加结果却变号，说明溢出
+	if (num1 > 0 && num2 > 0 && result < 0) || (num1 < 0 && num2 < 0 && result >= 0) {
+		return 0, fmt.Errorf("%d + %d: %w", num1, num2, ErrOverflow)
+	}
+	return result, nil
 }
 
 type SubtractOperation struct{}
 
-func (s *SubtractOperation) DoOperation(num1, num2 int) int {
-	return num1 - num2
+func (s *SubtractOperation) DoOperation(num1, num2 int) (int, error) {
+	result := num1 - num2
+	if (num1 >= 0 && num2 < 0 && result < 0) || (num1 < 0 && num2 > 0 && result >= 0) {
+		return 0, fmt.Errorf("%d - %d: %w", num1, num2, ErrOverflow)
+	}
+	return result, nil
 }
 
 type MultiplyOperation struct{}
 
-func (m *MultiplyOperation) DoOperation(num1, num2 int) int {
-	return num1 * num2
+func (m *MultiplyOperation) DoOperation(num1, num2 int) (int, error) {
+	result, ok := mulChecked(num1, num2)
+	if !ok {
+		return 0, fmt.Errorf("%d * %d: %w", num1, num2, ErrOverflow)
+	}
+	return result, nil
+}
+
+type DivideOperation struct{}
+
+func (d *DivideOperation) DoOperation(num1, num2 int) (int, error) {
+	if num2 == 0 {
+		return 0, fmt.Errorf("%d / %d: %w", num1, num2, ErrDivisionByZero)
+	}
+	if num1 == math.MinInt && num2 == -1 {
+		return 0, fmt.Errorf("%d / %d: %w", num1, num2, ErrOverflow)
+	}
+	return num1 / num2, nil
+}
+
+type ModOperation struct{}
+
+func (m *ModOperation) DoOperation(num1, num2 int) (int, error) {
+	if num2 == 0 {
+		return 0, fmt.Errorf("%d %% %d: %w", num1, num2, ErrDivisionByZero)
+	}
+	if num2 == -1 {
+		return 0, nil
+	}
+	return num1 % num2, nil
+}
+
+// PowOperation 计算 num1 的 num2 次方，指数必须非负
+type PowOperation struct{}
+
+func (p *PowOperation) DoOperation(num1, num2 int) (int, error) {
+	if num2 < 0 {
+		return 0, fmt.Errorf("%d ^ %d: %w", num1, num2, ErrNegativeExponent)
+	}
+	result, base := 1, num1
+	for exp := num2; exp > 0; exp >>= 1 {
+		var ok bool
+		if exp&1 == 1 {
+			if result, ok = mulChecked(result, base); !ok {
+				return 0, fmt.Errorf("%d ^ %d: %w", num1, num2, ErrOverflow)
+			}
+		}
+		if exp > 1 {
+			if base, ok = mulChecked(base, base); !ok {
+				return 0, fmt.Errorf("%d ^ %d: %w", num1, num2, ErrOverflow)
+			}
+		}
+	}
+	return result, nil
+}
+
+// mulChecked 返回乘积，溢出时 ok 为 false
+func mulChecked(a, b int) (int, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	result := a * b
+	if result/b != a || (a == -1 && b == math.MinInt) || (b == -1 && a == math.MinInt) {
+		return 0, false
+	}
+	return result, true
 }
 
 type Context struct {
@@ -36,11 +115,67 @@ func (c *Context) SetStrategy(strategy Strategy) {
 	c.strategy = strategy
 }
 
-func (c *Context) ExecuteStrategy(num1, num2 int) int {
+// SetStrategyByName 从注册表中按名称选择策略
+func (c *Context) SetStrategyByName(registry *StrategyRegistry, name string) error {
+	strategy, err := registry.Get(name)
+	if err != nil {
+		return err
+	}
+	c.strategy = strategy
+	return nil
+}
+
+func (c *Context) ExecuteStrategy(num1, num2 int) (int, error) {
+	if c.strategy == nil {
+		return 0, ErrNoStrategy
+	}
 	return c.strategy.DoOperation(num1, num2)
 }
 
 func main() {
+	op := flag.String("op", "", "strategy name, one of the registered strategies")
+	config := flag.String("config", "", `JSON config file like {"op": "div"}`)
+	a := flag.Int("a", 10, "first operand")
+	b := flag.Int("b", 5, "second operand")
+	tracePath := flag.String("trace", "", "replay a recorded cache access trace (one key per line) against every eviction policy")
+	flag.Parse()
+
+	registry := NewDefaultStrategyRegistry()
+
+	if *tracePath != "" {
+		trace, err := LoadTrace(*tracePath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		compareEvictionPolicies(trace, 100)
+		return
+	}
+
+	// 通过命令行或配置文件选择策略，例如 -op div -a 10 -b 0
+	if *op != "" || *config != "" {
+		name := *op
+		if name == "" {
+			var err error
+			if name, err = LoadStrategyName(*config); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		context := &Context{}
+		if err := context.SetStrategyByName(registry, name); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		result, err := context.ExecuteStrategy(*a, *b)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(result)
+		return
+	}
+
 	num1 := 10
 	num2 := 5
 
@@ -48,13 +183,179 @@ func main() {
 
 	add := &AddOperation{}
 	context.SetStrategy(add)
-	fmt.Printf("10 + 5 = %d\n", context.ExecuteStrategy(num1, num2))
+	result, _ := context.ExecuteStrategy(num1, num2)
+	fmt.Printf("10 + 5 = %d\n", result)
 
 	subtract := &SubtractOperation{}
 	context.SetStrategy(subtract)
-	fmt.Printf("10 - 5 = %d\n", context.ExecuteStrategy(num1, num2))
+	result, _ = context.ExecuteStrategy(num1, num2)
+	fmt.Printf("10 - 5 = %d\n", result)
 
 	multiply := &MultiplyOperation{}
 	context.SetStrategy(multiply)
-	fmt.Printf("10 * 5 = %d\n", context.ExecuteStrategy(num1, num2))
+	result, _ = context.ExecuteStrategy(num1, num2)
+	fmt.Printf("10 * 5 = %d\n", result)
+
+	// 按名称选择策略，错误通过返回值报告
+	fmt.Println("registered strategies:", registry.Names())
+	for _, c := range []struct {
+		name       string
+		num1, num2 int
+	}{
+		{"div", 10, 5},
+		{"div", 10, 0},
+		{"mod", 10, 3},
+		{"pow", 2, 10},
+		{"pow", 10, 30},
+		{"sqrt", 9, 0},
+	} {
+		if err := context.SetStrategyByName(registry, c.name); err != nil {
+			fmt.Println("error:", err)
+			continue
+		}
+		result, err := context.ExecuteStrategy(c.num1, c.num2)
+		if err != nil {
+			fmt.Println("error:", err)
+			continue
+		}
+		fmt.Printf("%s(%d, %d) = %d\n", c.name, c.num1, c.num2, result)
+	}
+
+	// 运行时选择策略：大指数先尝试精确计算，溢出时退回饱和计算；除数为 0 时走保护策略
+	saturating := NamedStrategy{Name: "saturate", Strategy: StrategyFunc(func(num1, num2 int) (int, error) {
+		if num1 < 0 && num2%2 == 1 {
+			return math.MinInt, nil
+		}
+		return math.MaxInt, nil
+	})}
+	powWithFallback := NewFallbackSelector(MustNamed(registry, "pow"), saturating)
+	rules := NewRuleSelector(MustNamed(registry, "div"),
+		SelectionRule{
+			Match:    func(num1, num2 int) bool { return num2 == 0 },
+			Strategy: NamedStrategy{Name: "zero-guard", Strategy: StrategyFunc(func(int, int) (int, error) { return 0, nil })},
+		},
+		SelectionRule{
+			Match:    func(num1, num2 int) bool { return num2 > 16 },
+			Strategy: NamedStrategy{Name: "pow-fallback", Strategy: powWithFallback},
+		},
+	)
+	context.SetStrategy(rules)
+	for _, in := range [][2]int{{10, 2}, {10, 0}, {2, 20}, {10, 40}} {
+		result, servedBy, err := rules.DoOperationTraced(in[0], in[1])
+		fmt.Printf("select(%d, %d) = %d served by %s err=%v\n", in[0], in[1], result, servedBy, err)
+	}
+	fmt.Println("rule counters:", rules.FormatCounts())
+	fmt.Println("fallback counters:", powWithFallback.FormatCounts())
+
+	// A/B 实验：90% 走 mul，10% 走用加法实现的乘法
+	addLoop := NamedStrategy{Name: "mul-by-add", Strategy: StrategyFunc(func(num1, num2 int) (int, error) {
+		result := 0
+		for i := 0; i < num2; i++ {
+			result += num1
+		}
+		return result, nil
+	})}
+	experiment, _ := NewWeightedSelector(1,
+		WeightedChoice{Weight: 90, Strategy: MustNamed(registry, "mul")},
+		WeightedChoice{Weight: 10, Strategy: addLoop},
+	)
+	for i := 0; i < 1000; i++ {
+		experiment.DoOperation(3, 4)
+	}
+	fmt.Println("experiment counters:", experiment.FormatCounts())
+
+	// 负载均衡：同一个 Balancer 换不同的策略
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user-%d", i)
+	}
+	backends := []*Backend{NewBackend("a", 5), NewBackend("b", 1), NewBackend("c", 1)}
+	balancer := NewBalancer(&RoundRobin{}, backends...)
+	for _, s := range []struct {
+		name     string
+		strategy BalanceStrategy
+	}{
+		{"round-robin", &RoundRobin{}},
+		{"weighted", &WeightedRoundRobin{}},
+		{"least-conn", LeastConnections{}},
+		{"two-choices", NewPowerOfTwoChoices(1)},
+		{"consistent-hash", NewConsistentHash(100)},
+	} {
+		balancer.SetStrategy(s.strategy)
+		counts, _ := Distribution(balancer, keys)
+		fmt.Printf("%-16s %s\n", s.name, FormatDistribution(counts))
+	}
+
+	// 最少连接：占用 a 的连接后，新请求会落到其他后端
+	balancer.SetStrategy(LeastConnections{})
+	_, release, _ := balancer.Acquire("")
+	next, _ := balancer.Pick("")
+	fmt.Println("a busy, least-conn picks:", next.Name)
+	release()
+
+	// 一致性哈希：摘掉一个后端后，只有原来落在它上面的 key 会迁移
+	hash := NewConsistentHash(100)
+	balancer.SetStrategy(hash)
+	before := map[string]string{}
+	for _, key := range keys {
+		b, _ := balancer.Pick(key)
+		before[key] = b.Name
+	}
+	balancer.MarkHealthy("c", false)
+	moved := 0
+	for _, key := range keys {
+		b, _ := balancer.Pick(key)
+		if before[key] != b.Name {
+			moved++
+			if before[key] != "c" {
+				fmt.Println("unexpected move:", key)
+			}
+		}
+	}
+	fmt.Printf("c marked unhealthy: %d of %d keys moved\n", moved, len(keys))
+
+	// 缓存淘汰策略：在同一条访问序列上比较命中率
+	fmt.Println("zipf workload:")
+	compareEvictionPolicies(zipfTrace(50000, 1000, 1), 100)
+	fmt.Println("zipf workload mixed with a one-off scan:")
+	compareEvictionPolicies(scanTrace(zipfTrace(50000, 1000, 2), 20000), 100)
+}
+
+// compareEvictionPolicies 用每种淘汰策略回放同一条访问序列并输出命中率
+func compareEvictionPolicies(trace []string, capacity int) {
+	value := func(key string) []byte { return []byte(key) }
+	for _, p := range []struct {
+		name   string
+		policy EvictionPolicy
+	}{
+		{"LRU", NewLRUPolicy()},
+		{"LFU", NewLFUPolicy()},
+		{"FIFO", NewFIFOPolicy()},
+		{"ARC", NewARCPolicy(capacity)},
+		{"TinyLFU", NewTinyLFUPolicy(capacity)},
+	} {
+		stats := ReplayTrace(NewCache(p.policy, capacity, 0), trace, value)
+		fmt.Printf("  %-8s %s\n", p.name, stats)
+	}
+}
+
+// zipfTrace 生成服从 Zipf 分布的访问序列，少数热点 key 占大部分访问
+func zipfTrace(n, keys int, seed int64) []string {
+	r := rand.New(rand.NewSource(seed))
+	zipf := rand.NewZipf(r, 1.1, 1, uint64(keys-1))
+	trace := make([]string, n)
+	for i := range trace {
+		trace[i] = fmt.Sprintf("k%d", zipf.Uint64())
+	}
+	return trace
+}
+
+// scanTrace 在访问序列中间插入一次性的顺序扫描，扫描的 key 之后不会再被访问
+func scanTrace(trace []string, scan int) []string {
+	mid := len(trace) / 2
+	out := append([]string(nil), trace[:mid]...)
+	for i := 0; i < scan; i++ {
+		out = append(out, fmt.Sprintf("scan%d", i))
+	}
+	return append(out, trace[mid:]...)
 }
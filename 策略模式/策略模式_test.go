@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestOperations(t *testing.T) {
+	tests := []struct {
+		op         string
+		num1, num2 int
+		want       int
+		err        error
+	}{
+		{"add", 2, 3, 5, nil},
+		{"add", math.MaxInt, 1, 0, ErrOverflow},
+		{"add", math.MinInt, -1, 0, ErrOverflow},
+		{"add", math.MaxInt, math.MinInt, -1, nil},
+		{"sub", 2, 3, -1, nil},
+		{"sub", math.MinInt, 1, 0, ErrOverflow},
+		{"sub", math.MaxInt, -1, 0, ErrOverflow},
+		{"sub", 0, math.MinInt, 0, ErrOverflow},
+		{"sub", -1, math.MinInt, math.MaxInt, nil},
+		{"mul", -4, 5, -20, nil},
+		{"mul", math.MaxInt, 2, 0, ErrOverflow},
+		{"mul", math.MinInt, -1, 0, ErrOverflow},
+		{"mul", -1, math.MinInt, 0, ErrOverflow},
+		{"mul", math.MinInt, 1, math.MinInt, nil},
+		{"mul", 0, math.MinInt, 0, nil},
+		{"div", -7, 2, -3, nil},
+		{"div", 7, 0, 0, ErrDivisionByZero},
+		{"div", math.MinInt, -1, 0, ErrOverflow},
+		{"div", math.MinInt, 1, math.MinInt, nil},
+		{"mod", -7, 3, -1, nil},
+		{"mod", 7, 0, 0, ErrDivisionByZero},
+		{"mod", math.MinInt, -1, 0, nil},
+		{"pow", 2, 10, 1024, nil},
+		{"pow", 0, 0, 1, nil},
+		{"pow", 2, 62, 1 << 62, nil},
+		{"pow", 2, 63, 0, ErrOverflow},
+		{"pow", -2, 63, math.MinInt, nil},
+		{"pow", 3, 40, 0, ErrOverflow},
+		{"pow", -1, math.MaxInt, -1, nil},
+		{"pow", 2, -1, 0, ErrNegativeExponent},
+	}
+	registry := NewDefaultStrategyRegistry()
+	for _, tt := range tests {
+		strategy, err := registry.Get(tt.op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := strategy.DoOperation(tt.num1, tt.num2)
+		if got != tt.want || !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+			t.Errorf("%s(%d, %d) = %d, %v; want %d, %v", tt.op, tt.num1, tt.num2, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestContextStrategy(t *testing.T) {
+	var c Context
+	if _, err := c.ExecuteStrategy(1, 2); !errors.Is(err, ErrNoStrategy) {
+		t.Fatalf("no strategy: err = %v, want ErrNoStrategy", err)
+	}
+	registry := NewDefaultStrategyRegistry()
+	if err := c.SetStrategyByName(registry, "mul"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetStrategyByName(registry, "xor"); !errors.Is(err, ErrUnknownStrategy) {
+		t.Fatalf("unknown name: err = %v, want ErrUnknownStrategy", err)
+	}
+	// 选择失败时保留原来的策略
+	if got, err := c.ExecuteStrategy(6, 7); got != 42 || err != nil {
+		t.Fatalf("6 * 7 = %d, %v; want 42 from the previous strategy", got, err)
+	}
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"bufio"
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+	"sync"
+)
+
+// 可替换淘汰策略的缓存
+// Cache 相当于策略模式中的 Context，负责存储、容量统计和命中率统计；
+// 容量不够时该淘汰哪个 key 由 EvictionPolicy 决定。
+// 策略只跟踪 key，不保存值，因此同一个策略实现可以用在不同的缓存上。
+
+// EvictionPolicy 是缓存淘汰策略
+type EvictionPolicy interface {
+	// OnAccess 在命中时调用
+	OnAccess(key string)
+	// OnInsert 在新 key 写入时调用
+	OnInsert(key string)
+	// OnRemove 在 key 被删除或淘汰后调用
+	OnRemove(key string)
+	// Victim 返回下一个应该被淘汰的 key，跳过 exclude（正在写入、必须保留的 key）；
+	// 只是查询，不能改变策略的状态
+	Victim(exclude string) (string, bool)
+}
+
+// AdmissionPolicy 是可选接口，策略可以拒绝新 key 进入缓存（例如 TinyLFU）
+type AdmissionPolicy interface {
+	// Admit 在缓存已满、需要淘汰 victim 才能放入 candidate 时调用，返回 false 表示不放入 candidate
+	Admit(candidate, victim string) bool
+}
+
+// MissObserver 是可选接口，策略可以观察未命中的 key（例如 ARC 的幽灵列表）
+type MissObserver interface {
+	OnMiss(key string)
+}
+
+// CacheStats 是命中率统计
+type CacheStats struct {
+	Hits      int
+	Misses    int
+	Evictions int
+	Rejected  int // 被准入策略拒绝的写入
+}
+
+func (s CacheStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+func (s CacheStats) String() string {
+	return fmt.Sprintf("hits=%d misses=%d evictions=%d rejected=%d hit-ratio=%.3f",
+		s.Hits, s.Misses, s.Evictions, s.Rejected, s.HitRatio())
+}
+
+// Cache 是按条数和/或字节数限制容量的缓存，限制为 0 表示不限制
+type Cache struct {
+	mu       sync.Mutex
+	policy   EvictionPolicy
+	maxItems int
+	maxBytes int
+	bytes    int
+	items    map[string][]byte
+	stats    CacheStats
+}
+
+func NewCache(policy EvictionPolicy, maxItems, maxBytes int) *Cache {
+	return &Cache{policy: policy, maxItems: maxItems, maxBytes: maxBytes, items: map[string][]byte{}}
+}
+
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		if o, ok := c.policy.(MissObserver); ok {
+			o.OnMiss(key)
+		}
+		return nil, false
+	}
+	c.stats.Hits++
+	c.policy.OnAccess(key)
+	return value, true
+}
+
+// Set 写入 key，必要时按策略淘汰旧 key；单个值超过字节上限或被准入策略拒绝时不写入，返回 false
+func (c *Cache) Set(key string, value []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.maxBytes > 0 && len(value) > c.maxBytes {
+		return false
+	}
+	if old, ok := c.items[key]; ok {
+		c.bytes += len(value) - len(old)
+		c.items[key] = value
+		c.policy.OnAccess(key)
+		c.evictLocked(key)
+		return true
+	}
+
+	// 准入只判断一次，拒绝时不淘汰任何 key
+	if c.overflowLocked(1, len(value)) {
+		if a, ok := c.policy.(AdmissionPolicy); ok {
+			victim, ok := c.policy.Victim(key)
+			if !ok {
+				return false
+			}
+			if !a.Admit(key, victim) {
+				c.stats.Rejected++
+				return false
+			}
+		}
+	}
+	for c.overflowLocked(1, len(value)) {
+		victim, ok := c.policy.Victim(key)
+		if !ok {
+			return false
+		}
+		c.removeLocked(victim)
+		c.stats.Evictions++
+	}
+	c.items[key] = value
+	c.bytes += len(value)
+	c.policy.OnInsert(key)
+	return true
+}
+
+// evictLocked 在 keep 的值变大后淘汰其他 key，直到满足容量限制
+func (c *Cache) evictLocked(keep string) {
+	for c.overflowLocked(0, 0) {
+		victim, ok := c.policy.Victim(keep)
+		if !ok {
+			break
+		}
+		c.removeLocked(victim)
+		c.stats.Evictions++
+	}
+}
+
+// overflowLocked 判断再放入 items 个、共 bytes 字节的值是否会超出容量
+func (c *Cache) overflowLocked(items, bytes int) bool {
+	if c.maxItems > 0 && len(c.items)+items > c.maxItems {
+		return true
+	}
+	return c.maxBytes > 0 && c.bytes+bytes > c.maxBytes
+}
+
+func (c *Cache) removeLocked(key string) {
+	value, ok := c.items[key]
+	if !ok {
+		return
+	}
+	delete(c.items, key)
+	c.bytes -= len(value)
+	c.policy.OnRemove(key)
+}
+
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(key)
+}
+
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// keyList 是带索引的双向链表，支持 O(1) 的移动和删除
+type keyList struct {
+	l     *list.List
+	index map[string]*list.Element
+}
+
+func newKeyList() *keyList {
+	return &keyList{l: list.New(), index: map[string]*list.Element{}}
+}
+
+func (k *keyList) pushFront(key string) {
+	if e, ok := k.index[key]; ok {
+		k.l.MoveToFront(e)
+		return
+	}
+	k.index[key] = k.l.PushFront(key)
+}
+
+func (k *keyList) remove(key string) bool {
+	e, ok := k.index[key]
+	if ok {
+		k.l.Remove(e)
+		delete(k.index, key)
+	}
+	return ok
+}
+
+func (k *keyList) contains(key string) bool {
+	_, ok := k.index[key]
+	return ok
+}
+
+func (k *keyList) back() (string, bool) {
+	if e := k.l.Back(); e != nil {
+		return e.Value.(string), true
+	}
+	return "", false
+}
+
+// backExcept 返回最后一个不是 exclude 的 key
+func (k *keyList) backExcept(exclude string) (string, bool) {
+	e := k.l.Back()
+	if e != nil && e.Value.(string) == exclude {
+		e = e.Prev()
+	}
+	if e == nil {
+		return "", false
+	}
+	return e.Value.(string), true
+}
+
+func (k *keyList) len() int {
+	return k.l.Len()
+}
+
+// LRUPolicy 淘汰最久没有访问的 key
+type LRUPolicy struct {
+	keys *keyList
+}
+
+func NewLRUPolicy() *LRUPolicy {
+	return &LRUPolicy{keys: newKeyList()}
+}
+
+func (p *LRUPolicy) OnAccess(key string)                  { p.keys.pushFront(key) }
+func (p *LRUPolicy) OnInsert(key string)                  { p.keys.pushFront(key) }
+func (p *LRUPolicy) OnRemove(key string)                  { p.keys.remove(key) }
+func (p *LRUPolicy) Victim(exclude string) (string, bool) { return p.keys.backExcept(exclude) }
+
+// FIFOPolicy 淘汰最早写入的 key，访问不影响顺序
+type FIFOPolicy struct {
+	keys *keyList
+}
+
+func NewFIFOPolicy() *FIFOPolicy {
+	return &FIFOPolicy{keys: newKeyList()}
+}
+
+func (p *FIFOPolicy) OnAccess(key string)                  {}
+func (p *FIFOPolicy) OnInsert(key string)                  { p.keys.pushFront(key) }
+func (p *FIFOPolicy) OnRemove(key string)                  { p.keys.remove(key) }
+func (p *FIFOPolicy) Victim(exclude string) (string, bool) { return p.keys.backExcept(exclude) }
+
+// LFUPolicy 淘汰访问次数最少的 key，次数相同时淘汰其中最久没有访问的
+// 每个访问次数对应一个 LRU 链表，minFreq 记录当前最小的访问次数，所有操作都是 O(1)
+type LFUPolicy struct {
+	freq    map[string]int
+	buckets map[int]*keyList
+	minFreq int
+}
+
+func NewLFUPolicy() *LFUPolicy {
+	return &LFUPolicy{freq: map[string]int{}, buckets: map[int]*keyList{}}
+}
+
+func (p *LFUPolicy) bucket(freq int) *keyList {
+	b, ok := p.buckets[freq]
+	if !ok {
+		b = newKeyList()
+		p.buckets[freq] = b
+	}
+	return b
+}
+
+func (p *LFUPolicy) OnAccess(key string) {
+	f, ok := p.freq[key]
+	if !ok {
+		return
+	}
+	p.buckets[f].remove(key)
+	if p.buckets[f].len() == 0 {
+		delete(p.buckets, f)
+		if p.minFreq == f {
+			p.minFreq = f + 1
+		}
+	}
+	p.freq[key] = f + 1
+	p.bucket(f + 1).pushFront(key)
+}
+
+func (p *LFUPolicy) OnInsert(key string) {
+	p.freq[key] = 1
+	p.bucket(1).pushFront(key)
+	p.minFreq = 1
+}
+
+func (p *LFUPolicy) OnRemove(key string) {
+	f, ok := p.freq[key]
+	if !ok {
+		return
+	}
+	delete(p.freq, key)
+	p.buckets[f].remove(key)
+	if p.buckets[f].len() == 0 {
+		delete(p.buckets, f)
+	}
+}
+
+func (p *LFUPolicy) Victim(exclude string) (string, bool) {
+	if len(p.freq) == 0 {
+		return "", false
+	}
+	// 删除操作可能让 minFreq 对应的链表变空，这里向上找到第一个非空链表
+	for {
+		if _, ok := p.buckets[p.minFreq]; ok {
+			break
+		}
+		p.minFreq++
+	}
+	if key, ok := p.buckets[p.minFreq].backExcept(exclude); ok {
+		return key, true
+	}
+	// 最小访问次数的链表中只有 exclude，从其余链表中找访问次数最少的
+	next := 0
+	for f := range p.buckets {
+		if f > p.minFreq && (next == 0 || f < next) {
+			next = f
+		}
+	}
+	if next == 0 {
+		return "", false
+	}
+	return p.buckets[next].back()
+}
+
+// ARCPolicy 自适应替换缓存
+// T1 保存只访问过一次的 key，T2 保存访问过多次的 key；B1、B2 是从 T1、T2 淘汰出去的幽灵 key。
+// 未命中的 key 如果出现在 B1，说明 T1 太小，目标大小 p 增大；出现在 B2 则 p 减小。
+type ARCPolicy struct {
+	capacity       int
+	p              int
+	t1, t2, b1, b2 *keyList
+	ghostHit       int // 最近一次未命中落在哪个幽灵列表：1 为 B1，2 为 B2
+	pendingGhost   string
+}
+
+// NewARCPolicy 的 capacity 应与缓存的条数上限一致，用来限制幽灵列表的长度
+func NewARCPolicy(capacity int) *ARCPolicy {
+	return &ARCPolicy{capacity: max(capacity, 1), t1: newKeyList(), t2: newKeyList(), b1: newKeyList(), b2: newKeyList()}
+}
+
+func (a *ARCPolicy) OnMiss(key string) {
+	a.ghostHit, a.pendingGhost = 0, key
+	switch {
+	case a.b1.contains(key):
+		a.ghostHit = 1
+		a.p = min(a.capacity, a.p+max(a.b2.len()/max(a.b1.len(), 1), 1))
+	case a.b2.contains(key):
+		a.ghostHit = 2
+		a.p = max(0, a.p-max(a.b1.len()/max(a.b2.len(), 1), 1))
+	}
+}
+
+func (a *ARCPolicy) OnAccess(key string) {
+	if a.t1.remove(key) || a.t2.contains(key) {
+		a.t2.pushFront(key)
+	}
+}
+
+func (a *ARCPolicy) OnInsert(key string) {
+	// 在幽灵列表中命中过的 key 直接进入 T2
+	if a.pendingGhost == key && a.ghostHit != 0 {
+		a.b1.remove(key)
+		a.b2.remove(key)
+		a.t2.pushFront(key)
+	} else {
+		a.b1.remove(key)
+		a.b2.remove(key)
+		a.t1.pushFront(key)
+	}
+	a.ghostHit, a.pendingGhost = 0, ""
+}
+
+func (a *ARCPolicy) OnRemove(key string) {
+	if a.t1.remove(key) {
+		a.b1.pushFront(key)
+	} else if a.t2.remove(key) {
+		a.b2.pushFront(key)
+	}
+	for a.b1.len() > a.capacity {
+		k, _ := a.b1.back()
+		a.b1.remove(k)
+	}
+	for a.b2.len() > a.capacity {
+		k, _ := a.b2.back()
+		a.b2.remove(k)
+	}
+}
+
+func (a *ARCPolicy) Victim(exclude string) (string, bool) {
+	first, second := a.t2, a.t1
+	if a.t1.len() > 0 && (a.t1.len() > a.p || (a.ghostHit == 2 && a.t1.len() == a.p) || a.t2.len() == 0) {
+		first, second = a.t1, a.t2
+	}
+	// 首选列表中只有 exclude 时从另一个列表淘汰
+	if key, ok := first.backExcept(exclude); ok {
+		return key, true
+	}
+	return second.backExcept(exclude)
+}
+
+// TinyLFUPolicy 在 LRU 的基础上增加基于访问频率的准入控制：
+// 用 Count-Min Sketch 近似统计每个 key 最近的访问频率，缓存已满时只有新 key 的频率高于被淘汰的 key 才放入。
+// 统计次数达到 sampleSize 后所有计数减半，让频率反映的是最近一段时间的访问。
+type TinyLFUPolicy struct {
+	LRUPolicy
+	sketch     [4][]uint8
+	seeds      [4]uint32
+	additions  int
+	sampleSize int
+}
+
+// NewTinyLFUPolicy 的 capacity 为缓存的条数上限，sketch 的宽度和采样窗口据此确定
+func NewTinyLFUPolicy(capacity int) *TinyLFUPolicy {
+	width := 1
+	for width < capacity*4 {
+		width <<= 1
+	}
+	p := &TinyLFUPolicy{
+		LRUPolicy:  *NewLRUPolicy(),
+		seeds:      [4]uint32{0x9747b28c, 0x85ebca6b, 0xc2b2ae35, 0x27d4eb2f},
+		sampleSize: capacity * 10,
+	}
+	for i := range p.sketch {
+		p.sketch[i] = make([]uint8, width)
+	}
+	return p
+}
+
+func (p *TinyLFUPolicy) indexes(key string) [4]int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	sum := h.Sum32()
+	var idx [4]int
+	for i, seed := range p.seeds {
+		x := (sum ^ seed) * 0x9e3779b1
+		x ^= x >> 15
+		idx[i] = int(x) & (len(p.sketch[i]) - 1)
+	}
+	return idx
+}
+
+func (p *TinyLFUPolicy) record(key string) {
+	for i, j := range p.indexes(key) {
+		if p.sketch[i][j] < 15 {
+			p.sketch[i][j]++
+		}
+	}
+	p.additions++
+	if p.additions >= p.sampleSize {
+		for i := range p.sketch {
+			for j := range p.sketch[i] {
+				p.sketch[i][j] /= 2
+			}
+		}
+		p.additions /= 2
+	}
+}
+
+func (p *TinyLFUPolicy) estimate(key string) uint8 {
+	est := uint8(255)
+	for i, j := range p.indexes(key) {
+		est = min(est, p.sketch[i][j])
+	}
+	return est
+}
+
+func (p *TinyLFUPolicy) OnMiss(key string) { p.record(key) }
+
+func (p *TinyLFUPolicy) OnAccess(key string) {
+	p.record(key)
+	p.LRUPolicy.OnAccess(key)
+}
+
+func (p *TinyLFUPolicy) Admit(candidate, victim string) bool {
+	return p.estimate(candidate) > p.estimate(victim)
+}
+
+// ReplayTrace 按访问序列回放：未命中时写入 value，返回统计结果
+// 用同一条访问序列回放不同策略的缓存，就可以比较它们的命中率
+func ReplayTrace(cache *Cache, trace []string, value func(key string) []byte) CacheStats {
+	for _, key := range trace {
+		if _, ok := cache.Get(key); !ok {
+			cache.Set(key, value(key))
+		}
+	}
+	return cache.Stats()
+}
+
+// LoadTrace 读取记录下来的访问序列，每行一个 key，空行和 # 开头的行被忽略
+func LoadTrace(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var trace []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		trace = append(trace, line)
+	}
+	return trace, scanner.Err()
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func evictionPolicies(capacity int) map[string]func() EvictionPolicy {
+	return map[string]func() EvictionPolicy{
+		"LRU":     func() EvictionPolicy { return NewLRUPolicy() },
+		"LFU":     func() EvictionPolicy { return NewLFUPolicy() },
+		"FIFO":    func() EvictionPolicy { return NewFIFOPolicy() },
+		"ARC":     func() EvictionPolicy { return NewARCPolicy(capacity) },
+		"TinyLFU": func() EvictionPolicy { return NewTinyLFUPolicy(capacity) },
+	}
+}
+
+// 已有 key 的值变大时，即使策略首先选中的就是这个 key，也要淘汰其他 key 直到满足字节上限
+func TestCacheGrowingKeyStaysWithinMaxBytes(t *testing.T) {
+	for name, newPolicy := range evictionPolicies(4) {
+		t.Run(name, func(t *testing.T) {
+			c := NewCache(newPolicy(), 0, 10)
+			for _, k := range []string{"a", "b", "c", "d"} {
+				if !c.Set(k, []byte("xx")) {
+					t.Fatalf("set %s rejected", k)
+				}
+			}
+			// a 是最早写入、访问最少的 key，FIFO 和 LFU 都会先选中它
+			if !c.Set("a", bytes.Repeat([]byte("y"), 8)) {
+				t.Fatal("update rejected")
+			}
+			c.mu.Lock()
+			used := c.bytes
+			c.mu.Unlock()
+			if used > 10 {
+				t.Fatalf("cache holds %d bytes, limit 10", used)
+			}
+			if v, ok := c.Get("a"); !ok || len(v) != 8 {
+				t.Fatalf("a = %q, %v; want the updated value", v, ok)
+			}
+		})
+	}
+}
+
+// cacheKeys 按字母顺序返回缓存中的 key
+func cacheKeys(c *Cache) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.items))
+	for k := range c.items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// runCacheTrace 依次执行以逗号分隔的 "set k" 和 "get k"，写入的值为一个字节，返回按顺序被淘汰的 key
+func runCacheTrace(t *testing.T, c *Cache, ops string) []string {
+	t.Helper()
+	var evicted []string
+	for _, op := range strings.Split(ops, ",") {
+		verb, key, _ := strings.Cut(strings.TrimSpace(op), " ")
+		switch verb {
+		case "get":
+			c.Get(key)
+		case "set":
+			before := cacheKeys(c)
+			c.Set(key, []byte("x"))
+			after := map[string]bool{}
+			for _, k := range cacheKeys(c) {
+				after[k] = true
+			}
+			for _, k := range before {
+				if !after[k] {
+					evicted = append(evicted, k)
+				}
+			}
+		default:
+			t.Fatalf("bad op %q", op)
+		}
+	}
+	return evicted
+}
+
+func TestEvictionPolicyVictimOrder(t *testing.T) {
+	tests := []struct {
+		policy  string
+		ops     string
+		evicted []string
+		keys    []string
+	}{
+		// 最久没有访问的 key 先被淘汰
+		{"LRU", "set a, set b, set c, get a, set d, get c, set e", []string{"b", "a"}, []string{"c", "d", "e"}},
+		// 访问不影响写入顺序
+		{"FIFO", "set a, set b, set c, get a, set d, get c, set e", []string{"a", "b"}, []string{"c", "d", "e"}},
+		// 访问次数最少的先被淘汰，次数相同时淘汰最久没有访问的
+		{"LFU", "set a, set b, set c, get a, get a, get b, set d, get d, get d, get d, set e, set f", []string{"c", "b", "e"}, []string{"a", "d", "f"}},
+		{"LFU", "set a, set b, set c, get c, get b, get a, set d", []string{"c"}, []string{"a", "b", "d"}},
+		// 只访问过一次的 key 在 T1 中先被淘汰，访问过多次的 a 在 T2 中保留；
+		// b 从幽灵列表 B1 回来后 T1 的目标大小变大，b 直接进入 T2
+		{"ARC", "set a, set b, set c, get a, set d, get b, set b, get b, set e", []string{"b", "c", "a"}, []string{"b", "d", "e"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			c := NewCache(evictionPolicies(3)[tt.policy](), 3, 0)
+			evicted := runCacheTrace(t, c, tt.ops)
+			if !reflect.DeepEqual(evicted, tt.evicted) {
+				t.Errorf("evicted %v, want %v", evicted, tt.evicted)
+			}
+			if keys := cacheKeys(c); !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("keys %v, want %v", keys, tt.keys)
+			}
+		})
+	}
+}
+
+func TestARCPromotionAndGhostHits(t *testing.T) {
+	arc := NewARCPolicy(3)
+	c := NewCache(arc, 3, 0)
+	runCacheTrace(t, c, "set a, set b, set c, get a")
+	if !arc.t2.contains("a") || arc.t1.contains("a") {
+		t.Fatal("a second access did not move a from T1 to T2")
+	}
+
+	runCacheTrace(t, c, "set d")
+	if !arc.b1.contains("b") {
+		t.Fatal("b evicted from T1 is not in the ghost list B1")
+	}
+	c.Get("b")
+	if arc.p != 1 {
+		t.Fatalf("ghost hit in B1: p = %d, want 1", arc.p)
+	}
+	c.Set("b", []byte("x"))
+	if !arc.t2.contains("b") || arc.b1.contains("b") {
+		t.Fatal("b re-inserted after a ghost hit is not in T2")
+	}
+
+	// a 从 T2 淘汰后进入 B2，在 B2 中命中会减小 p
+	runCacheTrace(t, c, "get b, set e")
+	if !arc.b2.contains("a") {
+		t.Fatal("a evicted from T2 is not in the ghost list B2")
+	}
+	c.Get("a")
+	if arc.p != 0 {
+		t.Fatalf("ghost hit in B2: p = %d, want 0", arc.p)
+	}
+}
+
+func TestTinyLFURejectsColdKeys(t *testing.T) {
+	c := NewCache(NewTinyLFUPolicy(3), 3, 0)
+	runCacheTrace(t, c, "set a, set b, set c, get a, get b, get c, get a, get b, get c")
+
+	// d 从来没有被请求过，比要被淘汰的 a 冷，拒绝写入且不淘汰任何 key
+	if c.Set("d", []byte("x")) {
+		t.Fatal("cold key admitted")
+	}
+	if stats := c.Stats(); stats.Rejected != 1 || stats.Evictions != 0 {
+		t.Fatalf("stats = %v, want one rejection and no evictions", stats)
+	}
+
+	// d 多次未命中之后比 a 热，写入时淘汰 a
+	for i := 0; i < 3; i++ {
+		c.Get("d")
+	}
+	if evicted := runCacheTrace(t, c, "set d"); !reflect.DeepEqual(evicted, []string{"a"}) {
+		t.Fatalf("evicted %v, want [a]", evicted)
+	}
+}
+
+// TinyLFU 的准入只判断一次：新 key 比第一个候选 a 热就放入，之后淘汰 b 时不再判断
+func TestCacheAdmissionDecidedOnce(t *testing.T) {
+	c := NewCache(NewTinyLFUPolicy(4), 0, 6)
+	for _, k := range []string{"a", "b", "c"} {
+		c.Set(k, []byte("xx"))
+	}
+	// a 从未被读过，b、c 很热，新 key 有少量未命中记录
+	for i := 0; i < 5; i++ {
+		c.Get("b")
+		c.Get("c")
+	}
+	c.Get("new")
+	c.Get("new")
+
+	// 新值需要淘汰两个 key 才放得下：第一个候选 a 比新 key 冷，第二个候选 b 比新 key 热
+	if !c.Set("new", []byte("zzzz")) {
+		t.Fatal("new key rejected although it is hotter than the first victim")
+	}
+	if stats := c.Stats(); stats.Evictions != 2 || stats.Rejected != 0 {
+		t.Fatalf("stats = %v, want 2 evictions and no rejection", stats)
+	}
+	if keys := cacheKeys(c); !reflect.DeepEqual(keys, []string{"c", "new"}) {
+		t.Fatalf("keys = %v, want [c new]", keys)
+	}
+}
+
+// 已有 key 的值变大时，跳过它淘汰其他 key 不能改变它在策略中的状态
+func TestCacheGrowingKeyKeepsPolicyState(t *testing.T) {
+	t.Run("LFU", func(t *testing.T) {
+		lfu := NewLFUPolicy()
+		c := NewCache(lfu, 0, 4)
+		runCacheTrace(t, c, "set a, set b, get b, get b, get b")
+		// 更新算一次访问，a 的访问次数变为 2，仍然是最少的，但不能被淘汰
+		c.Set("a", []byte("yyyy"))
+		if keys := cacheKeys(c); !reflect.DeepEqual(keys, []string{"a"}) {
+			t.Fatalf("keys = %v, want [a]", keys)
+		}
+		if lfu.freq["a"] != 2 {
+			t.Fatalf("a's frequency = %d, want 2", lfu.freq["a"])
+		}
+	})
+	t.Run("ARC", func(t *testing.T) {
+		arc := NewARCPolicy(2)
+		c := NewCache(arc, 2, 6)
+		// a 进入 T2；b 被淘汰到 B1，b 的幽灵命中让 p 变为 1
+		runCacheTrace(t, c, "set a, get a, set b, set c, get b")
+		if arc.p != 1 || !arc.t2.contains("a") || !arc.t1.contains("c") {
+			t.Fatalf("setup: p = %d, T1 has c = %v, T2 has a = %v", arc.p, arc.t1.contains("c"), arc.t2.contains("a"))
+		}
+		// T1 没有超过 p，ARC 首选从 T2 淘汰，而 T2 中只有 a
+		c.Set("a", []byte("yyyyyy"))
+		if keys := cacheKeys(c); !reflect.DeepEqual(keys, []string{"a"}) {
+			t.Fatalf("keys = %v, want [a]", keys)
+		}
+		if !arc.t2.contains("a") || arc.t1.contains("a") || arc.b2.contains("a") {
+			t.Fatal("a growing in place moved it out of T2")
+		}
+	})
+}
+
+func TestCacheRespectsItemLimit(t *testing.T) {
+	for name, newPolicy := range evictionPolicies(8) {
+		t.Run(name, func(t *testing.T) {
+			c := NewCache(newPolicy(), 8, 0)
+			ReplayTrace(c, zipfTrace(5000, 100, 1), func(key string) []byte { return []byte(key) })
+			if c.Len() > 8 {
+				t.Fatalf("len = %d, limit 8", c.Len())
+			}
+		})
+	}
+}
+
+// BenchmarkEvictionPolicies 在相同的访问序列上回放每种策略，用 hit-ratio 指标比较命中率
+func BenchmarkEvictionPolicies(b *testing.B) {
+	const capacity = 100
+	traces := []struct {
+		name  string
+		trace []string
+	}{
+		{"zipf", zipfTrace(50000, 1000, 1)},
+		{"zipf+scan", scanTrace(zipfTrace(50000, 1000, 2), 20000)},
+	}
+	value := func(key string) []byte { return []byte(key) }
+	for _, tr := range traces {
+		for _, name := range []string{"LRU", "LFU", "FIFO", "ARC", "TinyLFU"} {
+			newPolicy := evictionPolicies(capacity)[name]
+			b.Run(fmt.Sprintf("%s/%s", tr.name, name), func(b *testing.B) {
+				var stats CacheStats
+				for i := 0; i < b.N; i++ {
+					stats = ReplayTrace(NewCache(newPolicy(), capacity, 0), tr.trace, value)
+				}
+				b.ReportMetric(stats.HitRatio(), "hit-ratio")
+			})
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 负载均衡策略
+// Balancer 相当于策略模式中的 Context，持有一组后端和一个可替换的 BalanceStrategy。
+// 每次选择后端时，Balancer 先过滤掉不健康的后端，再交给策略从剩下的后端中挑选一个。
+
+// ErrNoHealthyBackend 表示没有可用的后端
+var ErrNoHealthyBackend = errors.New("no healthy backend")
+
+// Backend 是一个后端实例
+type Backend struct {
+	Name string
+
+	weight    atomic.Int64 // 权重，只有加权策略使用
+	unhealthy atomic.Bool
+	active    atomic.Int64 // 正在处理的请求数
+}
+
+func NewBackend(name string, weight int) *Backend {
+	b := &Backend{Name: name}
+	b.weight.Store(int64(weight))
+	return b
+}
+
+func (b *Backend) Healthy() bool {
+	return !b.unhealthy.Load()
+}
+
+func (b *Backend) Active() int64 {
+	return b.active.Load()
+}
+
+// Weight 返回权重，小于 1 时按 1 处理
+func (b *Backend) Weight() int {
+	return max(int(b.weight.Load()), 1)
+}
+
+// SetWeight 修改权重，可以和 Pick 并发调用
+func (b *Backend) SetWeight(weight int) {
+	b.weight.Store(int64(weight))
+}
+
+// BalanceStrategy 从健康的后端中挑选一个，key 只有一致性哈希使用
+// backends 保证非空且顺序稳定
+type BalanceStrategy interface {
+	Pick(backends []*Backend, key string) *Backend
+}
+
+// Balancer 是负载均衡器
+type Balancer struct {
+	mu       sync.RWMutex
+	backends []*Backend
+	strategy BalanceStrategy
+}
+
+func NewBalancer(strategy BalanceStrategy, backends ...*Backend) *Balancer {
+	return &Balancer{strategy: strategy, backends: backends}
+}
+
+func (b *Balancer) SetStrategy(strategy BalanceStrategy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.strategy = strategy
+}
+
+// MarkHealthy 标记后端是否健康，不健康的后端不会被选中
+func (b *Balancer) MarkHealthy(name string, healthy bool) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, backend := range b.backends {
+		if backend.Name == name {
+			backend.unhealthy.Store(!healthy)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown backend %q", name)
+}
+
+// SetWeight 修改后端的权重
+func (b *Balancer) SetWeight(name string, weight int) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, backend := range b.backends {
+		if backend.Name == name {
+			backend.SetWeight(weight)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown backend %q", name)
+}
+
+func (b *Balancer) healthy() []*Backend {
+	healthy := make([]*Backend, 0, len(b.backends))
+	for _, backend := range b.backends {
+		if backend.Healthy() {
+			healthy = append(healthy, backend)
+		}
+	}
+	return healthy
+}
+
+// Pick 选择一个后端，不改变后端的连接数
+func (b *Balancer) Pick(key string) (*Backend, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	healthy := b.healthy()
+	if len(healthy) == 0 {
+		return nil, ErrNoHealthyBackend
+	}
+	return b.strategy.Pick(healthy, key), nil
+}
+
+// Acquire 选择一个后端并把它的连接数加一，请求结束后必须调用 release
+func (b *Balancer) Acquire(key string) (backend *Backend, release func(), err error) {
+	backend, err = b.Pick(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	backend.active.Add(1)
+	var once sync.Once
+	return backend, func() { once.Do(func() { backend.active.Add(-1) }) }, nil
+}
+
+// RoundRobin 轮询
+type RoundRobin struct {
+	next atomic.Uint64
+}
+
+func (r *RoundRobin) Pick(backends []*Backend, _ string) *Backend {
+	n := r.next.Add(1) - 1
+	return backends[n%uint64(len(backends))]
+}
+
+// WeightedRoundRobin 平滑加权轮询（与 nginx 相同的算法）
+// 每次选择时所有后端的当前权重加上各自的权重，选出当前权重最大的后端，再把它的当前权重减去总权重，
+// 这样权重为 5:1:1 的后端会得到 a a b a c a a 这样分散的序列，而不是连续的 a a a a a b c
+type WeightedRoundRobin struct {
+	mu      sync.Mutex
+	current map[*Backend]int
+}
+
+func (w *WeightedRoundRobin) Pick(backends []*Backend, _ string) *Backend {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.current == nil {
+		w.current = map[*Backend]int{}
+	}
+	total := 0
+	var best *Backend
+	for _, b := range backends {
+		weight := b.Weight()
+		w.current[b] += weight
+		total += weight
+		if best == nil || w.current[b] > w.current[best] {
+			best = b
+		}
+	}
+	w.current[best] -= total
+	// 不在本次列表中的后端（被摘除或不健康）不再保留当前权重，否则 map 会随后端的增减一直增长
+	if len(w.current) > len(backends) {
+		keep := make(map[*Backend]bool, len(backends))
+		for _, b := range backends {
+			keep[b] = true
+		}
+		for b := range w.current {
+			if !keep[b] {
+				delete(w.current, b)
+			}
+		}
+	}
+	return best
+}
+
+// LeastConnections 选择正在处理请求数最少的后端，相同时选靠前的
+type LeastConnections struct{}
+
+func (LeastConnections) Pick(backends []*Backend, _ string) *Backend {
+	best := backends[0]
+	for _, b := range backends[1:] {
+		if b.Active() < best.Active() {
+			best = b
+		}
+	}
+	return best
+}
+
+// PowerOfTwoChoices 随机取两个后端，选择其中连接数较少的一个
+// 效果接近最少连接，但不需要遍历全部后端
+type PowerOfTwoChoices struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func NewPowerOfTwoChoices(seed int64) *PowerOfTwoChoices {
+	return &PowerOfTwoChoices{rand: rand.New(rand.NewSource(seed))}
+}
+
+func (p *PowerOfTwoChoices) Pick(backends []*Backend, _ string) *Backend {
+	if len(backends) == 1 {
+		return backends[0]
+	}
+	p.mu.Lock()
+	i := p.rand.Intn(len(backends))
+	j := p.rand.Intn(len(backends) - 1)
+	p.mu.Unlock()
+	if j >= i {
+		j++
+	}
+	a, b := backends[i], backends[j]
+	if b.Active() < a.Active() {
+		return b
+	}
+	return a
+}
+
+// ConsistentHash 一致性哈希，每个后端在环上放置 Replicas 个虚拟节点（按权重放大）
+// 后端增减时只有落在变化区间内的 key 会换到别的后端
+type ConsistentHash struct {
+	Replicas int
+
+	mu        sync.Mutex
+	signature string
+	ring      []ringNode
+}
+
+type ringNode struct {
+	hash    uint32
+	backend *Backend
+}
+
+func NewConsistentHash(replicas int) *ConsistentHash {
+	return &ConsistentHash{Replicas: replicas}
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	// fnv 对只差最后几个字符的 key 分布不够均匀，这里再做一次混合
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x45d9f3b
+	x ^= x >> 16
+	return x
+}
+
+// ringFor 在后端集合变化时重建哈希环
+func (c *ConsistentHash) ringFor(backends []*Backend) []ringNode {
+	names := make([]string, len(backends))
+	for i, b := range backends {
+		names[i] = b.Name + "#" + strconv.Itoa(b.Weight())
+	}
+	signature := strings.Join(names, ",")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if signature == c.signature {
+		return c.ring
+	}
+	replicas := max(c.Replicas, 1)
+	ring := make([]ringNode, 0, len(backends)*replicas)
+	for _, b := range backends {
+		for i := 0; i < replicas*b.Weight(); i++ {
+			ring = append(ring, ringNode{hash: hashKey(b.Name + "#" + strconv.Itoa(i)), backend: b})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	c.signature, c.ring = signature, ring
+	return ring
+}
+
+func (c *ConsistentHash) Pick(backends []*Backend, key string) *Backend {
+	ring := c.ringFor(backends)
+	h := hashKey(key)
+	i := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+	if i == len(ring) {
+		i = 0
+	}
+	return ring[i].backend
+}
+
+// Distribution 对每个 key 调用一次 Pick，统计每个后端被选中的次数，用来检查策略的分布质量
+func Distribution(b *Balancer, keys []string) (map[string]int, error) {
+	counts := map[string]int{}
+	for _, key := range keys {
+		backend, err := b.Pick(key)
+		if err != nil {
+			return nil, err
+		}
+		counts[backend.Name]++
+	}
+	return counts, nil
+}
+
+// FormatDistribution 按后端名称排序输出分布
+func FormatDistribution(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%d", name, counts[name])
+	}
+	return strings.Join(parts, " ")
+}
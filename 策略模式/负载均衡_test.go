@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func balancerKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user-%d", i)
+	}
+	return keys
+}
+
+func weightedBackends() []*Backend {
+	return []*Backend{NewBackend("a", 5), NewBackend("b", 1), NewBackend("c", 1)}
+}
+
+// checkShares 检查每个后端被选中的比例与期望比例的偏差不超过 tolerance
+func checkShares(t *testing.T, counts map[string]int, want map[string]float64, tolerance float64) {
+	t.Helper()
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	for name, share := range want {
+		got := float64(counts[name]) / float64(total)
+		if math.Abs(got-share) > tolerance {
+			t.Errorf("%s got %.3f of the picks, want %.3f±%.3f (%s)", name, got, share, tolerance, FormatDistribution(counts))
+		}
+	}
+}
+
+func TestRoundRobinDistribution(t *testing.T) {
+	counts, err := Distribution(NewBalancer(&RoundRobin{}, weightedBackends()...), balancerKeys(7000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if FormatDistribution(counts) != "a=2334 b=2333 c=2333" {
+		t.Fatalf("round robin = %s, want an even split", FormatDistribution(counts))
+	}
+}
+
+func TestWeightedRoundRobinIsSmooth(t *testing.T) {
+	balancer := NewBalancer(&WeightedRoundRobin{}, weightedBackends()...)
+	var seq []string
+	for i := 0; i < 7; i++ {
+		b, err := balancer.Pick("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		seq = append(seq, b.Name)
+	}
+	if got := strings.Join(seq, " "); got != "a a b a c a a" {
+		t.Fatalf("sequence = %s, want a a b a c a a", got)
+	}
+	counts, _ := Distribution(balancer, balancerKeys(7000))
+	if FormatDistribution(counts) != "a=5000 b=1000 c=1000" {
+		t.Fatalf("weighted = %s, want exactly 5:1:1", FormatDistribution(counts))
+	}
+
+	// 修改权重后立即按新的权重分配
+	if err := balancer.SetWeight("b", 5); err != nil {
+		t.Fatal(err)
+	}
+	counts, _ = Distribution(balancer, balancerKeys(1100))
+	if FormatDistribution(counts) != "a=500 b=500 c=100" {
+		t.Fatalf("after SetWeight = %s, want 5:5:1", FormatDistribution(counts))
+	}
+}
+
+func TestWeightedRoundRobinPrunesRemovedBackends(t *testing.T) {
+	w := &WeightedRoundRobin{}
+	stable := NewBackend("stable", 1)
+	for i := 0; i < 100; i++ {
+		// 每次都换一个新的后端，模拟后端不断上下线
+		w.Pick([]*Backend{stable, NewBackend(fmt.Sprintf("temp-%d", i), 1)}, "")
+	}
+	if n := len(w.current); n != 2 {
+		t.Fatalf("current tracks %d backends, want only the 2 passed in", n)
+	}
+
+	// 不健康的后端不参与选择，也不保留它的当前权重
+	backends := weightedBackends()
+	balancer := NewBalancer(w, backends...)
+	balancer.MarkHealthy("b", false)
+	counts, _ := Distribution(balancer, balancerKeys(600))
+	if FormatDistribution(counts) != "a=500 c=100" {
+		t.Fatalf("with b unhealthy = %s, want a=500 c=100", FormatDistribution(counts))
+	}
+	if _, ok := w.current[backends[1]]; ok {
+		t.Fatal("unhealthy backend still tracked")
+	}
+}
+
+func TestLeastConnectionsAvoidsBusyBackend(t *testing.T) {
+	balancer := NewBalancer(LeastConnections{}, weightedBackends()...)
+	var releases []func()
+	for i := 0; i < 6; i++ {
+		_, release, err := balancer.Acquire("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases = append(releases, release)
+	}
+	// 依次占用之后三个后端各有两个连接
+	for _, b := range balancer.backends {
+		if b.Active() != 2 {
+			t.Fatalf("%s has %d active requests, want 2", b.Name, b.Active())
+		}
+	}
+	releases[1]() // 释放 b 的一个连接
+	releases[1]() // 重复调用不会重复释放
+	if b, _ := balancer.Pick(""); b.Name != "b" {
+		t.Fatalf("least connections picked %s, want b", b.Name)
+	}
+	for _, release := range releases {
+		release()
+	}
+}
+
+func TestPowerOfTwoChoicesDistribution(t *testing.T) {
+	backends := []*Backend{NewBackend("a", 1), NewBackend("b", 1), NewBackend("c", 1), NewBackend("d", 1)}
+	balancer := NewBalancer(NewPowerOfTwoChoices(1), backends...)
+	counts, _ := Distribution(balancer, balancerKeys(20000))
+	checkShares(t, counts, map[string]float64{"a": 0.25, "b": 0.25, "c": 0.25, "d": 0.25}, 0.05)
+
+	// 一个后端很忙时，它只在两个候选都是自己时才会被选中，这不可能发生
+	backends[0].active.Add(10)
+	defer backends[0].active.Add(-10)
+	counts, _ = Distribution(balancer, balancerKeys(1000))
+	if counts["a"] != 0 {
+		t.Fatalf("busy backend picked %d times, want 0", counts["a"])
+	}
+}
+
+func TestConsistentHashDistribution(t *testing.T) {
+	keys := balancerKeys(20000)
+	balancer := NewBalancer(NewConsistentHash(100), weightedBackends()...)
+	counts, _ := Distribution(balancer, keys)
+	checkShares(t, counts, map[string]float64{"a": 5.0 / 7, "b": 1.0 / 7, "c": 1.0 / 7}, 0.05)
+
+	// 同一个 key 总是落在同一个后端；摘掉 c 后只有原来在 c 上的 key 会迁移
+	before := map[string]string{}
+	for _, key := range keys {
+		b, _ := balancer.Pick(key)
+		before[key] = b.Name
+	}
+	balancer.MarkHealthy("c", false)
+	for _, key := range keys {
+		b, _ := balancer.Pick(key)
+		if before[key] != "c" && b.Name != before[key] {
+			t.Fatalf("key %s moved from %s to %s", key, before[key], b.Name)
+		}
+		if b.Name == "c" {
+			t.Fatalf("key %s still on the unhealthy backend", key)
+		}
+	}
+}
+
+func TestBalancerNoHealthyBackend(t *testing.T) {
+	balancer := NewBalancer(&RoundRobin{}, NewBackend("a", 1))
+	balancer.MarkHealthy("a", false)
+	if _, err := balancer.Pick(""); err != ErrNoHealthyBackend {
+		t.Fatalf("Pick error = %v, want ErrNoHealthyBackend", err)
+	}
+	if err := balancer.MarkHealthy("missing", true); err == nil {
+		t.Fatal("MarkHealthy accepted an unknown backend")
+	}
+	if err := balancer.SetWeight("missing", 1); err == nil {
+		t.Fatal("SetWeight accepted an unknown backend")
+	}
+}
+
+// TestSetWeightWhilePicking 在 -race 下检查修改权重和选择后端没有数据竞争
+func TestSetWeightWhilePicking(t *testing.T) {
+	for _, strategy := range []BalanceStrategy{&WeightedRoundRobin{}, NewConsistentHash(10)} {
+		balancer := NewBalancer(strategy, weightedBackends()...)
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 200; j++ {
+					if i == 0 {
+						balancer.SetWeight("b", j%5+1)
+						continue
+					}
+					if _, err := balancer.Pick(fmt.Sprint(j)); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func BenchmarkBalanceStrategies(b *testing.B) {
+	strategies := []struct {
+		name     string
+		strategy func() BalanceStrategy
+	}{
+		{"round-robin", func() BalanceStrategy { return &RoundRobin{} }},
+		{"weighted", func() BalanceStrategy { return &WeightedRoundRobin{} }},
+		{"least-conn", func() BalanceStrategy { return LeastConnections{} }},
+		{"two-choices", func() BalanceStrategy { return NewPowerOfTwoChoices(1) }},
+		{"consistent-hash", func() BalanceStrategy { return NewConsistentHash(100) }},
+	}
+	keys := balancerKeys(1024)
+	for _, s := range strategies {
+		b.Run(s.name, func(b *testing.B) {
+			backends := make([]*Backend, 16)
+			for i := range backends {
+				backends[i] = NewBackend(fmt.Sprintf("backend-%d", i), i%4+1)
+			}
+			balancer := NewBalancer(s.strategy(), backends...)
+			b.ReportAllocs()
+			i := 0
+			for b.Loop() {
+				if _, err := balancer.Pick(keys[i%len(keys)]); err != nil {
+					b.Fatal(err)
+				}
+				i++
+			}
+		})
+	}
+}
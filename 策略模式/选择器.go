@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 运行时策略选择
+// 选择器本身也实现了 Strategy，可以直接交给 Context 使用，每次调用时再根据输入决定由哪个策略处理：
+// RuleSelector 按规则匹配输入，WeightedSelector 按权重随机（用于 A/B 实验），
+// FallbackSelector 依次尝试，前一个策略出错时交给下一个。
+// 每个选择器都会按策略名称统计处理次数和出错次数，DoOperationTraced 还会返回本次调用由哪个策略处理。
+
+// StrategyFunc 让普通函数也能作为策略
+type StrategyFunc func(num1, num2 int) (int, error)
+
+func (f StrategyFunc) DoOperation(num1, num2 int) (int, error) {
+	return f(num1, num2)
+}
+
+// NamedStrategy 是带名称的策略，名称用于统计
+type NamedStrategy struct {
+	Name     string
+	Strategy Strategy
+}
+
+// TracedStrategy 是能报告由哪个策略处理了本次调用的策略
+type TracedStrategy interface {
+	Strategy
+	DoOperationTraced(num1, num2 int) (result int, servedBy string, err error)
+}
+
+// StrategyCount 是单个策略的统计
+type StrategyCount struct {
+	Served int // 处理的调用次数，包括出错的调用
+	Errors int
+}
+
+// selectionCounters 按策略名称统计调用次数
+type selectionCounters struct {
+	mu     sync.Mutex
+	counts map[string]StrategyCount
+}
+
+func (c *selectionCounters) record(name string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = map[string]StrategyCount{}
+	}
+	count := c.counts[name]
+	count.Served++
+	if err != nil {
+		count.Errors++
+	}
+	c.counts[name] = count
+}
+
+// Counts 返回各策略的统计
+func (c *selectionCounters) Counts() map[string]StrategyCount {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]StrategyCount, len(c.counts))
+	for name, count := range c.counts {
+		out[name] = count
+	}
+	return out
+}
+
+// FormatCounts 按名称排序输出统计
+func (c *selectionCounters) FormatCounts() string {
+	counts := c.Counts()
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%d(err %d)", name, counts[name].Served, counts[name].Errors)
+	}
+	return strings.Join(parts, " ")
+}
+
+// run 执行策略并记录统计；如果策略本身也是选择器，则报告最内层实际处理的策略
+func (c *selectionCounters) run(s NamedStrategy, num1, num2 int) (int, string, error) {
+	servedBy := s.Name
+	var result int
+	var err error
+	if traced, ok := s.Strategy.(TracedStrategy); ok {
+		var inner string
+		result, inner, err = traced.DoOperationTraced(num1, num2)
+		servedBy = s.Name + "/" + inner
+	} else {
+		result, err = s.Strategy.DoOperation(num1, num2)
+	}
+	c.record(s.Name, err)
+	return result, servedBy, err
+}
+
+// SelectionRule 是一条选择规则，Match 满足时使用对应的策略
+type SelectionRule struct {
+	Match    func(num1, num2 int) bool
+	Strategy NamedStrategy
+}
+
+// RuleSelector 按顺序匹配规则，第一条满足的规则决定使用哪个策略，都不满足时使用默认策略
+type RuleSelector struct {
+	selectionCounters
+	rules []SelectionRule
+	def   NamedStrategy
+}
+
+func NewRuleSelector(def NamedStrategy, rules ...SelectionRule) *RuleSelector {
+	return &RuleSelector{rules: rules, def: def}
+}
+
+func (r *RuleSelector) DoOperationTraced(num1, num2 int) (int, string, error) {
+	for _, rule := range r.rules {
+		if rule.Match(num1, num2) {
+			return r.run(rule.Strategy, num1, num2)
+		}
+	}
+	return r.run(r.def, num1, num2)
+}
+
+func (r *RuleSelector) DoOperation(num1, num2 int) (int, error) {
+	result, _, err := r.DoOperationTraced(num1, num2)
+	return result, err
+}
+
+// WeightedChoice 是加权随机中的一个选项
+type WeightedChoice struct {
+	Weight   int
+	Strategy NamedStrategy
+}
+
+// WeightedSelector 按权重随机选择策略，例如 90% 走旧实现、10% 走新实现
+type WeightedSelector struct {
+	selectionCounters
+	choices []WeightedChoice
+	total   int
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func NewWeightedSelector(seed int64, choices ...WeightedChoice) (*WeightedSelector, error) {
+	total := 0
+	for _, c := range choices {
+		if c.Weight < 0 {
+			return nil, fmt.Errorf("strategy %q: negative weight %d", c.Strategy.Name, c.Weight)
+		}
+		total += c.Weight
+	}
+	if total == 0 {
+		return nil, errors.New("weighted selector: total weight is zero")
+	}
+	return &WeightedSelector{choices: choices, total: total, rand: rand.New(rand.NewSource(seed))}, nil
+}
+
+func (w *WeightedSelector) DoOperationTraced(num1, num2 int) (int, string, error) {
+	w.mu.Lock()
+	n := w.rand.Intn(w.total)
+	w.mu.Unlock()
+	for _, c := range w.choices {
+		if n < c.Weight {
+			return w.run(c.Strategy, num1, num2)
+		}
+		n -= c.Weight
+	}
+	// total 是所有权重之和，不会走到这里
+	return w.run(w.choices[len(w.choices)-1].Strategy, num1, num2)
+}
+
+func (w *WeightedSelector) DoOperation(num1, num2 int) (int, error) {
+	result, _, err := w.DoOperationTraced(num1, num2)
+	return result, err
+}
+
+// FallbackSelector 依次尝试策略，直到有一个成功；全部失败时返回所有错误，没有策略时返回 ErrNoStrategy
+type FallbackSelector struct {
+	selectionCounters
+	chain []NamedStrategy
+}
+
+func NewFallbackSelector(chain ...NamedStrategy) *FallbackSelector {
+	return &FallbackSelector{chain: chain}
+}
+
+func (f *FallbackSelector) DoOperationTraced(num1, num2 int) (int, string, error) {
+	if len(f.chain) == 0 {
+		return 0, "", ErrNoStrategy
+	}
+	var errs []error
+	for _, s := range f.chain {
+		result, servedBy, err := f.run(s, num1, num2)
+		if err == nil {
+			return result, servedBy, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+	}
+	return 0, "", errors.Join(errs...)
+}
+
+func (f *FallbackSelector) DoOperation(num1, num2 int) (int, error) {
+	result, _, err := f.DoOperationTraced(num1, num2)
+	return result, err
+}
+
+// MustNamed 从注册表中取出策略并带上名称，名称不存在时 panic，适合在初始化时使用
+func MustNamed(registry *StrategyRegistry, name string) NamedStrategy {
+	strategy, err := registry.Get(name)
+	if err != nil {
+		panic(err)
+	}
+	return NamedStrategy{Name: name, Strategy: strategy}
+}
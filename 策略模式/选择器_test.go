@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFallbackSelector(t *testing.T) {
+	registry := NewDefaultStrategyRegistry()
+	selector := NewFallbackSelector(MustNamed(registry, "div"), MustNamed(registry, "mul"))
+
+	result, servedBy, err := selector.DoOperationTraced(6, 0)
+	if err != nil || result != 0 || servedBy != "mul" {
+		t.Fatalf("6/0 = %d, %q, %v; want 0 from mul", result, servedBy, err)
+	}
+	if got := selector.FormatCounts(); got != "div=1(err 1) mul=1(err 0)" {
+		t.Fatalf("counts = %s", got)
+	}
+
+	failing := NewFallbackSelector(MustNamed(registry, "div"), MustNamed(registry, "mod"))
+	if _, err := failing.DoOperation(6, 0); !errors.Is(err, ErrDivisionByZero) {
+		t.Fatalf("all strategies failed: err = %v, want ErrDivisionByZero", err)
+	}
+}
+
+func TestFallbackSelectorEmptyChain(t *testing.T) {
+	result, servedBy, err := NewFallbackSelector().DoOperationTraced(1, 2)
+	if !errors.Is(err, ErrNoStrategy) || result != 0 || servedBy != "" {
+		t.Fatalf("empty chain = %d, %q, %v; want ErrNoStrategy", result, servedBy, err)
+	}
+}
+
+// constant 返回总是得到 n 的命名策略
+func constant(name string, n int) NamedStrategy {
+	return NamedStrategy{Name: name, Strategy: StrategyFunc(func(int, int) (int, error) { return n, nil })}
+}
+
+func TestRuleSelector(t *testing.T) {
+	selector := NewRuleSelector(constant("small", 1),
+		SelectionRule{Match: func(a, _ int) bool { return a > 1000 }, Strategy: constant("big", 3)},
+		SelectionRule{Match: func(a, _ int) bool { return a > 100 }, Strategy: constant("medium", 2)},
+	)
+	tests := []struct {
+		num1     int
+		want     int
+		servedBy string
+	}{
+		// 5000 同时满足两条规则，第一条生效
+		{5000, 3, "big"},
+		{500, 2, "medium"},
+		{100, 1, "small"},
+		{-1, 1, "small"},
+	}
+	for _, tt := range tests {
+		got, servedBy, err := selector.DoOperationTraced(tt.num1, 0)
+		if err != nil || got != tt.want || servedBy != tt.servedBy {
+			t.Errorf("%d: %d by %q, %v; want %d by %q", tt.num1, got, servedBy, err, tt.want, tt.servedBy)
+		}
+	}
+	want := map[string]StrategyCount{"big": {Served: 1}, "medium": {Served: 1}, "small": {Served: 2}}
+	if got := selector.Counts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Counts = %v, want %v", got, want)
+	}
+
+	// 嵌套的选择器报告最内层实际处理的策略
+	outer := NewRuleSelector(NamedStrategy{Name: "rules", Strategy: selector})
+	if _, servedBy, _ := outer.DoOperationTraced(500, 0); servedBy != "rules/medium" {
+		t.Fatalf("nested servedBy = %q, want rules/medium", servedBy)
+	}
+}
+
+func TestWeightedSelector(t *testing.T) {
+	choices := []WeightedChoice{
+		{Weight: 9, Strategy: constant("old", 1)},
+		{Weight: 1, Strategy: constant("new", 2)},
+		{Weight: 0, Strategy: constant("off", 3)},
+	}
+	selector, err := NewWeightedSelector(42, choices...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	same, _ := NewWeightedSelector(42, choices...)
+	for i := 0; i < 10000; i++ {
+		_, a, _ := selector.DoOperationTraced(0, 0)
+		_, b, _ := same.DoOperationTraced(0, 0)
+		if a != b {
+			t.Fatalf("call %d: selectors with the same seed picked %s and %s", i, a, b)
+		}
+	}
+	counts := selector.Counts()
+	if counts["off"].Served != 0 {
+		t.Fatalf("zero-weight strategy served %d calls", counts["off"].Served)
+	}
+	if share := float64(counts["new"].Served) / 10000; share < 0.08 || share > 0.12 {
+		t.Fatalf("new served %.3f of the calls, want about 0.1 (%s)", share, selector.FormatCounts())
+	}
+	if counts["old"].Served+counts["new"].Served != 10000 {
+		t.Fatalf("counts %s do not add up to 10000", selector.FormatCounts())
+	}
+
+	for _, tt := range []struct {
+		name    string
+		choices []WeightedChoice
+		want    string
+	}{
+		{"empty", nil, "total weight is zero"},
+		{"all zero", []WeightedChoice{{Weight: 0, Strategy: constant("a", 1)}}, "total weight is zero"},
+		{"negative", []WeightedChoice{{Weight: 2, Strategy: constant("a", 1)}, {Weight: -1, Strategy: constant("b", 1)}}, `strategy "b": negative weight -1`},
+	} {
+		if _, err := NewWeightedSelector(1, tt.choices...); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// net/http 适配
+// 职责链中的 Handler 以字符串作为请求，http.Handler 以 *http.Request 作为请求，
+// 两者之间通过适配器互相转换，这样链既可以挂到 http.Server 上，也可以把现成的 http.Handler 接入链中。
+// 链内的请求字符串约定为 "METHOD PATH"，例如 "GET /users"。
+
+// HTTPAdapter 把职责链中的 Handler 适配为 http.Handler
+type HTTPAdapter struct {
+	handler Handler
+}
+
+func NewHTTPAdapter(handler Handler) *HTTPAdapter {
+	return &HTTPAdapter{handler: handler}
+}
+
+func (a *HTTPAdapter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	response := a.handler.Handle(r.Context(), r.Method+" "+r.URL.RequestURI())
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, response)
+}
+
+// ChainAdapter 把 http.Handler 适配为职责链中的 Handler
+// 请求在内存中通过 httptest.ResponseRecorder 完成，不经过网络
+type ChainAdapter struct {
+	handler http.Handler
+}
+
+func NewChainAdapter(handler http.Handler) *ChainAdapter {
+	return &ChainAdapter{handler: handler}
+}
+
+func (a *ChainAdapter) Handle(ctx context.Context, request string) string {
+	method, target, ok := strings.Cut(request, " ")
+	if !ok {
+		method, target = http.MethodGet, request
+	}
+	r, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return fmt.Sprintf("bad request %q: %v", request, err)
+	}
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, r)
+	return rec.Body.String()
+}
+
+// HTTPMiddleware 是标准库风格的中间件，包装下一个 http.Handler 并返回新的 http.Handler
+type HTTPMiddleware func(next http.Handler) http.Handler
+
+// ChainHTTP 按顺序组装中间件，第一个中间件位于最外层，最先处理请求
+func ChainHTTP(handler http.Handler, middlewares ...HTTPMiddleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// statusRecorder 记录下游写出的状态码和字节数，供日志中间件使用
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap 让 http.ResponseController 能找到底层的 ResponseWriter，例如用来 Flush
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// LoggingMiddleware 记录每个请求的方法、路径、状态码、响应字节数和耗时
+func LoggingMiddleware(logger *log.Logger) HTTPMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			logger.Printf("%s %s %d %dB %s", r.Method, r.URL.RequestURI(), rec.status, rec.bytes, time.Since(start))
+		})
+	}
+}
+
+// RecoveryMiddleware 捕获下游的 panic，记录日志并返回 500，避免整个服务崩溃
+func RecoveryMiddleware(logger *log.Logger) HTTPMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if err := recover(); err != nil {
+					if err == http.ErrAbortHandler {
+						panic(err)
+					}
+					logger.Printf("panic recovered: %s %s: %v", r.Method, r.URL.RequestURI(), err)
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequestIDHeader 是请求ID使用的请求头和响应头
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware 为每个请求分配请求ID
+// 如果客户端已经带了 X-Request-ID 则沿用，否则生成一个随机ID，并写回响应头
+// 生成的ID写在请求的副本上交给下游，不修改调用方的请求
+func RequestIDMiddleware() HTTPMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if id == "" {
+				id = newRequestID()
+				r = r.Clone(r.Context())
+				r.Header.Set(RequestIDHeader, id)
+			}
+			w.Header().Set(RequestIDHeader, id)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// gzipResponseWriter 在下游写出响应头时决定是否压缩：
+// HEAD 请求、204 和 304 响应没有响应体，下游已经设置了 Content-Encoding 的响应也不再压缩，这些情况原样透传
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	head        bool
+	wroteHeader bool
+	gz          *gzip.Writer // 决定压缩之后才创建
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	// 1xx 是中间响应，之后还会有最终的响应头
+	if w.wroteHeader || status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	if !w.head && status != http.StatusNoContent && status != http.StatusNotModified && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", "gzip")
+		// 下游设置的长度是压缩前的长度
+		h.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.gz.Write(p)
+}
+
+// Flush 把已经压缩的数据发给客户端，流式响应需要它
+func (w *gzipResponseWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// close 结束 gzip 流；下游什么都没写时按 200 写出响应头，与 net/http 的默认行为一致
+func (w *gzipResponseWriter) close() error {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return nil
+	}
+	return w.gz.Close()
+}
+
+// acceptsGzip 按 q 值判断 Accept-Encoding 是否接受 gzip：gzip 自己的 q 值优先，没有列出 gzip 时看 *，q=0 表示不接受
+func acceptsGzip(header string) bool {
+	gzipQ, anyQ := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(param, "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(name), "q") {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				v = 0
+			}
+			q = v
+		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip", "x-gzip":
+			gzipQ = max(gzipQ, q)
+		case "*":
+			anyQ = q
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return anyQ > 0
+}
+
+// GzipMiddleware 在客户端声明接受 gzip 且响应有响应体时压缩响应体
+func GzipMiddleware() HTTPMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(strings.Join(r.Header.Values("Accept-Encoding"), ",")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			gw := &gzipResponseWriter{ResponseWriter: w, head: r.Method == http.MethodHead}
+			defer gw.close()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// TokenBucket 是令牌桶限流器
+// 桶容量为 burst，每秒补充 rate 个令牌，每个请求消耗一个令牌
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time // 可替换的时钟，方便测试
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return newTokenBucketWithClock(rate, burst, time.Now)
+}
+
+func newTokenBucketWithClock(rate float64, burst int, now func() time.Time) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now(),
+		now:    now,
+	}
+}
+
+// Allow 尝试取出一个令牌，取到返回 true
+func (b *TokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RateLimitMiddleware 使用令牌桶限流，超出速率的请求返回 429
+func RateLimitMiddleware(bucket *TokenBucket) HTTPMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !bucket.Allow() {
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BasicAuthMiddleware 校验 HTTP Basic 认证，users 为用户名到密码的映射
+func BasicAuthMiddleware(realm string, users map[string]string) HTTPMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			if ok {
+				expected, found := users[user]
+				// 用户不存在时也做一次比较，避免通过耗时判断用户名是否存在
+				if !found {
+					expected = pass + "x"
+				}
+				if subtle.ConstantTimeCompare([]byte(pass), []byte(expected)) == 1 && found {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		})
+	}
+}
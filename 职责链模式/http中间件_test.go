@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPAdapter(t *testing.T) {
+	var got string
+	chain := HandlerFunc(func(ctx context.Context, request string) string {
+		got = request
+		return "ok"
+	})
+	w := httptest.NewRecorder()
+	NewHTTPAdapter(chain).ServeHTTP(w, httptest.NewRequest("POST", "/users?page=2", nil))
+
+	if got != "POST /users?page=2" {
+		t.Errorf("chain request = %q, want %q", got, "POST /users?page=2")
+	}
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Errorf("response = %d %q, want 200 ok", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestChainAdapter(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Method+" "+r.URL.Path)
+	})
+	adapter := NewChainAdapter(handler)
+	for request, want := range map[string]string{
+		"DELETE /users/1": "DELETE /users/1",
+		"/health":         "GET /health",
+	} {
+		if got := adapter.Handle(context.Background(), request); got != want {
+			t.Errorf("Handle(%q) = %q, want %q", request, got, want)
+		}
+	}
+}
+
+func TestChainHTTPOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) HTTPMiddleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	handler := ChainHTTP(http.NotFoundHandler(), mark("outer"), mark("inner"))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if strings.Join(order, ",") != "outer,inner" {
+		t.Fatalf("order = %v, want [outer inner]", order)
+	}
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	handler := ChainHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "created")
+	}), LoggingMiddleware(log.New(&buf, "", 0)))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/users", nil))
+
+	if line := buf.String(); !strings.HasPrefix(line, "POST /users 201 7B ") {
+		t.Fatalf("log = %q, want method, path, status and bytes", line)
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	handler := ChainHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), RecoveryMiddleware(log.New(&buf, "", 0)))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if !strings.Contains(buf.String(), "panic recovered: GET /panic: boom") {
+		t.Errorf("log = %q, want the recovered panic", buf.String())
+	}
+
+	// http.ErrAbortHandler 交给 net/http 处理，不能被吞掉
+	abort := ChainHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}), RecoveryMiddleware(log.New(io.Discard, "", 0)))
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler to propagate", p)
+		}
+	}()
+	abort.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	handler := ChainHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(RequestIDHeader)
+	}), RequestIDMiddleware())
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(RequestIDHeader, "client-id")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if seen != "client-id" || w.Header().Get(RequestIDHeader) != "client-id" {
+		t.Errorf("client id: handler saw %q, response has %q", seen, w.Header().Get(RequestIDHeader))
+	}
+
+	ids := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		handler.ServeHTTP(w, r)
+		if r.Header.Get(RequestIDHeader) != "" {
+			t.Fatal("generated id was written into the caller's request")
+		}
+		id := w.Header().Get(RequestIDHeader)
+		if len(id) != 16 || id != seen {
+			t.Errorf("generated id = %q, handler saw %q; want the same 16 hex digits", id, seen)
+		}
+		ids[id] = true
+	}
+	if len(ids) != 2 {
+		t.Errorf("generated ids are not unique: %v", ids)
+	}
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	body := strings.Repeat("hello chain ", 100)
+	handler := ChainHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1200")
+		io.WriteString(w, body)
+	}), GzipMiddleware())
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip, deflate")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Content-Length") != "" {
+		t.Fatalf("headers = %v, want gzip without Content-Length", w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil || string(got) != body {
+		t.Fatalf("decompressed body = %q, %v", got, err)
+	}
+
+	// 客户端不支持 gzip 时原样返回
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != body {
+		t.Fatalf("plain response: Content-Encoding %q, body %d bytes", w.Header().Get("Content-Encoding"), w.Body.Len())
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want Accept-Encoding", w.Header().Get("Vary"))
+	}
+}
+
+func TestGzipMiddlewareResponsesWithoutBody(t *testing.T) {
+	tests := []struct {
+		method string
+		status int
+	}{
+		{"HEAD", http.StatusOK},
+		{"GET", http.StatusNoContent},
+		{"GET", http.StatusNotModified},
+	}
+	for _, tt := range tests {
+		handler := GzipMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "42")
+			w.WriteHeader(tt.status)
+		}))
+		r := httptest.NewRequest(tt.method, "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.status || w.Header().Get("Content-Encoding") != "" || w.Body.Len() != 0 {
+			t.Errorf("%s %d: status %d, Content-Encoding %q, %d body bytes; want no encoding and no body",
+				tt.method, tt.status, w.Code, w.Header().Get("Content-Encoding"), w.Body.Len())
+		}
+		// HEAD 的 Content-Length 描述的是 GET 的响应，原样保留
+		if w.Header().Get("Content-Length") != "42" {
+			t.Errorf("%s %d: Content-Length = %q, want it untouched", tt.method, tt.status, w.Header().Get("Content-Length"))
+		}
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, GZIP", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0.0, deflate", false},
+		{"gzip;q=0.5", true},
+		{"gzip;q=bad", false},
+		{"*", true},
+		{"*;q=0", false},
+		{"gzip;q=0, *", false},
+		{"*;q=0, gzip;q=1", true},
+		{"br, identity", false},
+		{"x-gzip", true},
+	}
+	for _, tt := range tests {
+		if got := acceptsGzip(tt.header); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestGzipMiddlewareFlush(t *testing.T) {
+	w := httptest.NewRecorder()
+	var flushed string
+	handler := GzipMiddleware()(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		io.WriteString(rw, "first event\n")
+		if err := http.NewResponseController(rw).Flush(); err != nil {
+			t.Errorf("Flush: %v", err)
+		}
+		// 刷新之后，客户端已经能解压出第一部分
+		zr, err := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+		if err != nil {
+			t.Errorf("flushed data is not a gzip stream: %v", err)
+			return
+		}
+		buf := make([]byte, len("first event\n"))
+		n, _ := io.ReadFull(zr, buf)
+		flushed = string(buf[:n])
+		io.WriteString(rw, "second event\n")
+	}))
+	r := httptest.NewRequest("GET", "/events", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(w, r)
+	if !w.Flushed || flushed != "first event\n" {
+		t.Fatalf("Flushed = %v, client saw %q before the handler returned", w.Flushed, flushed)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	now := time.Unix(0, 0)
+	bucket := newTokenBucketWithClock(2, 2, func() time.Time { return now })
+	handler := ChainHTTP(http.NotFoundHandler(), RateLimitMiddleware(bucket))
+	status := func() int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w.Code
+	}
+
+	for i, want := range []int{http.StatusNotFound, http.StatusNotFound, http.StatusTooManyRequests} {
+		if got := status(); got != want {
+			t.Fatalf("request %d: status = %d, want %d", i+1, got, want)
+		}
+	}
+	// 每秒补充 2 个令牌，半秒后可以再放行一个
+	now = now.Add(500 * time.Millisecond)
+	if got := status(); got != http.StatusNotFound {
+		t.Fatalf("after refill: status = %d, want 404", got)
+	}
+	if got := status(); got != http.StatusTooManyRequests {
+		t.Fatalf("after refill used up: status = %d, want 429", got)
+	}
+	// 补充的令牌不超过桶容量
+	now = now.Add(time.Hour)
+	for i, want := range []int{http.StatusNotFound, http.StatusNotFound, http.StatusTooManyRequests} {
+		if got := status(); got != want {
+			t.Fatalf("after idle, request %d: status = %d, want %d", i+1, got, want)
+		}
+	}
+}
+
+func TestBasicAuthMiddleware(t *testing.T) {
+	handler := ChainHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secret")
+	}), BasicAuthMiddleware("admin", map[string]string{"alice": "s3cret"}))
+
+	tests := []struct {
+		name       string
+		user, pass string
+		auth       bool
+		want       int
+	}{
+		{"valid", "alice", "s3cret", true, http.StatusOK},
+		{"wrong password", "alice", "nope", true, http.StatusUnauthorized},
+		{"unknown user", "bob", "s3cret", true, http.StatusUnauthorized},
+		{"no credentials", "", "", false, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/admin", nil)
+			if tt.auth {
+				r.SetBasicAuth(tt.user, tt.pass)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			challenge := w.Header().Get("WWW-Authenticate")
+			if tt.want == http.StatusUnauthorized && challenge != `Basic realm="admin"` {
+				t.Errorf("WWW-Authenticate = %q", challenge)
+			}
+			if tt.want == http.StatusOK && w.Body.String() != "secret" {
+				t.Errorf("body = %q, want secret", w.Body.String())
+			}
+		})
+	}
+}
@@ -1,6 +1,13 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http/httptest"
+	"os"
+	"time"
+)
 
 // 职责链模式
 // 责任链模式是一种行为设计模式，它允许将请求沿着处理者链传递，直到有一个处理者处理它为止。
@@ -12,13 +19,14 @@ import "fmt"
 // 责任链模式通常用于需要将请求沿着处理者链传递的场景，例如日志记录、权限验证等。
 
 // HTTP中间件案例
+// Handle 的 ctx 沿链向下传递，取消或超时后请求在下一个处理者边界停止
 type Handler interface {
-	Handle(request string) string
+	Handle(ctx context.Context, request string) string
 }
 
 type FinalHandler struct{}
 
-func (h *FinalHandler) Handle(request string) string {
+func (h *FinalHandler) Handle(ctx context.Context, request string) string {
 	// 处理请求
 	fmt.Println("FinalHandler: Handling request:", request)
 	return "Request handled by FinalHandler"
@@ -28,13 +36,13 @@ type Middleware1 struct {
 	next Handler
 }
 
-func (m *Middleware1) Handle(request string) string {
+func (m *Middleware1) Handle(ctx context.Context, request string) string {
 	// 处理请求
 	fmt.Println("Middleware1: Handling request:", request)
 
 	// 调用下一个处理者
 	if m.next != nil {
-		return m.next.Handle(request)
+		return callNext(ctx, m.next, request)
 	}
 	return "Request handled by Middleware1"
 }
@@ -43,13 +51,13 @@ type Middleware2 struct {
 	next Handler
 }
 
-func (m *Middleware2) Handle(request string) string {
+func (m *Middleware2) Handle(ctx context.Context, request string) string {
 	// 处理请求
 	fmt.Println("Middleware2: Handling request:", request)
 
 	// 调用下一个处理者
 	if m.next != nil {
-		return m.next.Handle(request)
+		return callNext(ctx, m.next, request)
 	}
 	return "Request handled by Middleware2"
 }
@@ -62,6 +70,107 @@ func main() {
 	middleware2 := &Middleware2{next: middleware1}
 
 	// 处理请求
-	response := middleware2.Handle("Request data")
+	response := middleware2.Handle(context.Background(), "Request data")
 	fmt.Println("Response:", response)
+
+	// 把职责链挂到 net/http 上，并套上标准中间件
+	logger := log.New(os.Stdout, "[http] ", 0)
+	server := ChainHTTP(NewHTTPAdapter(middleware2),
+		RecoveryMiddleware(logger),
+		LoggingMiddleware(logger),
+		RequestIDMiddleware(),
+		RateLimitMiddleware(NewTokenBucket(1, 2)),
+		BasicAuthMiddleware("demo", map[string]string{"admin": "secret"}),
+	)
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/orders", nil)
+		req.SetBasicAuth("admin", "secret")
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		fmt.Println("HTTP Response:", rec.Code, rec.Body.String())
+	}
+
+	// 按条件路由到不同子链，维护模式下直接短路
+	trace := &Trace{}
+	api := NewTracedHandler("api", HandlerFunc(func(ctx context.Context, request string) string {
+		return "api: " + ParseRequest(request).Path
+	}), trace)
+	admin := NewTracedHandler("admin", HandlerFunc(func(ctx context.Context, request string) string {
+		return "admin: " + ParseRequest(request).Path
+	}), trace)
+	router := NewRouter().
+		AddRoute("admin", All(PathPrefix("/admin"), HeaderEquals("X-Role", "admin")), admin).
+		AddRoute("api", PathPrefix("/api"), api).
+		SetFallback(NewTracedHandler("notFound", HandlerFunc(func(context.Context, string) string { return "404 not found" }), trace))
+	entry := NewTracedHandler("maintenance", NewShortCircuitHandler(HeaderEquals("X-Maintenance", "on"), "503 under maintenance", router), trace)
+
+	for _, request := range []string{
+		"GET /api/users",
+		"GET /admin/stats\nX-Role: admin",
+		"GET /admin/stats",
+		"GET /api/users\nX-Maintenance: on",
+	} {
+		trace.Reset()
+		fmt.Printf("%q => %s %s\n", request, entry.Handle(context.Background(), request), trace)
+	}
+
+	// 下游处理太慢，超时后请求在下一个处理者边界停止
+	slow := NewTimeoutHandler(50*time.Millisecond,
+		NewSleepHandler("Slow1", 30*time.Millisecond,
+			NewSleepHandler("Slow2", 100*time.Millisecond, finalHandler)))
+	fmt.Println("Response:", slow.Handle(context.Background(), "Slow request"))
+
+	// 链中途取消，后面的处理者不再执行
+	ctx, cancel := context.WithCancel(context.Background())
+	canceller := HandlerFunc(func(ctx context.Context, request string) string {
+		fmt.Println("Canceller: cancelling request:", request)
+		cancel()
+		return callNext(ctx, middleware1, request)
+	})
+	fmt.Println("Response:", canceller.Handle(ctx, "Cancelled request"))
+
+	// 从配置组装链，并在运行时热替换
+	registry := NewDefaultMiddlewareRegistry()
+	chain, err := NewReloadableChain(registry, []byte(`{"middlewares": [
+		{"name": "timeout", "params": {"duration": "100ms"}},
+		{"name": "middleware2"},
+		{"name": "final"}
+	]}`))
+	if err != nil {
+		fmt.Println("Build chain failed:", err)
+		return
+	}
+	fmt.Println("Response:", chain.Handle(context.Background(), "Configured request"))
+
+	err = chain.Reload([]byte(`{"middlewares": [
+		{"name": "timeout", "params": {"duration": "soon"}},
+		{"name": "compress"},
+		{"name": "final"}
+	]}`))
+	fmt.Println("Reload failed, keeping old chain:\n", err)
+
+	if err := chain.Reload([]byte(`{"middlewares": [{"name": "middleware1"}, {"name": "final"}]}`)); err == nil {
+		fmt.Println("Response:", chain.Handle(context.Background(), "Reloaded request"))
+	}
+
+	// 为每个中间件记录 Span 和指标
+	recorder := NewRecorder()
+	instrumented := NewDefaultMiddlewareRegistry()
+	recorder.InstrumentRegistry(instrumented)
+	traced, err := instrumented.BuildJSON([]byte(`{"middlewares": [
+		{"name": "timeout", "params": {"duration": "50ms"}},
+		{"name": "sleep", "params": {"name": "Slow", "delay": "20ms"}},
+		{"name": "final"}
+	]}`))
+	if err != nil {
+		fmt.Println("Build chain failed:", err)
+		return
+	}
+	traced.Handle(context.Background(), "Traced request")
+	recorder.WriteTrace(os.Stdout)
+	recorder.WriteReport(os.Stdout)
+
+	rec := httptest.NewRecorder()
+	recorder.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	fmt.Print(rec.Body.String())
 }
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 链路追踪与指标
+// InstrumentedHandler 包装任意处理者，每次调用记录一个 Span（名称、耗时、结果、嵌套层级），
+// 同时按处理者汇总调用次数和耗时直方图，可以导出为文本报告或 Prometheus 文本格式。
+// 嵌套关系通过 ctx 传递：外层处理者的 Span 放在 ctx 中，下游处理者据此得到父 Span 和层级。
+
+// Outcome 是一次处理的结果
+type Outcome string
+
+const (
+	OutcomeOK        Outcome = "ok"
+	OutcomeCancelled Outcome = "cancelled"
+	OutcomeTimeout   Outcome = "timeout"
+	OutcomePanic     Outcome = "panic"
+)
+
+// Span 记录一个处理者的一次执行
+type Span struct {
+	ID       int
+	ParentID int // 0 表示没有父 Span
+	Depth    int
+	Name     string
+	Start    time.Time
+	Duration time.Duration
+	Outcome  Outcome
+}
+
+type spanKey struct{}
+
+// defaultBuckets 是耗时直方图的桶上界
+var defaultBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// handlerMetrics 是单个处理者的汇总指标
+type handlerMetrics struct {
+	counts  map[Outcome]int
+	buckets []int // 与 Recorder.buckets 一一对应的累计计数
+	sum     time.Duration
+	total   int
+}
+
+// Recorder 收集 Span 并汇总指标，可以被多条链共享
+type Recorder struct {
+	mu       sync.Mutex
+	nextID   int
+	spans    []Span
+	maxSpans int
+	buckets  []time.Duration
+	metrics  map[string]*handlerMetrics
+	now      func() time.Time
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{
+		maxSpans: 1024,
+		buckets:  defaultBuckets,
+		metrics:  map[string]*handlerMetrics{},
+		now:      time.Now,
+	}
+}
+
+func (r *Recorder) startSpan(ctx context.Context, name string) *Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	span := &Span{ID: r.nextID, Name: name, Start: r.now()}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok {
+		span.ParentID = parent.ID
+		span.Depth = parent.Depth + 1
+	}
+	return span
+}
+
+func (r *Recorder) finishSpan(span *Span, outcome Outcome) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	span.Duration = r.now().Sub(span.Start)
+	span.Outcome = outcome
+
+	// 只保留最近的 maxSpans 个 Span
+	r.spans = append(r.spans, *span)
+	if len(r.spans) > r.maxSpans {
+		r.spans = r.spans[len(r.spans)-r.maxSpans:]
+	}
+
+	m, ok := r.metrics[span.Name]
+	if !ok {
+		m = &handlerMetrics{counts: map[Outcome]int{}, buckets: make([]int, len(r.buckets))}
+		r.metrics[span.Name] = m
+	}
+	m.counts[outcome]++
+	m.total++
+	m.sum += span.Duration
+	for i, le := range r.buckets {
+		if span.Duration <= le {
+			m.buckets[i]++
+		}
+	}
+}
+
+// Spans 返回已完成的 Span，按完成顺序排列
+func (r *Recorder) Spans() []Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Span(nil), r.spans...)
+}
+
+// Reset 清空所有 Span 和指标
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+	r.metrics = map[string]*handlerMetrics{}
+}
+
+// InstrumentedHandler 为处理者记录 Span 和指标
+type InstrumentedHandler struct {
+	name     string
+	handler  Handler
+	recorder *Recorder
+}
+
+func NewInstrumentedHandler(name string, handler Handler, recorder *Recorder) *InstrumentedHandler {
+	return &InstrumentedHandler{name: name, handler: handler, recorder: recorder}
+}
+
+func (h *InstrumentedHandler) Handle(ctx context.Context, request string) (response string) {
+	span := h.recorder.startSpan(ctx, h.name)
+	stop := &stopReason{}
+	defer func() {
+		if err := recover(); err != nil {
+			h.recorder.finishSpan(span, OutcomePanic)
+			panic(err)
+		}
+		err := ctx.Err()
+		if err == nil {
+			err = stop.get()
+		}
+		if err != nil {
+			// 取消响应会继续向外层返回，外层的 Span 也记为同样的结果
+			if parent, ok := ctx.Value(stopKey{}).(*stopReason); ok {
+				parent.set(err)
+			}
+		}
+		h.recorder.finishSpan(span, outcomeOf(err))
+	}()
+	ctx = context.WithValue(ctx, spanKey{}, span)
+	return h.handler.Handle(context.WithValue(ctx, stopKey{}, stop), request)
+}
+
+// outcomeOf 根据结束的原因判断处理结果：自己的 ctx 结束，或者下游因为 ctx 结束而提前返回
+// 下游超时时外层 ctx 可能仍然有效，原因由 callNext、TimeoutHandler 等通过 stopped 记录
+func outcomeOf(err error) Outcome {
+	switch {
+	case err == nil:
+		return OutcomeOK
+	case errors.Is(err, context.DeadlineExceeded):
+		return OutcomeTimeout
+	}
+	return OutcomeCancelled
+}
+
+// InstrumentRegistry 让注册表构造出来的每个中间件都带上观测
+// 只影响调用之前已经注册的中间件
+func (r *Recorder) InstrumentRegistry(registry *MiddlewareRegistry) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for name, factory := range registry.factories {
+		registry.factories[name] = func(params Params, next Handler) (Handler, error) {
+			handler, err := factory(params, next)
+			if err != nil {
+				return nil, err
+			}
+			return NewInstrumentedHandler(name, handler, r), nil
+		}
+	}
+}
+
+func (r *Recorder) sortedNames() []string {
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WriteReport 输出人类可读的文本报告：每个处理者的调用次数、各结果计数和平均耗时
+func (r *Recorder) WriteReport(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-16s %6s %6s %9s %7s %6s %12s\n", "handler", "calls", "ok", "cancelled", "timeout", "panic", "avg")
+	for _, name := range r.sortedNames() {
+		m := r.metrics[name]
+		avg := time.Duration(0)
+		if m.total > 0 {
+			avg = m.sum / time.Duration(m.total)
+		}
+		fmt.Fprintf(&b, "%-16s %6d %6d %9d %7d %6d %12s\n", name, m.total,
+			m.counts[OutcomeOK], m.counts[OutcomeCancelled], m.counts[OutcomeTimeout], m.counts[OutcomePanic], avg)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteTrace 按嵌套层级缩进输出 Span，便于查看时间花在哪里
+func (r *Recorder) WriteTrace(w io.Writer) error {
+	var b strings.Builder
+	spans := r.Spans()
+	// Span 按完成顺序记录，外层最后完成，这里按开始顺序（即 ID）输出
+	sort.Slice(spans, func(i, j int) bool { return spans[i].ID < spans[j].ID })
+	for _, s := range spans {
+		fmt.Fprintf(&b, "%s%s %s %s\n", strings.Repeat("  ", s.Depth), s.Name, s.Duration, s.Outcome)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WritePrometheus 以 Prometheus 文本格式输出调用计数和耗时直方图
+func (r *Recorder) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP chain_handler_requests_total Number of requests handled by each handler.\n")
+	b.WriteString("# TYPE chain_handler_requests_total counter\n")
+	names := r.sortedNames()
+	for _, name := range names {
+		m := r.metrics[name]
+		for _, outcome := range []Outcome{OutcomeOK, OutcomeCancelled, OutcomeTimeout, OutcomePanic} {
+			if m.counts[outcome] == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, "chain_handler_requests_total{handler=\"%s\",outcome=\"%s\"} %d\n", escapeLabel(name), outcome, m.counts[outcome])
+		}
+	}
+
+	b.WriteString("# HELP chain_handler_duration_seconds Time spent in each handler, including downstream handlers.\n")
+	b.WriteString("# TYPE chain_handler_duration_seconds histogram\n")
+	for _, name := range names {
+		m := r.metrics[name]
+		label := escapeLabel(name)
+		for i, le := range r.buckets {
+			fmt.Fprintf(&b, "chain_handler_duration_seconds_bucket{handler=\"%s\",le=\"%g\"} %d\n", label, le.Seconds(), m.buckets[i])
+		}
+		fmt.Fprintf(&b, "chain_handler_duration_seconds_bucket{handler=\"%s\",le=\"+Inf\"} %d\n", label, m.total)
+		fmt.Fprintf(&b, "chain_handler_duration_seconds_sum{handler=\"%s\"} %g\n", label, m.sum.Seconds())
+		fmt.Fprintf(&b, "chain_handler_duration_seconds_count{handler=\"%s\"} %d\n", label, m.total)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// labelEscaper 按 Prometheus 文本格式转义标签值：只转义反斜杠、双引号和换行，其余字符（包括非 ASCII）原样输出
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// MetricsHandler 返回导出指标的 http.Handler
+// /metrics 输出 Prometheus 格式，/report 输出文本报告，/trace 输出最近的 Span
+func (r *Recorder) MetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WritePrometheus(w)
+	})
+	mux.HandleFunc("/report", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		r.WriteReport(w)
+	})
+	mux.HandleFunc("/trace", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		r.WriteTrace(w)
+	})
+	return mux
+}
+
+// ServeMetrics 在本地地址上启动指标服务，例如 "127.0.0.1:9090"
+func (r *Recorder) ServeMetrics(addr string) error {
+	return http.ListenAndServe(addr, r.MetricsHandler())
+}
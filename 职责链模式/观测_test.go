@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePrometheusEscapesLabels(t *testing.T) {
+	recorder := NewRecorder()
+	name := "鉴权 \"v2\"\\new\nline\t"
+	NewInstrumentedHandler(name, &FinalHandler{}, recorder).Handle(context.Background(), "GET /")
+
+	var b strings.Builder
+	if err := recorder.WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	// 非 ASCII 字符和制表符原样输出，只转义反斜杠、双引号和换行
+	want := `chain_handler_requests_total{handler="鉴权 \"v2\"\\new\nline` + "\t" + `",outcome="ok"} 1`
+	if !strings.Contains(b.String(), want+"\n") {
+		t.Fatalf("output does not contain %s:\n%s", want, b.String())
+	}
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "chain_handler_") {
+			t.Errorf("label value split the sample line: %q", line)
+		}
+	}
+}
+
+// steppingRecorder 返回的 Recorder 每读一次时间就前进 step
+func steppingRecorder(step time.Duration) *Recorder {
+	recorder := NewRecorder()
+	now := time.Unix(0, 0)
+	recorder.now = func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+	return recorder
+}
+
+func TestInstrumentedHandlerSpans(t *testing.T) {
+	recorder := steppingRecorder(time.Millisecond)
+	inner := NewInstrumentedHandler("inner", respond("done"), recorder)
+	outer := NewInstrumentedHandler("outer", inner, recorder)
+	if got := outer.Handle(context.Background(), "GET /"); got != "done" {
+		t.Fatalf("response = %q, want done", got)
+	}
+
+	// 按完成顺序记录，内层先完成
+	start := time.Unix(0, 0)
+	want := []Span{
+		{ID: 2, ParentID: 1, Depth: 1, Name: "inner", Start: start.Add(2 * time.Millisecond), Duration: time.Millisecond, Outcome: OutcomeOK},
+		{ID: 1, Name: "outer", Start: start.Add(time.Millisecond), Duration: 3 * time.Millisecond, Outcome: OutcomeOK},
+	}
+	if got := recorder.Spans(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Spans = %+v, want %+v", got, want)
+	}
+
+	var b strings.Builder
+	if err := recorder.WriteTrace(&b); err != nil {
+		t.Fatal(err)
+	}
+	if want := "outer 3ms ok\n  inner 1ms ok\n"; b.String() != want {
+		t.Fatalf("WriteTrace = %q, want %q", b.String(), want)
+	}
+}
+
+// blockUntilDone 等到 ctx 结束，像不经过 callNext 的处理者那样直接返回取消响应
+var blockUntilDone = HandlerFunc(func(ctx context.Context, _ string) string {
+	<-ctx.Done()
+	return CancelledResponse(ctx.Err())
+})
+
+func TestInstrumentedHandlerOutcomes(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(r *Recorder) Handler
+		ctx   func() context.Context
+		want  map[string]Outcome
+	}{
+		{
+			// 处理者返回的文本与取消响应相同，但 ctx 没有结束
+			name: "cancelled text is not an outcome",
+			build: func(r *Recorder) Handler {
+				return NewInstrumentedHandler("a", respond(CancelledResponse(context.DeadlineExceeded)), r)
+			},
+			want: map[string]Outcome{"a": OutcomeOK},
+		},
+		{
+			name: "cancelled ctx",
+			build: func(r *Recorder) Handler {
+				return NewInstrumentedHandler("a", NewShortCircuitHandler(HeaderEquals("X", "1"), "x", respond("b")), r)
+			},
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			want: map[string]Outcome{"a": OutcomeCancelled},
+		},
+		{
+			// 外层的 ctx 仍然有效，超时原因从 TimeoutHandler 传到外面的每一层
+			name: "downstream timeout",
+			build: func(r *Recorder) Handler {
+				inner := NewInstrumentedHandler("c", blockUntilDone, r)
+				return NewInstrumentedHandler("a", NewInstrumentedHandler("b", NewTimeoutHandler(5*time.Millisecond, inner), r), r)
+			},
+			want: map[string]Outcome{"a": OutcomeTimeout, "b": OutcomeTimeout, "c": OutcomeTimeout},
+		},
+		{
+			// 处理者取消了自己派生的 ctx，callNext 在下一个处理者边界停止
+			name: "cancelled at the next handler",
+			build: func(r *Recorder) Handler {
+				canceller := HandlerFunc(func(ctx context.Context, request string) string {
+					ctx, cancel := context.WithCancel(ctx)
+					cancel()
+					return callNext(ctx, respond("b"), request)
+				})
+				return NewInstrumentedHandler("a", canceller, r)
+			},
+			want: map[string]Outcome{"a": OutcomeCancelled},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := NewRecorder()
+			ctx := context.Background()
+			if tt.ctx != nil {
+				ctx = tt.ctx()
+			}
+			tt.build(recorder).Handle(ctx, "GET /")
+
+			// 超时后内层还在后台运行，等它的 Span 也完成
+			deadline := time.Now().Add(5 * time.Second)
+			for len(recorder.Spans()) < len(tt.want) && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			got := map[string]Outcome{}
+			for _, span := range recorder.Spans() {
+				got[span.Name] = span.Outcome
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("outcomes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstrumentedHandlerPanic(t *testing.T) {
+	recorder := NewRecorder()
+	handler := NewInstrumentedHandler("a", HandlerFunc(func(context.Context, string) string { panic("boom") }), recorder)
+	func() {
+		defer func() {
+			if err := recover(); err != "boom" {
+				t.Fatalf("recovered %v, want the original panic", err)
+			}
+		}()
+		handler.Handle(context.Background(), "GET /")
+	}()
+	if spans := recorder.Spans(); len(spans) != 1 || spans[0].Outcome != OutcomePanic {
+		t.Fatalf("Spans = %+v, want one panic span", spans)
+	}
+}
+
+func TestRecorderMetrics(t *testing.T) {
+	recorder := NewRecorder()
+	now := time.Unix(0, 0)
+	recorder.now = func() time.Time { return now }
+	// 请求内容是处理耗时
+	handler := NewInstrumentedHandler("h", HandlerFunc(func(_ context.Context, request string) string {
+		d, _ := time.ParseDuration(request)
+		now = now.Add(d)
+		return "ok"
+	}), recorder)
+	for _, d := range []string{"2ms", "20ms", "2s"} {
+		handler.Handle(context.Background(), d)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	handler.Handle(ctx, "0s")
+
+	var b strings.Builder
+	if err := recorder.WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP chain_handler_requests_total Number of requests handled by each handler.
+# TYPE chain_handler_requests_total counter
+chain_handler_requests_total{handler="h",outcome="ok"} 3
+chain_handler_requests_total{handler="h",outcome="cancelled"} 1
+# HELP chain_handler_duration_seconds Time spent in each handler, including downstream handlers.
+# TYPE chain_handler_duration_seconds histogram
+chain_handler_duration_seconds_bucket{handler="h",le="0.001"} 1
+chain_handler_duration_seconds_bucket{handler="h",le="0.005"} 2
+chain_handler_duration_seconds_bucket{handler="h",le="0.01"} 2
+chain_handler_duration_seconds_bucket{handler="h",le="0.05"} 3
+chain_handler_duration_seconds_bucket{handler="h",le="0.1"} 3
+chain_handler_duration_seconds_bucket{handler="h",le="0.5"} 3
+chain_handler_duration_seconds_bucket{handler="h",le="1"} 3
+chain_handler_duration_seconds_bucket{handler="h",le="+Inf"} 4
+chain_handler_duration_seconds_sum{handler="h"} 2.022
+chain_handler_duration_seconds_count{handler="h"} 4
+`
+	if b.String() != want {
+		t.Fatalf("WritePrometheus =\n%s\nwant\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	if err := recorder.WriteReport(&b); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(b.String(), "\n")
+	if fields := strings.Fields(lines[1]); !reflect.DeepEqual(fields, []string{"h", "4", "3", "1", "0", "0", "505.5ms"}) {
+		t.Fatalf("report line = %q", lines[1])
+	}
+
+	recorder.Reset()
+	if len(recorder.Spans()) != 0 {
+		t.Fatal("Reset kept the spans")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 取消与超时
+// 请求的 ctx 沿链向下传递，每个处理者在调用下游之前通过 callNext 检查 ctx，
+// 一旦 ctx 被取消或超时，请求就在下一个处理者边界停止，不再继续往下走。
+
+// CancelledResponse 是请求被取消或超时后返回的响应
+func CancelledResponse(err error) string {
+	return fmt.Sprintf("Request cancelled: %v", err)
+}
+
+// stopKey 在 ctx 中保存最近一个 InstrumentedHandler 的 stopReason
+type stopKey struct{}
+
+// stopReason 记录链在这次调用里因为 ctx 结束而提前返回的原因
+// TimeoutHandler 超时后下游还在后台运行，可能在外层返回之后才写入，所以要加锁
+type stopReason struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (s *stopReason) set(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *stopReason) get() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// stopped 返回取消响应，并把原因记在 ctx 中，外层的 InstrumentedHandler 据此判断结果，而不是比较响应文本
+func stopped(ctx context.Context, err error) string {
+	if s, ok := ctx.Value(stopKey{}).(*stopReason); ok {
+		s.set(err)
+	}
+	return CancelledResponse(err)
+}
+
+// callNext 在 ctx 仍然有效时调用下一个处理者，否则直接返回取消响应
+func callNext(ctx context.Context, next Handler, request string) string {
+	if err := ctx.Err(); err != nil {
+		return stopped(ctx, err)
+	}
+	return next.Handle(ctx, request)
+}
+
+// TimeoutHandler 为下游设置超时，超时后立即返回，不再等待下游
+// 下游拿到的是带超时的 ctx，会在下一个处理者边界停止
+type TimeoutHandler struct {
+	timeout time.Duration
+	next    Handler
+}
+
+func NewTimeoutHandler(timeout time.Duration, next Handler) *TimeoutHandler {
+	return &TimeoutHandler{timeout: timeout, next: next}
+}
+
+func (h *TimeoutHandler) Handle(ctx context.Context, request string) string {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	done := make(chan string, 1)
+	go func() {
+		done <- callNext(ctx, h.next, request)
+	}()
+
+	select {
+	case response := <-done:
+		return response
+	case <-ctx.Done():
+		return stopped(ctx, ctx.Err())
+	}
+}
+
+// SleepHandler 模拟一个耗时的处理者，等待期间响应 ctx 的取消
+type SleepHandler struct {
+	name  string
+	delay time.Duration
+	next  Handler
+}
+
+func NewSleepHandler(name string, delay time.Duration, next Handler) *SleepHandler {
+	return &SleepHandler{name: name, delay: delay, next: next}
+}
+
+func (h *SleepHandler) Handle(ctx context.Context, request string) string {
+	fmt.Printf("%s: Handling request: %s\n", h.name, request)
+	select {
+	case <-time.After(h.delay):
+	case <-ctx.Done():
+		fmt.Printf("%s: cancelled while working\n", h.name)
+		return stopped(ctx, ctx.Err())
+	}
+	if h.next != nil {
+		return callNext(ctx, h.next, request)
+	}
+	return "Request handled by " + h.name
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingHandler 记录被调用的次数，next 为 nil 时自己处理请求
+type countingHandler struct {
+	name  string
+	calls atomic.Int32
+	next  Handler
+}
+
+func (h *countingHandler) Handle(ctx context.Context, request string) string {
+	h.calls.Add(1)
+	if h.next != nil {
+		return callNext(ctx, h.next, request)
+	}
+	return "handled by " + h.name
+}
+
+func TestCancelStopsChain(t *testing.T) {
+	last := &countingHandler{name: "last"}
+	middle := &countingHandler{name: "middle", next: last}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first := HandlerFunc(func(ctx context.Context, request string) string {
+		cancel()
+		return callNext(ctx, middle, request)
+	})
+
+	got := first.Handle(ctx, "GET /")
+	if want := CancelledResponse(context.Canceled); got != want {
+		t.Fatalf("response = %q, want %q", got, want)
+	}
+	if n := middle.calls.Load() + last.calls.Load(); n != 0 {
+		t.Fatalf("%d handlers after the cancellation point ran, want 0", n)
+	}
+}
+
+func TestCancelledHTTPRequestStopsChain(t *testing.T) {
+	last := &countingHandler{name: "last"}
+	first := &countingHandler{name: "first", next: last}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequestWithContext(ctx, "GET", "/users", nil)
+	w := httptest.NewRecorder()
+	NewHTTPAdapter(first).ServeHTTP(w, r)
+
+	if want := CancelledResponse(context.Canceled); w.Body.String() != want {
+		t.Fatalf("body = %q, want %q", w.Body.String(), want)
+	}
+	if first.calls.Load() != 1 || last.calls.Load() != 0 {
+		t.Fatalf("calls: first=%d last=%d, want first=1 last=0", first.calls.Load(), last.calls.Load())
+	}
+}
+
+func TestTimeoutHandlerDeadlineExceeded(t *testing.T) {
+	after := &countingHandler{name: "after"}
+	release, finished := make(chan struct{}), make(chan struct{})
+	slow := HandlerFunc(func(ctx context.Context, request string) string {
+		defer close(finished)
+		<-release
+		return callNext(ctx, after, request)
+	})
+
+	start := time.Now()
+	got := NewTimeoutHandler(20*time.Millisecond, slow).Handle(context.Background(), "GET /slow")
+	if want := CancelledResponse(context.DeadlineExceeded); got != want {
+		t.Fatalf("response = %q, want %q", got, want)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("TimeoutHandler waited %v for the slow handler", elapsed)
+	}
+	// 慢处理者结束后，下游拿到的是已经超时的 ctx，不会再被调用
+	close(release)
+	<-finished
+	if after.calls.Load() != 0 {
+		t.Fatal("handler after the timeout ran")
+	}
+}
+
+func TestTimeoutHandlerPassesFastResponse(t *testing.T) {
+	last := &countingHandler{name: "last"}
+	got := NewTimeoutHandler(time.Second, last).Handle(context.Background(), "GET /")
+	if got != "handled by last" {
+		t.Fatalf("response = %q, want handled by last", got)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// 条件路由与短路
+// 前面的中间件只要有 next 就一定往下传，这里补充三种能力：
+// 1. 短路：处理者自己给出响应，不再调用下游
+// 2. 路由：按谓词（路径前缀、请求头、请求内容）把请求分发到不同的子链
+// 3. 兜底：没有任何处理者认领请求时交给 fallback
+// 同时通过 Trace 记录一次请求实际经过了哪些处理者。
+
+// 链内请求字符串的完整格式与 HTTP 报文类似：
+//
+//	METHOD PATH
+//	Header-Name: value
+//
+//	body
+//
+// 只有第一行是必须的。
+
+// Request 是解析后的链内请求
+type Request struct {
+	Method string
+	Path   string
+	Header map[string]string
+	Body   string
+}
+
+// ParseRequest 解析链内请求字符串，请求头名称统一转为小写
+func ParseRequest(request string) Request {
+	head, body, _ := strings.Cut(request, "\n\n")
+	lines := strings.Split(head, "\n")
+	req := Request{Header: map[string]string{}, Body: body}
+	req.Method, req.Path, _ = strings.Cut(strings.TrimSpace(lines[0]), " ")
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		req.Header[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+	return req
+}
+
+// HandlerFunc 让普通函数也能作为处理者
+type HandlerFunc func(ctx context.Context, request string) string
+
+func (f HandlerFunc) Handle(ctx context.Context, request string) string {
+	return f(ctx, request)
+}
+
+// Predicate 判断请求是否满足某个条件
+type Predicate func(req Request) bool
+
+// PathPrefix 匹配路径前缀
+func PathPrefix(prefix string) Predicate {
+	return func(req Request) bool {
+		return strings.HasPrefix(req.Path, prefix)
+	}
+}
+
+// MethodIs 匹配请求方法
+func MethodIs(method string) Predicate {
+	return func(req Request) bool {
+		return strings.EqualFold(req.Method, method)
+	}
+}
+
+// HeaderEquals 匹配请求头的值，请求头名称不区分大小写
+func HeaderEquals(name, value string) Predicate {
+	return func(req Request) bool {
+		return req.Header[strings.ToLower(name)] == value
+	}
+}
+
+// BodyContains 匹配请求体中包含的内容
+func BodyContains(substr string) Predicate {
+	return func(req Request) bool {
+		return strings.Contains(req.Body, substr)
+	}
+}
+
+// All 所有谓词都满足时才匹配
+func All(predicates ...Predicate) Predicate {
+	return func(req Request) bool {
+		for _, p := range predicates {
+			if !p(req) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// ShortCircuitHandler 在谓词满足时直接返回响应，不再调用下游
+// 谓词不满足又没有下游时，请求没有被任何处理者认领，返回 NoHandlerResponse
+type ShortCircuitHandler struct {
+	match    Predicate
+	response string
+	next     Handler
+}
+
+func NewShortCircuitHandler(match Predicate, response string, next Handler) *ShortCircuitHandler {
+	return &ShortCircuitHandler{match: match, response: response, next: next}
+}
+
+func (h *ShortCircuitHandler) Handle(ctx context.Context, request string) string {
+	if h.match(ParseRequest(request)) {
+		return h.response
+	}
+	if h.next != nil {
+		return callNext(ctx, h.next, request)
+	}
+	return NoHandlerResponse
+}
+
+// Route 是一条路由规则，满足 Match 的请求交给 Handler（通常是一条子链）
+type Route struct {
+	Name    string
+	Match   Predicate
+	Handler Handler
+}
+
+// Router 按注册顺序匹配路由，第一条满足条件的路由处理请求
+// 没有路由匹配时交给 fallback，fallback 也为空时返回 NoHandlerResponse
+type Router struct {
+	routes   []Route
+	fallback Handler
+}
+
+// NoHandlerResponse 是没有任何处理者认领请求时的响应
+const NoHandlerResponse = "No handler for request"
+
+func NewRouter(routes ...Route) *Router {
+	return &Router{routes: routes}
+}
+
+// AddRoute 追加一条路由
+func (r *Router) AddRoute(name string, match Predicate, handler Handler) *Router {
+	r.routes = append(r.routes, Route{Name: name, Match: match, Handler: handler})
+	return r
+}
+
+// SetFallback 设置兜底处理者
+func (r *Router) SetFallback(fallback Handler) *Router {
+	r.fallback = fallback
+	return r
+}
+
+func (r *Router) Handle(ctx context.Context, request string) string {
+	req := ParseRequest(request)
+	for _, route := range r.routes {
+		if route.Match(req) {
+			return callNext(ctx, route.Handler, request)
+		}
+	}
+	if r.fallback != nil {
+		return callNext(ctx, r.fallback, request)
+	}
+	return NoHandlerResponse
+}
+
+// Trace 记录请求实际经过的处理者，按进入顺序排列
+type Trace struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (t *Trace) record(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.steps = append(t.steps, name)
+}
+
+// Steps 返回已经执行过的处理者名称
+func (t *Trace) Steps() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.steps...)
+}
+
+// Reset 清空记录，便于复用同一个 Trace 观察下一次请求
+func (t *Trace) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.steps = nil
+}
+
+func (t *Trace) String() string {
+	return fmt.Sprintf("[%s]", strings.Join(t.Steps(), " -> "))
+}
+
+// TracedHandler 在处理者被调用时把名称写入 Trace
+type TracedHandler struct {
+	name    string
+	handler Handler
+	trace   *Trace
+}
+
+func NewTracedHandler(name string, handler Handler, trace *Trace) *TracedHandler {
+	return &TracedHandler{name: name, handler: handler, trace: trace}
+}
+
+func (h *TracedHandler) Handle(ctx context.Context, request string) string {
+	h.trace.record(h.name)
+	return h.handler.Handle(ctx, request)
+}
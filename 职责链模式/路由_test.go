@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func respond(response string) Handler {
+	return HandlerFunc(func(context.Context, string) string { return response })
+}
+
+func TestParseRequest(t *testing.T) {
+	req := ParseRequest("POST /api/users\nContent-Type: application/json\nX-Trace :  abc \n\n{\"name\": \"a\"}")
+	want := Request{
+		Method: "POST",
+		Path:   "/api/users",
+		Header: map[string]string{"content-type": "application/json", "x-trace": "abc"},
+		Body:   `{"name": "a"}`,
+	}
+	if !reflect.DeepEqual(req, want) {
+		t.Fatalf("ParseRequest = %+v, want %+v", req, want)
+	}
+}
+
+func TestShortCircuitHandler(t *testing.T) {
+	maintenance := HeaderEquals("X-Maintenance", "on")
+	tests := []struct {
+		name    string
+		next    Handler
+		request string
+		want    string
+	}{
+		{"match", respond("downstream"), "GET /\nx-maintenance: on", "503"},
+		{"match without next", nil, "GET /\nX-Maintenance: on", "503"},
+		{"no match with next", respond("downstream"), "GET /", "downstream"},
+		{"no match without next", nil, "GET /\nX-Maintenance: off", NoHandlerResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewShortCircuitHandler(maintenance, "503", tt.next)
+			if got := h.Handle(context.Background(), tt.request); got != tt.want {
+				t.Fatalf("response = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouter(t *testing.T) {
+	router := NewRouter(Route{Name: "admin", Match: All(MethodIs("POST"), PathPrefix("/admin")), Handler: respond("admin")}).
+		AddRoute("api", PathPrefix("/api"), respond("api")).
+		AddRoute("beta", HeaderEquals("X-Beta", "1"), respond("beta")).
+		AddRoute("json", BodyContains(`"type": "order"`), respond("order"))
+	tests := []struct {
+		request string
+		want    string
+	}{
+		{"POST /admin/users", "admin"},
+		{"get /admin/users", NoHandlerResponse},
+		{"GET /api/users", "api"},
+		// 前面的路由先匹配
+		{"GET /api/users\nX-Beta: 1", "api"},
+		{"GET /home\nx-beta: 1", "beta"},
+		{"POST /events\n\n{\"type\": \"order\"}", "order"},
+		{"GET /home", NoHandlerResponse},
+	}
+	for _, tt := range tests {
+		if got := router.Handle(context.Background(), tt.request); got != tt.want {
+			t.Errorf("%q: response = %q, want %q", tt.request, got, tt.want)
+		}
+	}
+
+	router.SetFallback(respond("404"))
+	if got := router.Handle(context.Background(), "GET /home"); got != "404" {
+		t.Fatalf("with fallback: response = %q, want 404", got)
+	}
+	if got := router.Handle(context.Background(), "GET /api"); got != "api" {
+		t.Fatalf("fallback took a matched request: %q", got)
+	}
+}
+
+func TestTraceRecordsHandlersThatRan(t *testing.T) {
+	trace := &Trace{}
+	router := NewRouter().
+		AddRoute("api", PathPrefix("/api"), NewTracedHandler("api", respond("api"), trace)).
+		SetFallback(NewTracedHandler("notFound", respond("404"), trace))
+	entry := NewTracedHandler("maintenance", NewShortCircuitHandler(HeaderEquals("X-Maintenance", "on"), "503", router), trace)
+
+	tests := []struct {
+		request string
+		want    string
+		steps   []string
+	}{
+		{"GET /api/users", "api", []string{"maintenance", "api"}},
+		{"GET /home", "404", []string{"maintenance", "notFound"}},
+		{"GET /api/users\nX-Maintenance: on", "503", []string{"maintenance"}},
+	}
+	for _, tt := range tests {
+		trace.Reset()
+		if got := entry.Handle(context.Background(), tt.request); got != tt.want {
+			t.Errorf("%q: response = %q, want %q", tt.request, got, tt.want)
+		}
+		if steps := trace.Steps(); !reflect.DeepEqual(steps, tt.steps) {
+			t.Errorf("%q: trace = %q, want %q", tt.request, steps, tt.steps)
+		}
+	}
+	if got := trace.String(); got != "[maintenance]" {
+		t.Fatalf("String = %s", got)
+	}
+}
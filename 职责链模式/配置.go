@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 配置驱动的链组装
+// 在配置文件中按顺序声明中间件名称和参数，启动时由注册表中的构造函数把它们组装成一条链。
+// 配置示例：
+//
+//	{
+//	  "middlewares": [
+//	    {"name": "timeout", "params": {"duration": "100ms"}},
+//	    {"name": "middleware1"},
+//	    {"name": "final"}
+//	  ]
+//	}
+//
+// 列表中第一个中间件位于链的最外层，最后一个中间件的 next 为 nil，final 只能放在最后。
+// 构造函数没有读取的参数视为拼写错误，组装会失败。
+
+// MiddlewareConfig 是单个中间件的配置
+type MiddlewareConfig struct {
+	Name   string         `json:"name"`
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// ChainConfig 是整条链的配置
+type ChainConfig struct {
+	Middlewares []MiddlewareConfig `json:"middlewares"`
+}
+
+// ParseChainConfig 解析 JSON 格式的链配置
+func ParseChainConfig(data []byte) (ChainConfig, error) {
+	var config ChainConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return ChainConfig{}, fmt.Errorf("parse chain config: %w", err)
+	}
+	return config, nil
+}
+
+// MiddlewareFactory 根据参数构造一个处理者，next 为链中的下一个处理者，可能为 nil
+type MiddlewareFactory func(params Params, next Handler) (Handler, error)
+
+// ErrUnknownParam 表示配置中的参数没有被中间件的构造函数读取，通常是拼写错误
+var ErrUnknownParam = errors.New("unknown param")
+
+// Params 是中间件参数，提供带类型检查的读取方法，并记录哪些参数被读取过
+type Params struct {
+	values map[string]any
+	read   map[string]bool
+}
+
+// NewParams 用配置中的参数创建 Params
+func NewParams(values map[string]any) Params {
+	return Params{values: values, read: map[string]bool{}}
+}
+
+// String 读取字符串参数，参数缺失时返回默认值
+func (p Params) String(key, def string) (string, error) {
+	p.read[key] = true
+	v, ok := p.values[key]
+	if !ok {
+		return def, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("param %q: want string, got %T", key, v)
+	}
+	return s, nil
+}
+
+// Duration 读取形如 "100ms" 的时长参数，参数缺失时返回默认值
+func (p Params) Duration(key string, def time.Duration) (time.Duration, error) {
+	s, err := p.String(key, "")
+	if err != nil || s == "" {
+		return def, err
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("param %q: %w", key, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("param %q: must be positive, got %s", key, d)
+	}
+	return d, nil
+}
+
+// unread 按字母顺序返回没有被读取的参数
+func (p Params) unread() []string {
+	var keys []string
+	for key := range p.values {
+		if !p.read[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ErrUnknownMiddleware 表示配置中引用了没有注册的中间件
+var ErrUnknownMiddleware = errors.New("unknown middleware")
+
+// MiddlewareRegistry 保存中间件名称到构造函数的映射
+type MiddlewareRegistry struct {
+	mu        sync.RWMutex
+	factories map[string]MiddlewareFactory
+}
+
+func NewMiddlewareRegistry() *MiddlewareRegistry {
+	return &MiddlewareRegistry{factories: map[string]MiddlewareFactory{}}
+}
+
+// Register 注册一个中间件构造函数，同名注册会覆盖之前的构造函数
+func (r *MiddlewareRegistry) Register(name string, factory MiddlewareFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = factory
+}
+
+// Names 返回已注册的中间件名称，按字母排序
+func (r *MiddlewareRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Build 按配置组装链，每条错误都带有中间件的位置和名称
+// 先检查所有名称，未注册的名称汇总后一起返回；之后从最后一个中间件开始构造，遇到第一个出错的中间件就停止，
+// 因为它前面的中间件拿不到正确的 next，继续构造只会得到误导性的连带错误（例如 timeout 缺少 next）
+func (r *MiddlewareRegistry) Build(config ChainConfig) (Handler, error) {
+	if len(config.Middlewares) == 0 {
+		return nil, errors.New("chain config: no middlewares")
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var errs []error
+	for i, mc := range config.Middlewares {
+		if _, ok := r.factories[mc.Name]; !ok {
+			errs = append(errs, fmt.Errorf("middlewares[%d]: %w %q", i, ErrUnknownMiddleware, mc.Name))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	var next Handler
+	for i := len(config.Middlewares) - 1; i >= 0; i-- {
+		mc := config.Middlewares[i]
+		params := NewParams(mc.Params)
+		handler, err := r.factories[mc.Name](params, next)
+		if err == nil {
+			for _, key := range params.unread() {
+				errs = append(errs, fmt.Errorf("%w %q", ErrUnknownParam, key))
+			}
+			err = errors.Join(errs...)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("middlewares[%d] %q: %w", i, mc.Name, err)
+		}
+		next = handler
+	}
+	return next, nil
+}
+
+// BuildJSON 解析 JSON 配置并组装链
+func (r *MiddlewareRegistry) BuildJSON(data []byte) (Handler, error) {
+	config, err := ParseChainConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	return r.Build(config)
+}
+
+// NewDefaultMiddlewareRegistry 返回注册了本包内置中间件的注册表
+func NewDefaultMiddlewareRegistry() *MiddlewareRegistry {
+	r := NewMiddlewareRegistry()
+	r.Register("final", func(params Params, next Handler) (Handler, error) {
+		if next != nil {
+			return nil, errors.New("final must be the last middleware")
+		}
+		return &FinalHandler{}, nil
+	})
+	r.Register("middleware1", func(params Params, next Handler) (Handler, error) {
+		return &Middleware1{next: next}, nil
+	})
+	r.Register("middleware2", func(params Params, next Handler) (Handler, error) {
+		return &Middleware2{next: next}, nil
+	})
+	r.Register("timeout", func(params Params, next Handler) (Handler, error) {
+		d, err := params.Duration("duration", 0)
+		if err != nil {
+			return nil, err
+		}
+		if d == 0 {
+			return nil, errors.New(`param "duration" is required`)
+		}
+		if next == nil {
+			return nil, errors.New("timeout needs a next handler")
+		}
+		return NewTimeoutHandler(d, next), nil
+	})
+	r.Register("sleep", func(params Params, next Handler) (Handler, error) {
+		name, err := params.String("name", "SleepHandler")
+		if err != nil {
+			return nil, err
+		}
+		d, err := params.Duration("delay", 10*time.Millisecond)
+		if err != nil {
+			return nil, err
+		}
+		return NewSleepHandler(name, d, next), nil
+	})
+	r.Register("maintenance", func(params Params, next Handler) (Handler, error) {
+		header, err := params.String("header", "X-Maintenance")
+		if err != nil {
+			return nil, err
+		}
+		response, err := params.String("response", "503 under maintenance")
+		if err != nil {
+			return nil, err
+		}
+		return NewShortCircuitHandler(HeaderEquals(header, "on"), response, next), nil
+	})
+	return r
+}
+
+// ReloadableChain 持有当前生效的链，重新加载配置时原子地替换整条链
+// 正在处理中的请求继续使用旧链，新请求使用新链；新配置校验失败时保留旧链
+type ReloadableChain struct {
+	registry *MiddlewareRegistry
+	current  atomic.Pointer[chainHolder]
+}
+
+// chainHolder 包一层，使接口值可以存放在 atomic.Pointer 中
+type chainHolder struct {
+	handler Handler
+}
+
+func NewReloadableChain(registry *MiddlewareRegistry, config []byte) (*ReloadableChain, error) {
+	c := &ReloadableChain{registry: registry}
+	if err := c.Reload(config); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload 用新的 JSON 配置重建链，成功后原子替换
+func (c *ReloadableChain) Reload(config []byte) error {
+	handler, err := c.registry.BuildJSON(config)
+	if err != nil {
+		return err
+	}
+	c.current.Store(&chainHolder{handler: handler})
+	return nil
+}
+
+// ReloadFile 从文件读取配置并重建链
+func (c *ReloadableChain) ReloadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return c.Reload(data)
+}
+
+// WatchFile 按固定间隔检查配置文件的修改时间，发生变化时重新加载
+// 加载失败时调用 onError 并保留旧链，onError 为 nil 时忽略错误；ctx 取消后停止检查
+func (c *ReloadableChain) WatchFile(ctx context.Context, path string, interval time.Duration, onError func(error)) {
+	if onError == nil {
+		onError = func(error) {}
+	}
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil {
+				onError(err)
+				continue
+			}
+			if !info.ModTime().After(lastMod) {
+				continue
+			}
+			lastMod = info.ModTime()
+			if err := c.ReloadFile(path); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func (c *ReloadableChain) Handle(ctx context.Context, request string) string {
+	return c.current.Load().handler.Handle(ctx, request)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildValidConfig(t *testing.T) {
+	chain, err := NewDefaultMiddlewareRegistry().BuildJSON([]byte(`{"middlewares": [
+		{"name": "timeout", "params": {"duration": "1s"}},
+		{"name": "sleep", "params": {"name": "Slow", "delay": "1ms"}},
+		{"name": "final"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chain.Handle(context.Background(), "GET /"); got != "Request handled by FinalHandler" {
+		t.Fatalf("response = %q", got)
+	}
+}
+
+func TestBuildRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "final not last",
+			config: `[{"name": "final"}, {"name": "middleware1"}]`,
+			want:   `middlewares[0] "final": final must be the last middleware`,
+		},
+		{
+			name:    "misspelled param",
+			config:  `[{"name": "sleep", "params": {"dealy": "1s"}}, {"name": "final"}]`,
+			want:    `middlewares[0] "sleep": unknown param "dealy"`,
+			wantErr: ErrUnknownParam,
+		},
+		{
+			name:    "param of a middleware without params",
+			config:  `[{"name": "middleware1", "params": {"b": 1, "a": 2}}, {"name": "final"}]`,
+			want:    "middlewares[0] \"middleware1\": unknown param \"a\"\nunknown param \"b\"",
+			wantErr: ErrUnknownParam,
+		},
+		{
+			// sleep 构造失败后不再构造 timeout，否则 timeout 会因为拿不到 next 报出误导性的错误
+			name:   "stops at the first failing entry",
+			config: `[{"name": "timeout", "params": {"duration": "1s"}}, {"name": "sleep", "params": {"delay": "soon"}}]`,
+			want:   `middlewares[1] "sleep": param "delay": time: invalid duration "soon"`,
+		},
+		{
+			name:    "unknown names are reported together",
+			config:  `[{"name": "compress"}, {"name": "timeout", "params": {"duration": "soon"}}, {"name": "auth"}]`,
+			want:    "middlewares[0]: unknown middleware \"compress\"\nmiddlewares[2]: unknown middleware \"auth\"",
+			wantErr: ErrUnknownMiddleware,
+		},
+	}
+	registry := NewDefaultMiddlewareRegistry()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := registry.BuildJSON([]byte(`{"middlewares": ` + tt.config + `}`))
+			if err == nil {
+				t.Fatal("Build accepted an invalid config")
+			}
+			if err.Error() != tt.want {
+				t.Errorf("error = %q, want %q", err, tt.want)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v does not wrap %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReloadKeepsOldChainOnError(t *testing.T) {
+	chain, err := NewReloadableChain(NewDefaultMiddlewareRegistry(), []byte(`{"middlewares": [{"name": "final"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = chain.Reload([]byte(`{"middlewares": [{"name": "timeout", "params": {"duraton": "1s"}}, {"name": "final"}]}`))
+	if err == nil || !strings.Contains(err.Error(), `param "duration" is required`) {
+		t.Fatalf("Reload error = %v, want the missing duration", err)
+	}
+	if got := chain.Handle(context.Background(), "GET /"); got != "Request handled by FinalHandler" {
+		t.Fatalf("response after a failed reload = %q", got)
+	}
+}
+
+// TestWatchFileWithoutErrorHandler 不传 onError：文件不存在或配置无效时忽略错误继续检查，之后的有效配置照常生效
+func TestWatchFileWithoutErrorHandler(t *testing.T) {
+	chain, err := NewReloadableChain(NewDefaultMiddlewareRegistry(), []byte(`{"middlewares": [{"name": "final"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "chain.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		chain.WatchFile(ctx, path, time.Millisecond, nil)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// 每次写入都把修改时间往后推，不依赖文件系统的时间精度
+	modTime := time.Now()
+	write := func(config string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		modTime = modTime.Add(time.Hour)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	write(`{"middlewares": [{"name": "nope"}]}`)
+	time.Sleep(10 * time.Millisecond)
+	write(`{"middlewares": [{"name": "middleware1"}]}`)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for chain.Handle(context.Background(), "GET /") != "Request handled by Middleware1" {
+		if time.Now().After(deadline) {
+			t.Fatal("valid config was not loaded after the errors")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
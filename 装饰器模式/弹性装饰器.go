@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// 弹性装饰器
+// 与 BorderDecorator/ScrollDecorator 包装 Component 的方式相同，这里的装饰器包装的是“调用类”组件：
+// 每个装饰器都嵌入 CallDecorator，持有被包装的 Caller，并在调用前后加上重试、熔断、超时、隔离或缓存等功能。
+// 装饰器之间可以任意叠加，例如 Retry(CircuitBreaker(Timeout(service)))。
+
+// Caller 是调用类组件，例如一次 RPC 或一次数据库查询
+type Caller[Req, Resp any] interface {
+	Call(ctx context.Context, req Req) (Resp, error)
+}
+
+// CallerFunc 让普通函数也能作为 Caller
+type CallerFunc[Req, Resp any] func(ctx context.Context, req Req) (Resp, error)
+
+func (f CallerFunc[Req, Resp]) Call(ctx context.Context, req Req) (Resp, error) {
+	return f(ctx, req)
+}
+
+// CallDecorator 是调用类装饰器的基类，默认直接调用被包装的组件
+type CallDecorator[Req, Resp any] struct {
+	component Caller[Req, Resp]
+}
+
+func (d *CallDecorator[Req, Resp]) Call(ctx context.Context, req Req) (Resp, error) {
+	if d.component != nil {
+		return d.component.Call(ctx, req)
+	}
+	var zero Resp
+	return zero, errors.New("no component to call")
+}
+
+// RetryDecorator 在调用失败时按指数退避重试，退避时间带随机抖动，避免大量调用方同时重试
+type RetryDecorator[Req, Resp any] struct {
+	CallDecorator[Req, Resp]
+	MaxAttempts int           // 最多调用次数，包括第一次；小于 1 时按 1 处理
+	BaseDelay   time.Duration // 第一次重试前的最大等待时间
+	MaxDelay    time.Duration // 单次等待时间上限
+	Retryable   func(error) bool
+	Clock       Clock
+	Rand        func() float64 // 返回 [0,1) 的随机数，测试时可以固定
+}
+
+func NewRetryDecorator[Req, Resp any](component Caller[Req, Resp], maxAttempts int, baseDelay, maxDelay time.Duration) *RetryDecorator[Req, Resp] {
+	return &RetryDecorator[Req, Resp]{
+		CallDecorator: CallDecorator[Req, Resp]{component: component},
+		MaxAttempts:   maxAttempts,
+		BaseDelay:     baseDelay,
+		MaxDelay:      maxDelay,
+		Clock:         realClock{},
+		Rand:          rand.Float64,
+	}
+}
+
+// backoff 计算第 attempt 次重试前的等待时间（full jitter）
+func (r *RetryDecorator[Req, Resp]) backoff(attempt int) time.Duration {
+	d := r.MaxDelay
+	if attempt < 32 {
+		d = r.BaseDelay << attempt
+	}
+	if d > r.MaxDelay || d <= 0 {
+		d = r.MaxDelay
+	}
+	return time.Duration(r.Rand() * float64(d))
+}
+
+func (r *RetryDecorator[Req, Resp]) Call(ctx context.Context, req Req) (Resp, error) {
+	var resp Resp
+	var err error
+	for attempt := 0; attempt < max(r.MaxAttempts, 1); attempt++ {
+		if attempt > 0 {
+			select {
+			case <-r.Clock.After(r.backoff(attempt - 1)):
+			case <-ctx.Done():
+				return resp, errors.Join(err, ctx.Err())
+			}
+		}
+		resp, err = r.CallDecorator.Call(ctx, req)
+		if err == nil || (r.Retryable != nil && !r.Retryable(err)) {
+			return resp, err
+		}
+	}
+	return resp, err
+}
+
+// ErrCircuitOpen 表示熔断器处于打开状态，调用被直接拒绝
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState 是熔断器的状态
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // 正常调用
+	CircuitOpen                         // 拒绝调用，等待冷却
+	CircuitHalfOpen                     // 冷却结束，放行少量探测调用
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreakerDecorator 在连续失败达到阈值后打开熔断，冷却时间过后进入半开状态，
+// 半开状态下只放行 HalfOpenProbes 个探测调用，全部成功则关闭熔断，任何一次失败则重新打开
+type CircuitBreakerDecorator[Req, Resp any] struct {
+	CallDecorator[Req, Resp]
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	HalfOpenProbes   int
+	Clock            Clock
+
+	mu        sync.Mutex
+	state     CircuitState
+	failures  int
+	openedAt  time.Time
+	inFlight  int // 半开状态下正在进行的探测调用
+	successes int // 半开状态下成功的探测调用
+}
+
+func NewCircuitBreakerDecorator[Req, Resp any](component Caller[Req, Resp], failureThreshold int, openTimeout time.Duration) *CircuitBreakerDecorator[Req, Resp] {
+	return &CircuitBreakerDecorator[Req, Resp]{
+		CallDecorator:    CallDecorator[Req, Resp]{component: component},
+		FailureThreshold: failureThreshold,
+		OpenTimeout:      openTimeout,
+		HalfOpenProbes:   1,
+		Clock:            realClock{},
+	}
+}
+
+// State 返回当前状态，打开状态冷却结束后返回半开
+func (c *CircuitBreakerDecorator[Req, Resp]) State() CircuitState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshLocked()
+	return c.state
+}
+
+func (c *CircuitBreakerDecorator[Req, Resp]) refreshLocked() {
+	if c.state == CircuitOpen && !c.Clock.Now().Before(c.openedAt.Add(c.OpenTimeout)) {
+		c.state = CircuitHalfOpen
+		c.inFlight = 0
+		c.successes = 0
+	}
+}
+
+func (c *CircuitBreakerDecorator[Req, Resp]) tripLocked() {
+	c.state = CircuitOpen
+	c.openedAt = c.Clock.Now()
+	c.failures = 0
+}
+
+func (c *CircuitBreakerDecorator[Req, Resp]) Call(ctx context.Context, req Req) (Resp, error) {
+	c.mu.Lock()
+	c.refreshLocked()
+	switch c.state {
+	case CircuitOpen:
+		c.mu.Unlock()
+		var zero Resp
+		return zero, ErrCircuitOpen
+	case CircuitHalfOpen:
+		if c.inFlight+c.successes >= c.HalfOpenProbes {
+			c.mu.Unlock()
+			var zero Resp
+			return zero, ErrCircuitOpen
+		}
+		c.inFlight++
+	}
+	probing := c.state == CircuitHalfOpen
+	c.mu.Unlock()
+
+	resp, err := c.CallDecorator.Call(ctx, req)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if probing {
+		c.inFlight--
+		if err != nil {
+			c.tripLocked()
+			return resp, err
+		}
+		c.successes++
+		if c.successes >= c.HalfOpenProbes {
+			c.state = CircuitClosed
+			c.failures = 0
+		}
+		return resp, nil
+	}
+	if err != nil {
+		c.failures++
+		if c.state == CircuitClosed && c.failures >= c.FailureThreshold {
+			c.tripLocked()
+		}
+		return resp, err
+	}
+	c.failures = 0
+	return resp, nil
+}
+
+// ErrCallTimeout 表示调用超过了 TimeoutDecorator 设置的时间
+var ErrCallTimeout = errors.New("call timed out")
+
+// TimeoutDecorator 限制单次调用的时间，超时后取消下游的 ctx 并立即返回
+type TimeoutDecorator[Req, Resp any] struct {
+	CallDecorator[Req, Resp]
+	Timeout time.Duration
+	Clock   Clock
+}
+
+func NewTimeoutDecorator[Req, Resp any](component Caller[Req, Resp], timeout time.Duration) *TimeoutDecorator[Req, Resp] {
+	return &TimeoutDecorator[Req, Resp]{
+		CallDecorator: CallDecorator[Req, Resp]{component: component},
+		Timeout:       timeout,
+		Clock:         realClock{},
+	}
+}
+
+func (t *TimeoutDecorator[Req, Resp]) Call(ctx context.Context, req Req) (Resp, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		resp Resp
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := t.CallDecorator.Call(ctx, req)
+		done <- result{resp, err}
+	}()
+
+	var zero Resp
+	select {
+	case r := <-done:
+		return r.resp, r.err
+	case <-t.Clock.After(t.Timeout):
+		return zero, ErrCallTimeout
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// ErrBulkheadFull 表示并发调用数已满，且在等待时间内没有空出位置
+var ErrBulkheadFull = errors.New("bulkhead is full")
+
+// BulkheadDecorator 限制同时进行的调用数，避免一个慢依赖耗尽全部资源
+// 位置已满时最多等待 MaxWait，MaxWait 为 0 时立即拒绝
+type BulkheadDecorator[Req, Resp any] struct {
+	CallDecorator[Req, Resp]
+	MaxWait time.Duration
+	Clock   Clock
+	slots   chan struct{}
+}
+
+func NewBulkheadDecorator[Req, Resp any](component Caller[Req, Resp], maxConcurrent int, maxWait time.Duration) *BulkheadDecorator[Req, Resp] {
+	return &BulkheadDecorator[Req, Resp]{
+		CallDecorator: CallDecorator[Req, Resp]{component: component},
+		MaxWait:       maxWait,
+		Clock:         realClock{},
+		slots:         make(chan struct{}, maxConcurrent),
+	}
+}
+
+func (b *BulkheadDecorator[Req, Resp]) acquire(ctx context.Context) error {
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if b.MaxWait <= 0 {
+		return ErrBulkheadFull
+	}
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	case <-b.Clock.After(b.MaxWait):
+		return ErrBulkheadFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *BulkheadDecorator[Req, Resp]) Call(ctx context.Context, req Req) (Resp, error) {
+	if err := b.acquire(ctx); err != nil {
+		var zero Resp
+		return zero, err
+	}
+	defer func() { <-b.slots }()
+	return b.CallDecorator.Call(ctx, req)
+}
+
+// InFlight 返回正在进行的调用数
+func (b *BulkheadDecorator[Req, Resp]) InFlight() int {
+	return len(b.slots)
+}
+
+// ErrCallPanicked 是被包装的组件 panic 时，等待同一个请求结果的其他调用收到的错误
+var ErrCallPanicked = errors.New("cached call panicked")
+
+// CacheDecorator 按请求缓存成功的结果，TTL 过期后重新调用，失败的结果不缓存
+// 同一个请求并发未命中时只有一个调用真正发出，其余调用等待它的结果；
+// 发出调用的一方因为自己的 ctx 结束而失败时，等待者不会收到它的 ctx 错误，而是重新发起调用
+type CacheDecorator[Req comparable, Resp any] struct {
+	CallDecorator[Req, Resp]
+	TTL   time.Duration
+	Clock Clock
+
+	mu        sync.Mutex
+	entries   map[Req]cacheEntry[Resp]
+	pending   map[Req]*pendingCall[Resp]
+	nextSweep time.Time
+}
+
+type cacheEntry[Resp any] struct {
+	resp      Resp
+	expiresAt time.Time
+}
+
+type pendingCall[Resp any] struct {
+	done      chan struct{}
+	resp      Resp
+	err       error
+	cancelled bool // 调用因为发起方的 ctx 结束而失败
+}
+
+func NewCacheDecorator[Req comparable, Resp any](component Caller[Req, Resp], ttl time.Duration) *CacheDecorator[Req, Resp] {
+	return &CacheDecorator[Req, Resp]{
+		CallDecorator: CallDecorator[Req, Resp]{component: component},
+		TTL:           ttl,
+		Clock:         realClock{},
+		entries:       map[Req]cacheEntry[Resp]{},
+		pending:       map[Req]*pendingCall[Resp]{},
+	}
+}
+
+func (c *CacheDecorator[Req, Resp]) Call(ctx context.Context, req Req) (Resp, error) {
+	for {
+		c.mu.Lock()
+		if e, ok := c.entries[req]; ok {
+			if c.Clock.Now().Before(e.expiresAt) {
+				c.mu.Unlock()
+				return e.resp, nil
+			}
+			delete(c.entries, req)
+		}
+		p, ok := c.pending[req]
+		if !ok {
+			break
+		}
+		c.mu.Unlock()
+		select {
+		case <-p.done:
+			if p.cancelled && ctx.Err() == nil {
+				continue
+			}
+			return p.resp, p.err
+		case <-ctx.Done():
+			var zero Resp
+			return zero, ctx.Err()
+		}
+	}
+	p := &pendingCall[Resp]{done: make(chan struct{}), err: ErrCallPanicked}
+	c.pending[req] = p
+	c.mu.Unlock()
+
+	// 组件 panic 时也要唤醒等待者，并让之后的调用可以重新发起
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, req)
+		if p.err == nil {
+			now := c.Clock.Now()
+			c.entries[req] = cacheEntry[Resp]{resp: p.resp, expiresAt: now.Add(c.TTL)}
+			c.sweepLocked(now)
+		}
+		c.mu.Unlock()
+		close(p.done)
+	}()
+	p.resp, p.err = c.CallDecorator.Call(ctx, req)
+	p.cancelled = p.err != nil && ctx.Err() != nil
+	return p.resp, p.err
+}
+
+// sweepLocked 每隔一个 TTL 清理一次过期的结果，避免从不再访问的请求一直占用内存
+func (c *CacheDecorator[Req, Resp]) sweepLocked(now time.Time) {
+	if now.Before(c.nextSweep) {
+		return
+	}
+	for req, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, req)
+		}
+	}
+	c.nextSweep = now.Add(c.TTL)
+}
+
+// Len 返回缓存的结果数量，可能包括还没有被清理的过期结果
+func (c *CacheDecorator[Req, Resp]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Invalidate 删除某个请求的缓存
+func (c *CacheDecorator[Req, Resp]) Invalidate(req Req) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, req)
+}
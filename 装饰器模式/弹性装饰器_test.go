@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+// waitUntil 等待另一个 goroutine 中的被测代码到达某个状态
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type callResult struct {
+	resp string
+	err  error
+}
+
+// callAsync 在新的 goroutine 中调用，返回接收结果的通道
+func callAsync(ctx context.Context, c Caller[string, string], req string) <-chan callResult {
+	ch := make(chan callResult, 1)
+	go func() {
+		resp, err := c.Call(ctx, req)
+		ch <- callResult{resp, err}
+	}()
+	return ch
+}
+
+func TestRetryBackoff(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var calls atomic.Int32
+	component := CallerFunc[string, string](func(ctx context.Context, req string) (string, error) {
+		if calls.Add(1) < 3 {
+			return "", errUnavailable
+		}
+		return "ok:" + req, nil
+	})
+	retry := NewRetryDecorator[string, string](component, 3, 100*time.Millisecond, 150*time.Millisecond)
+	retry.Clock = clock
+	retry.Rand = func() float64 { return 0.5 }
+
+	result := callAsync(context.Background(), retry, "a")
+
+	// 第一次重试前等待 0.5*100ms，第二次等待 0.5*min(200ms, 150ms)
+	for i, delay := range []time.Duration{50 * time.Millisecond, 75 * time.Millisecond} {
+		waitUntil(t, "retry to sleep", func() bool { return clock.Waiters() == 1 })
+		if got := calls.Load(); got != int32(i+1) {
+			t.Fatalf("calls before retry %d = %d, want %d", i+1, got, i+1)
+		}
+		clock.Advance(delay - time.Millisecond)
+		if clock.Waiters() != 1 {
+			t.Fatalf("retry %d woke up before %v", i+1, delay)
+		}
+		clock.Advance(time.Millisecond)
+	}
+
+	r := <-result
+	if r.err != nil || r.resp != "ok:a" {
+		t.Fatalf("Call = %q, %v; want ok:a, nil", r.resp, r.err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("calls = %d, want 3", got)
+	}
+}
+
+func TestRetryStopsOnNonRetryableAndCancel(t *testing.T) {
+	errBadRequest := errors.New("bad request")
+	var calls atomic.Int32
+	component := CallerFunc[string, string](func(ctx context.Context, req string) (string, error) {
+		calls.Add(1)
+		if req == "bad" {
+			return "", errBadRequest
+		}
+		return "", errUnavailable
+	})
+	clock := NewFakeClock(time.Unix(0, 0))
+	retry := NewRetryDecorator[string, string](component, 5, time.Second, time.Second)
+	retry.Clock = clock
+	retry.Retryable = func(err error) bool { return !errors.Is(err, errBadRequest) }
+
+	if _, err := retry.Call(context.Background(), "bad"); !errors.Is(err, errBadRequest) || calls.Load() != 1 {
+		t.Fatalf("non-retryable: err = %v, calls = %d; want bad request after 1 call", err, calls.Load())
+	}
+
+	calls.Store(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	result := callAsync(ctx, retry, "a")
+	waitUntil(t, "retry to sleep", func() bool { return clock.Waiters() == 1 })
+	cancel()
+	r := <-result
+	if !errors.Is(r.err, context.Canceled) || !errors.Is(r.err, errUnavailable) {
+		t.Fatalf("cancelled: err = %v, want both the last error and context.Canceled", r.err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("cancelled: calls = %d, want 1", calls.Load())
+	}
+}
+
+func TestRetryCallsAtLeastOnce(t *testing.T) {
+	for _, attempts := range []int{0, -1} {
+		var calls int
+		component := CallerFunc[string, string](func(ctx context.Context, req string) (string, error) {
+			calls++
+			return "", errUnavailable
+		})
+		retry := NewRetryDecorator[string, string](component, attempts, time.Second, time.Second)
+		if _, err := retry.Call(context.Background(), "a"); !errors.Is(err, errUnavailable) || calls != 1 {
+			t.Errorf("MaxAttempts=%d: err = %v, calls = %d; want the component error after 1 call", attempts, err, calls)
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var failing atomic.Bool
+	failing.Store(true)
+	release := make(chan struct{})
+	var calls atomic.Int32
+	component := CallerFunc[string, string](func(ctx context.Context, req string) (string, error) {
+		calls.Add(1)
+		if req == "slow" {
+			<-release
+		}
+		if failing.Load() {
+			return "", errUnavailable
+		}
+		return "ok", nil
+	})
+	breaker := NewCircuitBreakerDecorator[string, string](component, 2, time.Second)
+	breaker.Clock = clock
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		breaker.Call(ctx, "a")
+	}
+	if s := breaker.State(); s != CircuitOpen {
+		t.Fatalf("state after 2 failures = %v, want open", s)
+	}
+	if _, err := breaker.Call(ctx, "a"); !errors.Is(err, ErrCircuitOpen) || calls.Load() != 2 {
+		t.Fatalf("open: err = %v, calls = %d; want ErrCircuitOpen without calling", err, calls.Load())
+	}
+
+	// 冷却结束后进入半开，探测失败重新打开并重新计时
+	clock.Advance(time.Second)
+	if s := breaker.State(); s != CircuitHalfOpen {
+		t.Fatalf("state after open timeout = %v, want half-open", s)
+	}
+	if _, err := breaker.Call(ctx, "a"); !errors.Is(err, errUnavailable) {
+		t.Fatalf("failed probe: err = %v, want the component error", err)
+	}
+	clock.Advance(time.Second - time.Millisecond)
+	if s := breaker.State(); s != CircuitOpen {
+		t.Fatalf("state after failed probe = %v, want open", s)
+	}
+
+	// 半开状态下只放行一个探测调用，探测成功后关闭
+	clock.Advance(time.Millisecond)
+	failing.Store(false)
+	probe := callAsync(ctx, breaker, "slow")
+	waitUntil(t, "probe to start", func() bool { return calls.Load() == 4 })
+	if _, err := breaker.Call(ctx, "a"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second call while probing: err = %v, want ErrCircuitOpen", err)
+	}
+	close(release)
+	if r := <-probe; r.err != nil {
+		t.Fatalf("probe: err = %v", r.err)
+	}
+	if s := breaker.State(); s != CircuitClosed {
+		t.Fatalf("state after successful probe = %v, want closed", s)
+	}
+	if _, err := breaker.Call(ctx, "a"); err != nil {
+		t.Fatalf("closed: err = %v", err)
+	}
+}
+
+func TestTimeoutCancelsComponent(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	cancelled := make(chan error, 1)
+	component := CallerFunc[string, string](func(ctx context.Context, req string) (string, error) {
+		if req == "fast" {
+			return "ok", nil
+		}
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return "", ctx.Err()
+	})
+	timeout := NewTimeoutDecorator[string, string](component, time.Second)
+	timeout.Clock = clock
+
+	if resp, err := timeout.Call(context.Background(), "fast"); err != nil || resp != "ok" {
+		t.Fatalf("fast call = %q, %v", resp, err)
+	}
+
+	result := callAsync(context.Background(), timeout, "slow")
+	waitUntil(t, "timeout to start", func() bool { return clock.Waiters() == 2 })
+	clock.Advance(time.Second - time.Millisecond)
+	select {
+	case r := <-result:
+		t.Fatalf("call returned before the timeout: %v", r.err)
+	default:
+	}
+	clock.Advance(time.Millisecond)
+	if r := <-result; !errors.Is(r.err, ErrCallTimeout) {
+		t.Fatalf("slow call: err = %v, want ErrCallTimeout", r.err)
+	}
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("component ctx err = %v, want context.Canceled", err)
+	}
+}
+
+func TestBulkheadLimitsConcurrency(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	release := make(chan struct{})
+	component := CallerFunc[string, string](func(ctx context.Context, req string) (string, error) {
+		if req == "slow" {
+			<-release
+		}
+		return "ok", nil
+	})
+	bulkhead := NewBulkheadDecorator[string, string](component, 1, 100*time.Millisecond)
+	bulkhead.Clock = clock
+	ctx := context.Background()
+
+	first := callAsync(ctx, bulkhead, "slow")
+	waitUntil(t, "first call to start", func() bool { return bulkhead.InFlight() == 1 })
+
+	// 等待 MaxWait 之后仍然没有位置
+	second := callAsync(ctx, bulkhead, "a")
+	waitUntil(t, "second call to wait", func() bool { return clock.Waiters() == 1 })
+	clock.Advance(100 * time.Millisecond)
+	if r := <-second; !errors.Is(r.err, ErrBulkheadFull) {
+		t.Fatalf("second call: err = %v, want ErrBulkheadFull", r.err)
+	}
+
+	// 等待期间位置空出来
+	third := callAsync(ctx, bulkhead, "a")
+	waitUntil(t, "third call to wait", func() bool { return clock.Waiters() == 1 })
+	close(release)
+	if r := <-first; r.err != nil {
+		t.Fatalf("first call: err = %v", r.err)
+	}
+	if r := <-third; r.err != nil {
+		t.Fatalf("third call: err = %v", r.err)
+	}
+	if n := bulkhead.InFlight(); n != 0 {
+		t.Fatalf("InFlight = %d after all calls returned", n)
+	}
+
+	// MaxWait 为 0 时立即拒绝
+	release = make(chan struct{})
+	bulkhead.MaxWait = 0
+	slow := callAsync(ctx, bulkhead, "slow")
+	waitUntil(t, "slow call to start", func() bool { return bulkhead.InFlight() == 1 })
+	if _, err := bulkhead.Call(ctx, "a"); !errors.Is(err, ErrBulkheadFull) {
+		t.Fatalf("MaxWait=0: err = %v, want ErrBulkheadFull", err)
+	}
+	close(release)
+	<-slow
+}
+
+func TestCacheSharesOneCall(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	release := make(chan struct{})
+	var calls atomic.Int32
+	component := CallerFunc[string, string](func(ctx context.Context, req string) (string, error) {
+		calls.Add(1)
+		<-release
+		return "v:" + req, nil
+	})
+	cache := NewCacheDecorator[string, string](component, time.Minute)
+	cache.Clock = clock
+
+	var wg sync.WaitGroup
+	results := make([]callResult, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := cache.Call(context.Background(), "a")
+			results[i] = callResult{resp, err}
+		}()
+	}
+	waitUntil(t, "leader to call", func() bool { return calls.Load() == 1 })
+	close(release)
+	wg.Wait()
+	for i, r := range results {
+		if r.err != nil || r.resp != "v:a" {
+			t.Errorf("call %d = %q, %v", i, r.resp, r.err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("component called %d times, want 1", n)
+	}
+
+	clock.Advance(time.Minute)
+	cache.Call(context.Background(), "a")
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("component called %d times after expiry, want 2", n)
+	}
+}
+
+func TestCachePanicReleasesWaiters(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	release := make(chan struct{})
+	var calls atomic.Int32
+	component := CallerFunc[string, string](func(ctx context.Context, req string) (string, error) {
+		if calls.Add(1) == 1 {
+			<-release
+			panic("boom")
+		}
+		return "ok", nil
+	})
+	cache := NewCacheDecorator[string, string](component, time.Minute)
+	cache.Clock = clock
+
+	leader := make(chan any, 1)
+	go func() {
+		defer func() { leader <- recover() }()
+		cache.Call(context.Background(), "a")
+	}()
+	waitUntil(t, "leader to call", func() bool { return calls.Load() == 1 })
+	waiter := callAsync(context.Background(), cache, "a")
+	time.Sleep(10 * time.Millisecond) // 让等待者进入等待
+	close(release)
+
+	if p := <-leader; p != "boom" {
+		t.Fatalf("leader recovered %v, want the component panic", p)
+	}
+	if r := <-waiter; !errors.Is(r.err, ErrCallPanicked) {
+		t.Fatalf("waiter: err = %v, want ErrCallPanicked", r.err)
+	}
+	if resp, err := cache.Call(context.Background(), "a"); err != nil || resp != "ok" {
+		t.Fatalf("call after panic = %q, %v; want a new call", resp, err)
+	}
+}
+
+func TestCacheLeaderCancelDoesNotFailWaiters(t *testing.T) {
+	var calls atomic.Int32
+	component := CallerFunc[string, string](func(ctx context.Context, req string) (string, error) {
+		if calls.Add(1) == 1 {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}
+		return "ok", nil
+	})
+	cache := NewCacheDecorator[string, string](component, time.Minute)
+	cache.Clock = NewFakeClock(time.Unix(0, 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := callAsync(ctx, cache, "a")
+	waitUntil(t, "leader to call", func() bool { return calls.Load() == 1 })
+	var waiters []<-chan callResult
+	for i := 0; i < 3; i++ {
+		waiters = append(waiters, callAsync(context.Background(), cache, "a"))
+	}
+	// 让等待者进入等待；没来得及进入的会在取消后直接成为新的调用方，结果相同
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	if r := <-leader; !errors.Is(r.err, context.Canceled) {
+		t.Fatalf("leader: err = %v, want context.Canceled", r.err)
+	}
+	for i, w := range waiters {
+		if r := <-w; r.err != nil || r.resp != "ok" {
+			t.Errorf("waiter %d = %q, %v; want ok", i, r.resp, r.err)
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("component called %d times, want 2", n)
+	}
+}
+
+func TestCacheSweepsExpiredEntries(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	component := CallerFunc[int, int](func(ctx context.Context, req int) (int, error) {
+		return req * 2, nil
+	})
+	cache := NewCacheDecorator[int, int](component, time.Minute)
+	cache.Clock = clock
+
+	for i := 0; i < 300; i++ {
+		cache.Call(context.Background(), i)
+		clock.Advance(time.Second)
+	}
+	// 每个 TTL 清理一次，留下的结果不会超过两个 TTL 内写入的数量
+	if n := cache.Len(); n > 120 {
+		t.Fatalf("Len = %d, want expired entries swept", n)
+	}
+	clock.Advance(2 * time.Minute)
+	cache.Call(context.Background(), -1)
+	if n := cache.Len(); n != 1 {
+		t.Fatalf("Len after all expired = %d, want 1", n)
+	}
+}
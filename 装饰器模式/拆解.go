@@ -0,0 +1,134 @@
+package main
+
+import "fmt"
+
+// 装饰器的运行时拆解
+// 装饰器层层包装之后，外部只能看到最外层。这里约定每个装饰器实现 Wrapper：
+// Unwrap 返回被包装的组件，Wrap 返回一个包装新组件的同类装饰器（不修改自身），
+// 在此基础上就可以列出装饰器栈、按类型查找某一层，以及插入或移除某一层后重建整个栈。
+// 基类 Decorator 只提供 Unwrap，Wrap 必须由每个具体装饰器自己实现，否则它复制不出自己的配置。
+
+// Wrapper 是装饰器需要满足的接口
+type Wrapper interface {
+	Component
+	// Unwrap 返回被包装的组件
+	Unwrap() Component
+	// Wrap 返回一个与自身配置相同、但包装 inner 的新装饰器
+	Wrap(inner Component) Component
+}
+
+// 新增的界面装饰器要加到这里，漏写 Wrap 时编译失败
+var (
+	_ Wrapper = (*BorderDecorator)(nil)
+	_ Wrapper = (*ScrollDecorator)(nil)
+	_ Wrapper = (*PaddingDecorator)(nil)
+	_ Wrapper = (*TitleDecorator)(nil)
+	_ Wrapper = (*ShadowDecorator)(nil)
+)
+
+func (d *Decorator) Unwrap() Component {
+	return d.component
+}
+
+func (b *BorderDecorator) Wrap(inner Component) Component {
+	c := *b
+	c.component = inner
+	return &c
+}
+
+func (s *ScrollDecorator) Wrap(inner Component) Component {
+	c := *s
+	c.component = inner
+	return &c
+}
+
+// Layers 返回从最外层到最内层的所有组件，最后一个是被装饰的基础组件
+func Layers(c Component) []Component {
+	var layers []Component
+	for c != nil {
+		layers = append(layers, c)
+		w, ok := c.(Wrapper)
+		if !ok {
+			break
+		}
+		c = w.Unwrap()
+	}
+	return layers
+}
+
+// Split 把组件拆成装饰器栈（从外到内）和基础组件
+func Split(c Component) ([]Wrapper, Component) {
+	var wrappers []Wrapper
+	for {
+		w, ok := c.(Wrapper)
+		if !ok {
+			return wrappers, c
+		}
+		wrappers = append(wrappers, w)
+		c = w.Unwrap()
+	}
+}
+
+// Rebuild 用装饰器栈（从外到内）重新包装基础组件，返回新的最外层
+// 原有的装饰器不会被修改
+func Rebuild(wrappers []Wrapper, base Component) Component {
+	c := base
+	for i := len(wrappers) - 1; i >= 0; i-- {
+		c = wrappers[i].Wrap(c)
+	}
+	return c
+}
+
+// FindLayer 从外到内查找第一个类型为 T 的层
+func FindLayer[T Component](c Component) (T, bool) {
+	for _, layer := range Layers(c) {
+		if t, ok := layer.(T); ok {
+			return t, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// RemoveLayers 移除所有满足 match 的装饰器，返回重建后的组件
+func RemoveLayers(c Component, match func(Wrapper) bool) Component {
+	wrappers, base := Split(c)
+	kept := wrappers[:0:0]
+	for _, w := range wrappers {
+		if !match(w) {
+			kept = append(kept, w)
+		}
+	}
+	return Rebuild(kept, base)
+}
+
+// RemoveLayer 移除所有类型为 T 的装饰器
+func RemoveLayer[T Wrapper](c Component) Component {
+	return RemoveLayers(c, func(w Wrapper) bool {
+		_, ok := w.(T)
+		return ok
+	})
+}
+
+// InsertLayer 在装饰器栈的 index 位置（0 为最外层）插入一个装饰器，返回重建后的组件
+// layer 只作为模板使用，实际插入的是 layer.Wrap 得到的新装饰器
+func InsertLayer(c Component, index int, layer Wrapper) (Component, error) {
+	wrappers, base := Split(c)
+	if index < 0 || index > len(wrappers) {
+		return nil, fmt.Errorf("insert layer: index %d out of range [0, %d]", index, len(wrappers))
+	}
+	result := make([]Wrapper, 0, len(wrappers)+1)
+	result = append(result, wrappers[:index]...)
+	result = append(result, layer)
+	result = append(result, wrappers[index:]...)
+	return Rebuild(result, base), nil
+}
+
+// DescribeLayers 返回装饰器栈中每一层的类型名，便于打印和排查
+func DescribeLayers(c Component) []string {
+	var names []string
+	for _, layer := range Layers(c) {
+		names = append(names, fmt.Sprintf("%T", layer))
+	}
+	return names
+}
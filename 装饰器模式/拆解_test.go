@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newScrollBorderText 手工构造 Scroll(Border(Text))
+func newScrollBorderText() (*ScrollDecorator, *BorderDecorator, *TextComponent) {
+	text := &TextComponent{Lines: []string{"one", "two", "three", "four"}}
+	border := &BorderDecorator{Decorator{component: text}}
+	scroll := &ScrollDecorator{Height: 4, Offset: 1, Decorator: Decorator{component: border}}
+	return scroll, border, text
+}
+
+func sameDrawing(t *testing.T, got, want Component) {
+	t.Helper()
+	if g, w := got.Draw().String(), want.Draw().String(); g != w {
+		t.Fatalf("rebuilt stack draws\n%s\nwant\n%s", g, w)
+	}
+}
+
+func TestLayersAndSplit(t *testing.T) {
+	scroll, border, text := newScrollBorderText()
+	if got := Layers(scroll); !reflect.DeepEqual(got, []Component{scroll, border, text}) {
+		t.Fatalf("Layers = %v", got)
+	}
+	want := []string{"*main.ScrollDecorator", "*main.BorderDecorator", "*main.TextComponent"}
+	if got := DescribeLayers(scroll); !reflect.DeepEqual(got, want) {
+		t.Fatalf("DescribeLayers = %v, want %v", got, want)
+	}
+
+	wrappers, base := Split(scroll)
+	if len(wrappers) != 2 || wrappers[0] != scroll || wrappers[1] != border || base != text {
+		t.Fatalf("Split = %v, %v", wrappers, base)
+	}
+	rebuilt := Rebuild(wrappers, base)
+	sameDrawing(t, rebuilt, scroll)
+	// 重建得到新的装饰器，原来的栈不变
+	if rebuilt == Component(scroll) || scroll.component != border {
+		t.Fatal("Rebuild modified or reused the original decorators")
+	}
+}
+
+func TestFindLayer(t *testing.T) {
+	scroll, border, _ := newScrollBorderText()
+	if b, ok := FindLayer[*BorderDecorator](scroll); !ok || b != border {
+		t.Fatalf("FindLayer[*BorderDecorator] = %v, %v", b, ok)
+	}
+	if p, ok := FindLayer[*PaddingDecorator](scroll); ok || p != nil {
+		t.Fatalf("FindLayer[*PaddingDecorator] = %v, %v; want not found", p, ok)
+	}
+}
+
+func TestRemoveLayer(t *testing.T) {
+	scroll, _, text := newScrollBorderText()
+	got := RemoveLayer[*BorderDecorator](scroll)
+	sameDrawing(t, got, &ScrollDecorator{Height: 4, Offset: 1, Decorator: Decorator{component: text}})
+	if strings.Contains(got.Draw().String(), "─") {
+		t.Fatal("border still drawn after RemoveLayer")
+	}
+
+	// 没有这一层时原样重建
+	sameDrawing(t, RemoveLayer[*ShadowDecorator](scroll), scroll)
+	// 移除所有层只剩基础组件
+	if got := RemoveLayers(scroll, func(Wrapper) bool { return true }); got != Component(text) {
+		t.Fatalf("removing every layer = %v, want the base component", got)
+	}
+}
+
+func TestInsertLayer(t *testing.T) {
+	scroll, _, text := newScrollBorderText()
+	tests := []struct {
+		index int
+		want  Component
+	}{
+		{0, &PaddingDecorator{Left: 1, Decorator: Decorator{component: scroll}}},
+		{1, &ScrollDecorator{Height: 4, Offset: 1, Decorator: Decorator{component: &PaddingDecorator{Left: 1, Decorator: Decorator{
+			component: &BorderDecorator{Decorator{component: text}}}}}}},
+		{2, &ScrollDecorator{Height: 4, Offset: 1, Decorator: Decorator{component: &BorderDecorator{Decorator{
+			component: &PaddingDecorator{Left: 1, Decorator: Decorator{component: text}}}}}}},
+	}
+	for _, tt := range tests {
+		template := &PaddingDecorator{Left: 1}
+		got, err := InsertLayer(scroll, tt.index, template)
+		if err != nil {
+			t.Fatalf("index %d: %v", tt.index, err)
+		}
+		sameDrawing(t, got, tt.want)
+		if template.component != nil {
+			t.Fatal("InsertLayer modified the template")
+		}
+	}
+
+	for _, index := range []int{-1, 3} {
+		if _, err := InsertLayer(scroll, index, &PaddingDecorator{}); err == nil || !strings.Contains(err.Error(), "out of range [0, 2]") {
+			t.Errorf("index %d: err = %v, want out of range", index, err)
+		}
+	}
+}
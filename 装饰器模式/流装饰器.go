@@ -0,0 +1,546 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+// 流装饰器
+// 把装饰器的思路用在 io.Reader/io.Writer 上：WriterDecorator、ReaderDecorator 与 Decorator 一样只持有被包装的流，
+// 具体的装饰器嵌入它们，在读写前后加上压缩、加密、校验、限速、进度和旁路日志等功能。
+// 编码方向使用写装饰器，解码方向使用读装饰器，StreamCodec 把一对编码/解码装饰器绑定在一起，
+// NewEncodeStack/NewDecodeStack 保证解码栈与编码栈的顺序正好相反。
+
+// WriterDecorator 是写装饰器的基类，默认把数据原样写给被包装的 Writer
+type WriterDecorator struct {
+	writer io.Writer
+}
+
+func (d *WriterDecorator) Write(p []byte) (int, error) {
+	return d.writer.Write(p)
+}
+
+// Close 关闭被包装的 Writer（如果它可以关闭）
+func (d *WriterDecorator) Close() error {
+	if c, ok := d.writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (d *WriterDecorator) Unwrap() io.Writer {
+	return d.writer
+}
+
+// ReaderDecorator 是读装饰器的基类，默认从被包装的 Reader 原样读取
+type ReaderDecorator struct {
+	reader io.Reader
+}
+
+func (d *ReaderDecorator) Read(p []byte) (int, error) {
+	return d.reader.Read(p)
+}
+
+func (d *ReaderDecorator) Unwrap() io.Reader {
+	return d.reader
+}
+
+// GzipWriter 压缩写入的数据，Close 时写出 gzip 尾部并关闭下层
+type GzipWriter struct {
+	WriterDecorator
+	gz *gzip.Writer
+}
+
+func NewGzipWriter(w io.Writer) *GzipWriter {
+	return &GzipWriter{WriterDecorator: WriterDecorator{writer: w}, gz: gzip.NewWriter(w)}
+}
+
+func (g *GzipWriter) Write(p []byte) (int, error) {
+	return g.gz.Write(p)
+}
+
+func (g *GzipWriter) Close() error {
+	return errors.Join(g.gz.Close(), g.WriterDecorator.Close())
+}
+
+// GzipReader 解压读取的数据
+type GzipReader struct {
+	ReaderDecorator
+	gz *gzip.Reader
+}
+
+func NewGzipReader(r io.Reader) (*GzipReader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &GzipReader{ReaderDecorator: ReaderDecorator{reader: r}, gz: gz}, nil
+}
+
+func (g *GzipReader) Read(p []byte) (int, error) {
+	return g.gz.Read(p)
+}
+
+// AES-GCM 加密流的格式：
+//
+//	noncePrefix(4) | frame | frame | ...
+//	frame = flag(1) | length(4) | ciphertext(length)
+//
+// 每个 frame 最多包含 gcmChunkSize 字节明文，nonce 由 noncePrefix 和 8 字节递增计数器组成，
+// flag 作为附加数据参与认证，最后一个 frame 的 flag 为 1，读到流尾还没有遇到最后一帧说明流被截断，
+// 最后一帧之后还有数据同样是错误。
+const (
+	gcmChunkSize   = 64 * 1024
+	gcmPrefixSize  = 4
+	gcmFrameHeader = 5
+	gcmFlagFinal   = 1
+)
+
+// ErrStreamTruncated 表示加密流在最后一帧之前就结束了
+var ErrStreamTruncated = errors.New("encrypted stream truncated")
+
+// ErrTrailingData 表示最后一帧之后还有数据，这些数据没有经过认证，不能当作流的一部分
+var ErrTrailingData = errors.New("data after final encrypted frame")
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func gcmNonce(prefix []byte, counter uint64) []byte {
+	nonce := make([]byte, gcmPrefixSize+8)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint64(nonce[gcmPrefixSize:], counter)
+	return nonce
+}
+
+// EncryptWriter 用 AES-GCM 分块加密写入的数据，必须调用 Close 才会写出最后一帧
+type EncryptWriter struct {
+	WriterDecorator
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint64
+	buf     []byte
+	started bool
+	closed  bool
+	err     error // 写出失败后流已经损坏，之后的写入和 Close 都返回这个错误
+}
+
+// NewEncryptWriter 的 key 长度为 16、24 或 32 字节，分别对应 AES-128/192/256
+func NewEncryptWriter(w io.Writer, key []byte) (*EncryptWriter, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, gcmPrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	return &EncryptWriter{WriterDecorator: WriterDecorator{writer: w}, aead: aead, prefix: prefix}, nil
+}
+
+func (e *EncryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed EncryptWriter")
+	}
+	if e.err != nil {
+		return 0, e.err
+	}
+	// pending 是缓存中还没有加密的旧数据，它们加密写出之后才轮到 p
+	pending := len(e.buf)
+	e.buf = append(e.buf, p...)
+	for len(e.buf) > gcmChunkSize {
+		if err := e.seal(e.buf[:gcmChunkSize], false); err != nil {
+			e.err = err
+			e.buf = nil
+			return max(-pending, 0), err
+		}
+		e.buf = e.buf[gcmChunkSize:]
+		pending -= gcmChunkSize
+	}
+	return len(p), nil
+}
+
+func (e *EncryptWriter) seal(plain []byte, final bool) error {
+	if !e.started {
+		if _, err := e.writer.Write(e.prefix); err != nil {
+			return err
+		}
+		e.started = true
+	}
+	header := make([]byte, gcmFrameHeader)
+	if final {
+		header[0] = gcmFlagFinal
+	}
+	sealed := e.aead.Seal(nil, gcmNonce(e.prefix, e.counter), plain, header[:1])
+	e.counter++
+	binary.BigEndian.PutUint32(header[1:], uint32(len(sealed)))
+	if _, err := e.writer.Write(header); err != nil {
+		return err
+	}
+	_, err := e.writer.Write(sealed)
+	return err
+}
+
+func (e *EncryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	err := e.err
+	if err == nil {
+		err = e.seal(e.buf, true)
+	}
+	e.buf = nil
+	return errors.Join(err, e.WriterDecorator.Close())
+}
+
+// DecryptReader 读取 EncryptWriter 写出的流并解密，任何篡改、重排或截断都会返回错误
+type DecryptReader struct {
+	ReaderDecorator
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint64
+	plain   []byte
+	done    bool
+}
+
+func NewDecryptReader(r io.Reader, key []byte) (*DecryptReader, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &DecryptReader{ReaderDecorator: ReaderDecorator{reader: r}, aead: aead}, nil
+}
+
+func (d *DecryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *DecryptReader) readFrame() error {
+	if d.prefix == nil {
+		d.prefix = make([]byte, gcmPrefixSize)
+		if _, err := io.ReadFull(d.reader, d.prefix); err != nil {
+			return truncated(err)
+		}
+	}
+	header := make([]byte, gcmFrameHeader)
+	if _, err := io.ReadFull(d.reader, header); err != nil {
+		return truncated(err)
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > gcmChunkSize+uint32(d.aead.Overhead()) {
+		return fmt.Errorf("encrypted frame too large: %d bytes", size)
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(d.reader, sealed); err != nil {
+		return truncated(err)
+	}
+	plain, err := d.aead.Open(nil, gcmNonce(d.prefix, d.counter), sealed, header[:1])
+	if err != nil {
+		return fmt.Errorf("decrypt frame %d: %w", d.counter, err)
+	}
+	d.counter++
+	d.plain = plain
+	d.done = header[0] == gcmFlagFinal
+	if d.done {
+		// 最后一帧之后必须正好是流尾
+		var extra [1]byte
+		n, err := io.ReadFull(d.reader, extra[:])
+		if n > 0 {
+			d.plain = nil
+			return ErrTrailingData
+		}
+		if err != io.EOF {
+			d.plain = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrStreamTruncated
+	}
+	return err
+}
+
+// ChecksumWriter 在写入的同时计算校验和，hash 可以是 crc32.NewIEEE()、sha256.New() 等
+type ChecksumWriter struct {
+	WriterDecorator
+	hash hash.Hash
+}
+
+func NewChecksumWriter(w io.Writer, h hash.Hash) *ChecksumWriter {
+	return &ChecksumWriter{WriterDecorator: WriterDecorator{writer: w}, hash: h}
+}
+
+func (c *ChecksumWriter) Write(p []byte) (int, error) {
+	n, err := c.WriterDecorator.Write(p)
+	c.hash.Write(p[:n])
+	return n, err
+}
+
+// Sum 返回目前为止写入数据的校验和
+func (c *ChecksumWriter) Sum() []byte {
+	return c.hash.Sum(nil)
+}
+
+// ChecksumReader 在读取的同时计算校验和
+type ChecksumReader struct {
+	ReaderDecorator
+	hash hash.Hash
+}
+
+func NewChecksumReader(r io.Reader, h hash.Hash) *ChecksumReader {
+	return &ChecksumReader{ReaderDecorator: ReaderDecorator{reader: r}, hash: h}
+}
+
+func (c *ChecksumReader) Read(p []byte) (int, error) {
+	n, err := c.ReaderDecorator.Read(p)
+	c.hash.Write(p[:n])
+	return n, err
+}
+
+// Sum 返回目前为止读取数据的校验和
+func (c *ChecksumReader) Sum() []byte {
+	return c.hash.Sum(nil)
+}
+
+// ErrInvalidRate 表示限速装饰器的速率不是正数
+var ErrInvalidRate = errors.New("throttle rate must be positive")
+
+// throttle 按字节速率计算需要等待的时间
+type throttle struct {
+	bytesPerSecond int64
+	clock          Clock
+	start          time.Time
+	total          int64
+}
+
+// chunk 返回单次读写的最大字节数，大约为 0.1 秒的配额
+func (t *throttle) chunk() int {
+	if n := t.bytesPerSecond / 10; n > 0 {
+		return int(n)
+	}
+	return 1
+}
+
+// wait 记录传输了 n 字节，并等待到速率允许的时间
+func (t *throttle) wait(n int) {
+	if t.start.IsZero() {
+		t.start = t.clock.Now()
+	}
+	t.total += int64(n)
+	expected := time.Duration(float64(t.total) / float64(t.bytesPerSecond) * float64(time.Second))
+	if d := expected - t.clock.Now().Sub(t.start); d > 0 {
+		<-t.clock.After(d)
+	}
+}
+
+// ThrottleWriter 限制写入速率
+type ThrottleWriter struct {
+	WriterDecorator
+	throttle
+}
+
+func newThrottle(bytesPerSecond int64, clock Clock) (throttle, error) {
+	if bytesPerSecond <= 0 {
+		return throttle{}, fmt.Errorf("%w: %d bytes per second", ErrInvalidRate, bytesPerSecond)
+	}
+	return throttle{bytesPerSecond: bytesPerSecond, clock: clock}, nil
+}
+
+// NewThrottleWriter 的 bytesPerSecond 必须大于 0，否则返回 ErrInvalidRate
+func NewThrottleWriter(w io.Writer, bytesPerSecond int64, clock Clock) (*ThrottleWriter, error) {
+	t, err := newThrottle(bytesPerSecond, clock)
+	if err != nil {
+		return nil, err
+	}
+	return &ThrottleWriter{WriterDecorator: WriterDecorator{writer: w}, throttle: t}, nil
+}
+
+func (t *ThrottleWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		end := min(written+t.chunk(), len(p))
+		n, err := t.WriterDecorator.Write(p[written:end])
+		written += n
+		t.wait(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ThrottleReader 限制读取速率
+type ThrottleReader struct {
+	ReaderDecorator
+	throttle
+}
+
+// NewThrottleReader 的 bytesPerSecond 必须大于 0，否则返回 ErrInvalidRate
+func NewThrottleReader(r io.Reader, bytesPerSecond int64, clock Clock) (*ThrottleReader, error) {
+	t, err := newThrottle(bytesPerSecond, clock)
+	if err != nil {
+		return nil, err
+	}
+	return &ThrottleReader{ReaderDecorator: ReaderDecorator{reader: r}, throttle: t}, nil
+}
+
+func (t *ThrottleReader) Read(p []byte) (int, error) {
+	if len(p) > t.chunk() {
+		p = p[:t.chunk()]
+	}
+	n, err := t.ReaderDecorator.Read(p)
+	t.wait(n)
+	return n, err
+}
+
+// ProgressWriter 每次写入后回调累计写入的字节数
+type ProgressWriter struct {
+	WriterDecorator
+	total      int64
+	onProgress func(total int64)
+}
+
+func NewProgressWriter(w io.Writer, onProgress func(total int64)) *ProgressWriter {
+	return &ProgressWriter{WriterDecorator: WriterDecorator{writer: w}, onProgress: onProgress}
+}
+
+func (p *ProgressWriter) Write(b []byte) (int, error) {
+	n, err := p.WriterDecorator.Write(b)
+	if n > 0 {
+		p.total += int64(n)
+		p.onProgress(p.total)
+	}
+	return n, err
+}
+
+// ProgressReader 每次读取后回调累计读取的字节数
+type ProgressReader struct {
+	ReaderDecorator
+	total      int64
+	onProgress func(total int64)
+}
+
+func NewProgressReader(r io.Reader, onProgress func(total int64)) *ProgressReader {
+	return &ProgressReader{ReaderDecorator: ReaderDecorator{reader: r}, onProgress: onProgress}
+}
+
+func (p *ProgressReader) Read(b []byte) (int, error) {
+	n, err := p.ReaderDecorator.Read(b)
+	if n > 0 {
+		p.total += int64(n)
+		p.onProgress(p.total)
+	}
+	return n, err
+}
+
+// TeeWriter 把写入的数据同时复制一份到日志，日志写入失败不影响主流
+type TeeWriter struct {
+	WriterDecorator
+	log io.Writer
+}
+
+func NewTeeWriter(w io.Writer, log io.Writer) *TeeWriter {
+	return &TeeWriter{WriterDecorator: WriterDecorator{writer: w}, log: log}
+}
+
+func (t *TeeWriter) Write(p []byte) (int, error) {
+	n, err := t.WriterDecorator.Write(p)
+	t.log.Write(p[:n])
+	return n, err
+}
+
+// TeeReader 把读到的数据同时复制一份到日志
+type TeeReader struct {
+	ReaderDecorator
+	log io.Writer
+}
+
+func NewTeeReader(r io.Reader, log io.Writer) *TeeReader {
+	return &TeeReader{ReaderDecorator: ReaderDecorator{reader: r}, log: log}
+}
+
+func (t *TeeReader) Read(p []byte) (int, error) {
+	n, err := t.ReaderDecorator.Read(p)
+	t.log.Write(p[:n])
+	return n, err
+}
+
+// StreamCodec 把一对互逆的编码、解码装饰器绑定在一起
+type StreamCodec interface {
+	Encoder(w io.Writer) (io.WriteCloser, error)
+	Decoder(r io.Reader) (io.Reader, error)
+}
+
+// GzipCodec 压缩/解压
+type GzipCodec struct{}
+
+func (GzipCodec) Encoder(w io.Writer) (io.WriteCloser, error) { return NewGzipWriter(w), nil }
+func (GzipCodec) Decoder(r io.Reader) (io.Reader, error)      { return NewGzipReader(r) }
+
+// AESGCMCodec 加密/解密
+type AESGCMCodec struct {
+	Key []byte
+}
+
+func (c AESGCMCodec) Encoder(w io.Writer) (io.WriteCloser, error) { return NewEncryptWriter(w, c.Key) }
+func (c AESGCMCodec) Decoder(r io.Reader) (io.Reader, error)      { return NewDecryptReader(r, c.Key) }
+
+// nopWriteCloser 让最底层的 Writer 也能参与 Close 链
+type nopWriteCloser struct {
+	WriterDecorator
+}
+
+func (*nopWriteCloser) Close() error { return nil }
+
+// NewEncodeStack 按顺序叠加编码装饰器，数据先经过第一个 codec
+// 返回的 Writer 关闭时会逐层关闭，但不会关闭 w 本身；某个 codec 出错时已经创建的编码装饰器会被关闭
+func NewEncodeStack(w io.Writer, codecs ...StreamCodec) (io.WriteCloser, error) {
+	var out io.WriteCloser = &nopWriteCloser{WriterDecorator{writer: w}}
+	for i := len(codecs) - 1; i >= 0; i-- {
+		enc, err := codecs[i].Encoder(out)
+		if err != nil {
+			return nil, errors.Join(err, out.Close())
+		}
+		out = enc
+	}
+	return out, nil
+}
+
+// NewDecodeStack 叠加与 NewEncodeStack 相反顺序的解码装饰器，codecs 与编码时传入的顺序相同
+func NewDecodeStack(r io.Reader, codecs ...StreamCodec) (io.Reader, error) {
+	for i := len(codecs) - 1; i >= 0; i-- {
+		dec, err := codecs[i].Decoder(r)
+		if err != nil {
+			return nil, err
+		}
+		r = dec
+	}
+	return r, nil
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type namedCodec struct {
+	name  string
+	codec StreamCodec
+}
+
+// codecPermutations 返回 codecs 所有子集的所有排列，包括空的编码栈
+func codecPermutations(codecs []namedCodec) [][]namedCodec {
+	result := [][]namedCodec{nil}
+	var permute func(prefix []namedCodec, used []bool)
+	permute = func(prefix []namedCodec, used []bool) {
+		for i, c := range codecs {
+			if used[i] {
+				continue
+			}
+			next := append(append([]namedCodec(nil), prefix...), c)
+			result = append(result, next)
+			used[i] = true
+			permute(next, used)
+			used[i] = false
+		}
+	}
+	permute(nil, make([]bool, len(codecs)))
+	return result
+}
+
+func TestCodecStackRoundTrip(t *testing.T) {
+	codecs := []namedCodec{
+		{"gzip", GzipCodec{}},
+		{"aes128", AESGCMCodec{Key: bytes.Repeat([]byte{1}, 16)}},
+		{"aes256", AESGCMCodec{Key: bytes.Repeat([]byte{2}, 32)}},
+	}
+	random := make([]byte, 3*gcmChunkSize+17)
+	rand.New(rand.NewSource(1)).Read(random)
+	inputs := map[string][]byte{
+		"empty":  nil,
+		"small":  []byte("hello, decorator"),
+		"chunk":  bytes.Repeat([]byte("x"), gcmChunkSize),
+		"random": random,
+	}
+
+	stacks := codecPermutations(codecs)
+	if len(stacks) != 16 {
+		t.Fatalf("got %d permutations, want 16", len(stacks))
+	}
+	for _, stack := range stacks {
+		names := make([]string, len(stack))
+		list := make([]StreamCodec, len(stack))
+		for i, c := range stack {
+			names[i], list[i] = c.name, c.codec
+		}
+		for inputName, input := range inputs {
+			t.Run(fmt.Sprintf("%s/%s", strings.Join(names, "+"), inputName), func(t *testing.T) {
+				var sealed bytes.Buffer
+				enc, err := NewEncodeStack(&sealed, list...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// 分多次写入，覆盖跨帧的缓存
+				for rest := input; len(rest) > 0; {
+					n := min(len(rest), 10000)
+					if _, err := enc.Write(rest[:n]); err != nil {
+						t.Fatal(err)
+					}
+					rest = rest[n:]
+				}
+				if err := enc.Close(); err != nil {
+					t.Fatal(err)
+				}
+
+				dec, err := NewDecodeStack(&sealed, list...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := io.ReadAll(dec)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, input) {
+					t.Fatalf("round trip returned %d bytes, want %d identical bytes", len(got), len(input))
+				}
+			})
+		}
+	}
+}
+
+// closeRecorder 记录编码装饰器是否被关闭
+type closeRecorder struct {
+	closed *bool
+}
+
+func (c closeRecorder) Encoder(w io.Writer) (io.WriteCloser, error) {
+	return &recordingWriter{WriterDecorator: WriterDecorator{writer: w}, closed: c.closed}, nil
+}
+
+func (c closeRecorder) Decoder(r io.Reader) (io.Reader, error) { return r, nil }
+
+type recordingWriter struct {
+	WriterDecorator
+	closed *bool
+}
+
+func (r *recordingWriter) Close() error {
+	*r.closed = true
+	return r.WriterDecorator.Close()
+}
+
+func TestEncodeStackClosesBuiltEncodersOnError(t *testing.T) {
+	var sealed bytes.Buffer
+	var closed bool
+	bad := AESGCMCodec{Key: []byte("short")}
+	enc, err := NewEncodeStack(&sealed, bad, closeRecorder{&closed}, GzipCodec{})
+	if err == nil || enc != nil {
+		t.Fatalf("NewEncodeStack = %v, %v; want an error for the bad key", enc, err)
+	}
+	if !closed {
+		t.Fatal("encoder built before the failing codec was not closed")
+	}
+	// gzip 编码器被关闭后写出了完整的空流
+	dec, err := NewGzipReader(&sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(dec); err != nil || len(got) != 0 {
+		t.Fatalf("gzip stream after close = %q, %v; want a complete empty stream", got, err)
+	}
+}
+
+// failingWriter 在写出 limit 字节之后返回错误
+type failingWriter struct {
+	limit   int
+	written int
+}
+
+var errDiskFull = errors.New("disk full")
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if f.written+len(p) > f.limit {
+		return 0, errDiskFull
+	}
+	f.written += len(p)
+	return len(p), nil
+}
+
+func TestEncryptWriterReportsConsumedBytes(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 16)
+	frame := gcmFrameHeader + gcmChunkSize + 16 // 16 是 GCM 的认证标签
+	// 只够写出前缀和一帧
+	w, err := NewEncryptWriter(&failingWriter{limit: gcmPrefixSize + frame}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 先缓存 100 字节，第一帧由这 100 字节和 p 的前 gcmChunkSize-100 字节组成
+	if n, err := w.Write(make([]byte, 100)); n != 100 || err != nil {
+		t.Fatalf("first Write = %d, %v", n, err)
+	}
+	p := make([]byte, 3*gcmChunkSize)
+	n, err := w.Write(p)
+	if !errors.Is(err, errDiskFull) {
+		t.Fatalf("Write error = %v, want disk full", err)
+	}
+	if want := gcmChunkSize - 100; n != want {
+		t.Fatalf("Write = %d, want the %d bytes sealed into the first frame", n, want)
+	}
+	if n, err := w.Write([]byte("more")); n != 0 || !errors.Is(err, errDiskFull) {
+		t.Fatalf("Write after failure = %d, %v; want the same error", n, err)
+	}
+	if err := w.Close(); !errors.Is(err, errDiskFull) {
+		t.Fatalf("Close = %v, want the write error", err)
+	}
+}
+
+func TestDecryptReaderRejectsTrailingData(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 16)
+	var sealed bytes.Buffer
+	enc, err := NewEncryptWriter(&sealed, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc.Write([]byte("hello"))
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, extra := range map[string][]byte{
+		"one byte":   {0},
+		"whole copy": sealed.Bytes(),
+	} {
+		stream := append(append([]byte(nil), sealed.Bytes()...), extra...)
+		dec, err := NewDecryptReader(bytes.NewReader(stream), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := io.ReadAll(dec); !errors.Is(err, ErrTrailingData) || len(got) != 0 {
+			t.Errorf("%s: ReadAll = %q, %v; want no data and ErrTrailingData", name, got, err)
+		}
+	}
+}
+
+func TestThrottleRejectsNonPositiveRate(t *testing.T) {
+	for _, rate := range []int64{0, -1} {
+		if w, err := NewThrottleWriter(io.Discard, rate, realClock{}); !errors.Is(err, ErrInvalidRate) || w != nil {
+			t.Errorf("NewThrottleWriter(%d) = %v, %v; want ErrInvalidRate", rate, w, err)
+		}
+		if r, err := NewThrottleReader(strings.NewReader(""), rate, realClock{}); !errors.Is(err, ErrInvalidRate) || r != nil {
+			t.Errorf("NewThrottleReader(%d) = %v, %v; want ErrInvalidRate", rate, r, err)
+		}
+	}
+}
+
+// throttleSteps 是 100 字节/秒时传输 25 字节的过程：每次最多传输 10 字节，传输之后等到平均速率降回 100 字节/秒
+var throttleSteps = []struct {
+	transferred int
+	delay       time.Duration
+}{
+	{10, 100 * time.Millisecond},
+	{20, 100 * time.Millisecond},
+	{25, 50 * time.Millisecond},
+}
+
+// stepThrottle 按 throttleSteps 推进时钟，transferred 返回目前传输的字节数
+func stepThrottle(t *testing.T, clock *FakeClock, transferred func() int) {
+	t.Helper()
+	for _, step := range throttleSteps {
+		waitUntil(t, "throttle to sleep", func() bool { return clock.Waiters() == 1 })
+		if got := transferred(); got != step.transferred {
+			t.Fatalf("transferred %d bytes before sleeping, want %d", got, step.transferred)
+		}
+		clock.Advance(step.delay - time.Millisecond)
+		if clock.Waiters() != 1 {
+			t.Fatalf("woke up before %v after %d bytes", step.delay, step.transferred)
+		}
+		clock.Advance(time.Millisecond)
+	}
+}
+
+func TestThrottleWriter(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var out bytes.Buffer
+	w, err := NewThrottleWriter(&out, 100, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := w.Write(bytes.Repeat([]byte("x"), 25))
+		done <- err
+	}()
+
+	// 写入方在等待时钟，此时读取 out 不会与它竞争
+	stepThrottle(t, clock, out.Len)
+	if err := <-done; err != nil || out.Len() != 25 {
+		t.Fatalf("Write wrote %d bytes, %v; want 25", out.Len(), err)
+	}
+}
+
+func TestThrottleReader(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	// 限速装饰器在读取之后才等待，用下层的 ProgressReader 统计已经读到的字节数
+	var total int64
+	src := NewProgressReader(strings.NewReader(strings.Repeat("x", 25)), func(n int64) { total = n })
+	r, err := NewThrottleReader(src, 100, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan []byte, 1)
+	go func() {
+		got, _ := io.ReadAll(r)
+		done <- got
+	}()
+
+	stepThrottle(t, clock, func() int { return int(total) })
+	if got := <-done; len(got) != 25 {
+		t.Fatalf("read %d bytes, want 25", len(got))
+	}
+	// 读到流尾不需要再等待
+	if n := clock.Waiters(); n != 0 {
+		t.Fatalf("%d waiters left after EOF", n)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	var writes []int64
+	w := NewProgressWriter(&failingWriter{limit: 5}, func(total int64) { writes = append(writes, total) })
+	w.Write([]byte("ab"))
+	w.Write(nil)
+	w.Write([]byte("cde"))
+	if _, err := w.Write([]byte("f")); !errors.Is(err, errDiskFull) {
+		t.Fatalf("Write past the limit: err = %v, want disk full", err)
+	}
+	// 空写入和失败的写入没有传输数据，不回调
+	if want := []int64{2, 5}; !reflect.DeepEqual(writes, want) {
+		t.Fatalf("write progress = %v, want %v", writes, want)
+	}
+
+	var reads []int64
+	r := NewProgressReader(strings.NewReader("hello"), func(total int64) { reads = append(reads, total) })
+	buf := make([]byte, 2)
+	for {
+		if _, err := r.Read(buf); err != nil {
+			break
+		}
+	}
+	if want := []int64{2, 4, 5}; !reflect.DeepEqual(reads, want) {
+		t.Fatalf("read progress = %v, want %v", reads, want)
+	}
+}
+
+func TestTee(t *testing.T) {
+	var log bytes.Buffer
+	w := NewTeeWriter(&failingWriter{limit: 3}, &log)
+	w.Write([]byte("abc"))
+	if _, err := w.Write([]byte("d")); !errors.Is(err, errDiskFull) {
+		t.Fatalf("Write past the limit: err = %v, want disk full", err)
+	}
+	// 日志只记录主流真正写出的数据
+	if log.String() != "abc" {
+		t.Fatalf("write log = %q, want abc", log.String())
+	}
+
+	// 日志写入失败不影响主流
+	var out bytes.Buffer
+	w = NewTeeWriter(&out, &failingWriter{limit: 0})
+	if n, err := w.Write([]byte("main")); n != 4 || err != nil || out.String() != "main" {
+		t.Fatalf("Write with a failing log = %d, %v (%q); want the main stream untouched", n, err, out.String())
+	}
+
+	log.Reset()
+	r := NewTeeReader(strings.NewReader("hello"), &log)
+	got, err := io.ReadAll(r)
+	if err != nil || string(got) != "hello" || log.String() != "hello" {
+		t.Fatalf("ReadAll = %q, %v and log %q; want hello in both", got, err, log.String())
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	data := []byte("checksum decorator")
+	want := crc32.ChecksumIEEE(data)
+
+	w := NewChecksumWriter(io.Discard, crc32.NewIEEE())
+	w.Write(data[:5])
+	w.Write(data[5:])
+	if got := binary.BigEndian.Uint32(w.Sum()); got != want {
+		t.Fatalf("writer checksum = %08x, want %08x", got, want)
+	}
+
+	// 只有真正写出的数据参与校验
+	w = NewChecksumWriter(&failingWriter{limit: 5}, crc32.NewIEEE())
+	w.Write(data[:5])
+	w.Write(data[5:])
+	if got := binary.BigEndian.Uint32(w.Sum()); got != crc32.ChecksumIEEE(data[:5]) {
+		t.Fatalf("checksum after a failed write = %08x, want the checksum of the first 5 bytes", got)
+	}
+
+	r := NewChecksumReader(bytes.NewReader(data), crc32.NewIEEE())
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	if got := binary.BigEndian.Uint32(r.Sum()); got != want {
+		t.Fatalf("reader checksum = %08x, want %08x", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// 文本画布
+// 组件的 Draw 返回一块二维字符画布，装饰器在被包装组件的画布基础上绘制边框、滚动条、内边距、标题和阴影。
+// 每个字符占一个格子，不处理中文等双宽字符。
+
+// Canvas 是宽 Width、高 Height 的字符画布，未绘制的格子为空格
+type Canvas struct {
+	Width  int
+	Height int
+	cells  [][]rune
+}
+
+func NewCanvas(width, height int) *Canvas {
+	width, height = max(width, 0), max(height, 0)
+	cells := make([][]rune, height)
+	for y := range cells {
+		cells[y] = []rune(strings.Repeat(" ", width))
+	}
+	return &Canvas{Width: width, Height: height, cells: cells}
+}
+
+// CanvasFromLines 用多行文本创建画布，宽度取最长的一行
+func CanvasFromLines(lines ...string) *Canvas {
+	width := 0
+	for _, line := range lines {
+		width = max(width, utf8.RuneCountInString(line))
+	}
+	c := NewCanvas(width, len(lines))
+	for y, line := range lines {
+		c.WriteString(0, y, line)
+	}
+	return c
+}
+
+// Set 设置一个格子，超出范围的坐标会被忽略
+func (c *Canvas) Set(x, y int, r rune) {
+	if x < 0 || y < 0 || x >= c.Width || y >= c.Height {
+		return
+	}
+	c.cells[y][x] = r
+}
+
+// Get 读取一个格子，超出范围时返回空格
+func (c *Canvas) Get(x, y int) rune {
+	if x < 0 || y < 0 || x >= c.Width || y >= c.Height {
+		return ' '
+	}
+	return c.cells[y][x]
+}
+
+// WriteString 从 (x, y) 开始横向写入文本，超出右边界的部分被截断
+func (c *Canvas) WriteString(x, y int, s string) {
+	for _, r := range s {
+		c.Set(x, y, r)
+		x++
+	}
+}
+
+// Blit 把 src 整体复制到 (x, y) 位置
+func (c *Canvas) Blit(src *Canvas, x, y int) {
+	for sy := 0; sy < src.Height; sy++ {
+		for sx := 0; sx < src.Width; sx++ {
+			c.Set(x+sx, y+sy, src.cells[sy][sx])
+		}
+	}
+}
+
+// Crop 返回从 (x, y) 开始、宽 width 高 height 的区域，超出原画布的部分为空格
+func (c *Canvas) Crop(x, y, width, height int) *Canvas {
+	out := NewCanvas(width, height)
+	for oy := 0; oy < out.Height; oy++ {
+		for ox := 0; ox < out.Width; ox++ {
+			out.cells[oy][ox] = c.Get(x+ox, y+oy)
+		}
+	}
+	return out
+}
+
+// Lines 按行返回画布内容
+func (c *Canvas) Lines() []string {
+	lines := make([]string, c.Height)
+	for y, row := range c.cells {
+		lines[y] = string(row)
+	}
+	return lines
+}
+
+// String 返回画布内容，行之间用换行分隔，末尾没有换行
+func (c *Canvas) String() string {
+	return strings.Join(c.Lines(), "\n")
+}
@@ -0,0 +1,79 @@
+package main
+
+import "unicode/utf8"
+
+// 更多的界面装饰器：内边距、标题和阴影
+
+// PaddingDecorator 在组件四周留出空白
+type PaddingDecorator struct {
+	Decorator
+	Top, Right, Bottom, Left int
+}
+
+func (p *PaddingDecorator) Draw() *Canvas {
+	inner := p.Decorator.Draw()
+	c := NewCanvas(inner.Width+p.Left+p.Right, inner.Height+p.Top+p.Bottom)
+	c.Blit(inner, p.Left, p.Top)
+	return c
+}
+
+func (p *PaddingDecorator) Wrap(inner Component) Component {
+	c := *p
+	c.component = inner
+	return &c
+}
+
+// TitleDecorator 给组件加上标题
+// 如果组件最外层是边框，标题嵌在上边框里；否则在组件上方单独占一行
+type TitleDecorator struct {
+	Decorator
+	Title string
+}
+
+func (t *TitleDecorator) Draw() *Canvas {
+	inner := t.Decorator.Draw()
+	label := " " + t.Title + " "
+	if inner.Height > 0 && inner.Get(0, 0) == '┌' && utf8.RuneCountInString(label)+2 <= inner.Width {
+		c := NewCanvas(inner.Width, inner.Height)
+		c.Blit(inner, 0, 0)
+		c.WriteString(1, 0, label)
+		return c
+	}
+	c := NewCanvas(max(inner.Width, utf8.RuneCountInString(t.Title)), inner.Height+1)
+	c.WriteString(0, 0, t.Title)
+	c.Blit(inner, 0, 1)
+	return c
+}
+
+func (t *TitleDecorator) Wrap(inner Component) Component {
+	c := *t
+	c.component = inner
+	return &c
+}
+
+// ShadowDecorator 在组件右侧和下方画出阴影
+type ShadowDecorator struct {
+	Decorator
+}
+
+func (s *ShadowDecorator) Draw() *Canvas {
+	inner := s.Decorator.Draw()
+	if inner.Width == 0 || inner.Height == 0 {
+		return inner
+	}
+	c := NewCanvas(inner.Width+1, inner.Height+1)
+	c.Blit(inner, 0, 0)
+	for y := 1; y <= inner.Height; y++ {
+		c.Set(inner.Width, y, '▒')
+	}
+	for x := 1; x <= inner.Width; x++ {
+		c.Set(x, inner.Height, '▒')
+	}
+	return c
+}
+
+func (s *ShadowDecorator) Wrap(inner Component) Component {
+	c := *s
+	c.component = inner
+	return &c
+}
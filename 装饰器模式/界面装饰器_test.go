@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+func TestDecoratorStacksGolden(t *testing.T) {
+	text := func() Component {
+		return &TextComponent{Lines: []string{"line 1", "line 2", "line 3", "line 4", "line 5", "line 6"}}
+	}
+	stacks := map[string]Component{
+		"border":        &BorderDecorator{Decorator{component: &ConcreteComponent{}}},
+		"scroll_border": &ScrollDecorator{Decorator: Decorator{component: &BorderDecorator{Decorator{component: &ConcreteComponent{}}}}},
+		"scroll_top":    &ScrollDecorator{Height: 3, Decorator: Decorator{component: text()}},
+		"scroll_middle": &ScrollDecorator{Height: 2, Offset: 2, Decorator: Decorator{component: text()}},
+		"scroll_bottom": &ScrollDecorator{Height: 3, Offset: 99, Decorator: Decorator{component: text()}},
+		"padding":       &PaddingDecorator{Top: 1, Right: 2, Bottom: 1, Left: 3, Decorator: Decorator{component: &TextComponent{Lines: []string{"pad"}}}},
+		"title_inline":  &TitleDecorator{Title: "Log", Decorator: Decorator{component: &BorderDecorator{Decorator{component: text()}}}},
+		"title_above":   &TitleDecorator{Title: "A long title", Decorator: Decorator{component: &TextComponent{Lines: []string{"body"}}}},
+		"shadow":        &ShadowDecorator{Decorator{component: &BorderDecorator{Decorator{component: &TextComponent{Lines: []string{"box"}}}}}},
+		"window": &ShadowDecorator{Decorator{component: &TitleDecorator{
+			Title: "Log",
+			Decorator: Decorator{component: &BorderDecorator{Decorator{component: &ScrollDecorator{
+				Height:    3,
+				Offset:    2,
+				Decorator: Decorator{component: &PaddingDecorator{Left: 1, Right: 1, Decorator: Decorator{component: text()}}},
+			}}}},
+		}}},
+	}
+	for name, stack := range stacks {
+		t.Run(name, func(t *testing.T) {
+			got := stack.Draw().String() + "\n"
+			golden := filepath.Join("testdata", name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("%s differs from %s (run go test -update to rewrite it)\ngot:\n%swant:\n%s", name, golden, got, want)
+			}
+		})
+	}
+}
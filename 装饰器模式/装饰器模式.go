@@ -1,6 +1,15 @@
 package main
 
-import "fmt"
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
 
 // 装饰器模式
 // 装饰器模式是一种结构型设计模式，它允许在不改变对象的情况下，动态地给对象添加额外的功能。
@@ -13,14 +22,23 @@ import "fmt"
 // GUI例子
 
 type Component interface {
-	Draw() string
+	Draw() *Canvas
 }
 
 // ConcreteComponent 是一个具体的组件
 type ConcreteComponent struct{}
 
-func (c *ConcreteComponent) Draw() string {
-	return "Drawing a basic component"
+func (c *ConcreteComponent) Draw() *Canvas {
+	return CanvasFromLines("Drawing a basic component")
+}
+
+// TextComponent 是显示多行文本的组件
+type TextComponent struct {
+	Lines []string
+}
+
+func (t *TextComponent) Draw() *Canvas {
+	return CanvasFromLines(t.Lines...)
 }
 
 // Decorator 是一个装饰器基类
@@ -28,11 +46,11 @@ type Decorator struct {
 	component Component
 }
 
-func (d *Decorator) Draw() string {
+func (d *Decorator) Draw() *Canvas {
 	if d.component != nil {
 		return d.component.Draw()
 	}
-	return ""
+	return NewCanvas(0, 0)
 }
 
 // BorderDecorator 是一个具体的装饰器，添加边框功能
@@ -40,17 +58,59 @@ type BorderDecorator struct {
 	Decorator
 }
 
-func (b *BorderDecorator) Draw() string {
-	return b.Decorator.Draw() + " with a border"
+func (b *BorderDecorator) Draw() *Canvas {
+	inner := b.Decorator.Draw()
+	c := NewCanvas(inner.Width+2, inner.Height+2)
+	c.Blit(inner, 1, 1)
+	right, bottom := c.Width-1, c.Height-1
+	for x := 1; x < right; x++ {
+		c.Set(x, 0, '─')
+		c.Set(x, bottom, '─')
+	}
+	for y := 1; y < bottom; y++ {
+		c.Set(0, y, '│')
+		c.Set(right, y, '│')
+	}
+	c.Set(0, 0, '┌')
+	c.Set(right, 0, '┐')
+	c.Set(0, bottom, '└')
+	c.Set(right, bottom, '┘')
+	return c
 }
 
 // ScrollDecorator 是另一个具体的装饰器，添加滚动条功能
+// 只显示从第 Offset 行开始的 Height 行，右侧的滚动条标出当前位置；Height 为 0 时显示全部内容
 type ScrollDecorator struct {
 	Decorator
+	Height int
+	Offset int
 }
 
-func (s *ScrollDecorator) Draw() string {
-	return s.Decorator.Draw() + " with a scrollbar"
+func (s *ScrollDecorator) Draw() *Canvas {
+	inner := s.Decorator.Draw()
+	height := s.Height
+	if height <= 0 {
+		height = inner.Height
+	}
+	offset := min(max(s.Offset, 0), max(inner.Height-height, 0))
+
+	c := NewCanvas(inner.Width+1, height)
+	c.Blit(inner.Crop(0, offset, inner.Width, height), 0, 0)
+
+	// 滑块长度与可见比例成正比，位置与偏移量成正比
+	thumb, start := height, 0
+	if inner.Height > height {
+		thumb = max(height*height/inner.Height, 1)
+		start = offset * (height - thumb) / (inner.Height - height)
+	}
+	for y := 0; y < height; y++ {
+		r := '░'
+		if y >= start && y < start+thumb {
+			r = '█'
+		}
+		c.Set(inner.Width, y, r)
+	}
+	return c
 }
 
 func main() {
@@ -69,6 +129,92 @@ func main() {
 
 	// 绘制最终组件
 	fmt.Println(scroll.Draw())
+
+	// 带内边距、标题、阴影，并且只显示三行的滚动窗口
+	text := &TextComponent{Lines: []string{"line 1", "line 2", "line 3", "line 4", "line 5", "line 6"}}
+	window := &ShadowDecorator{Decorator{component: &TitleDecorator{
+		Title: "Log",
+		Decorator: Decorator{component: &BorderDecorator{Decorator{component: &ScrollDecorator{
+			Height:    3,
+			Offset:    2,
+			Decorator: Decorator{component: &PaddingDecorator{Left: 1, Right: 1, Decorator: Decorator{component: text}}},
+		}}}},
+	}}}
+	fmt.Println(window.Draw())
+
+	// 查看装饰器栈，并在不手动重新构造的情况下增删某一层
+	fmt.Println("layers:", DescribeLayers(scroll))
+	if b, ok := FindLayer[*BorderDecorator](scroll); ok {
+		fmt.Println("border layer draws:\n" + b.Draw().String())
+	}
+	noBorder := RemoveLayer[*BorderDecorator](scroll)
+	fmt.Println("without border:\n" + noBorder.Draw().String())
+	doubleBorder, _ := InsertLayer(scroll, 0, &BorderDecorator{})
+	fmt.Println("extra border:\n" + doubleBorder.Draw().String())
+
+	// 调用类组件的弹性装饰器：缓存 -> 重试 -> 熔断 -> 超时 -> 服务
+	calls := 0
+	flaky := CallerFunc[string, string](func(ctx context.Context, user string) (string, error) {
+		calls++
+		if calls%3 != 0 {
+			return "", fmt.Errorf("call %d: service unavailable", calls)
+		}
+		return "profile of " + user, nil
+	})
+	var service Caller[string, string] = NewTimeoutDecorator[string, string](flaky, 100*time.Millisecond)
+	service = NewCircuitBreakerDecorator(service, 5, time.Second)
+	service = NewRetryDecorator(service, 3, time.Millisecond, 10*time.Millisecond)
+	service = NewCacheDecorator(service, time.Minute)
+	for i := 0; i < 2; i++ {
+		resp, err := service.Call(context.Background(), "alice")
+		fmt.Printf("resp=%q err=%v calls=%d\n", resp, err, calls)
+	}
+
+	// 用假时钟观察熔断器的状态变化
+	clock := NewFakeClock(time.Unix(0, 0))
+	failing := CallerFunc[string, string](func(ctx context.Context, req string) (string, error) {
+		return "", errors.New("boom")
+	})
+	breaker := NewCircuitBreakerDecorator[string, string](failing, 2, 30*time.Second)
+	breaker.Clock = clock
+	for i := 0; i < 3; i++ {
+		_, err := breaker.Call(context.Background(), "req")
+		fmt.Printf("breaker=%s err=%v\n", breaker.State(), err)
+	}
+	clock.Advance(30 * time.Second)
+	fmt.Println("after cooldown:", breaker.State())
+	_, err := breaker.Call(context.Background(), "probe")
+	fmt.Printf("probe failed, breaker=%s err=%v\n", breaker.State(), err)
+
+	// 流装饰器：校验 -> 压缩 -> 加密 写入，再按相反顺序读回
+	key := bytes.Repeat([]byte{0x42}, 32)
+	codecs := []StreamCodec{GzipCodec{}, AESGCMCodec{Key: key}}
+	plain := strings.Repeat("decorators all the way down. ", 1000)
+
+	var sealed bytes.Buffer
+	enc, err := NewEncodeStack(&sealed, codecs...)
+	if err != nil {
+		fmt.Println("encode stack:", err)
+		return
+	}
+	sumIn := NewChecksumWriter(enc, sha256.New())
+	io.Copy(sumIn, strings.NewReader(plain))
+	if err := sumIn.Close(); err != nil {
+		fmt.Println("close:", err)
+		return
+	}
+	fmt.Printf("plain %d bytes -> sealed %d bytes\n", len(plain), sealed.Len())
+
+	dec, err := NewDecodeStack(&sealed, codecs...)
+	if err != nil {
+		fmt.Println("decode stack:", err)
+		return
+	}
+	var lastProgress int64
+	sumOut := NewChecksumReader(NewProgressReader(dec, func(total int64) { lastProgress = total }), sha256.New())
+	restored, err := io.ReadAll(sumOut)
+	fmt.Printf("restored %d bytes, progress=%d, err=%v, same=%v, checksum match=%v\n",
+		len(restored), lastProgress, err, string(restored) == plain, bytes.Equal(sumIn.Sum(), sumOut.Sum()))
 }
 
 